@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Nikolay961996/metsys/internal/crypto"
+)
+
+// importReport response of /import
+type importReport struct {
+	Errors []struct {
+		Error string `json:"error"`
+		Line  int    `json:"line"`
+	} `json:"errors"`
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+}
+
+// runImport sends file to /import and prints report.
+// Body is streamed unless it has to be signed or encrypted as a whole.
+// Request isn't retried: counters of committed chunks would be added twice.
+func runImport(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(out)
+	address := fs.String("a", "localhost:8080", "server address")
+	format := fs.String("format", "", "file format ndjson or csv, by file extension if empty")
+	chunk := fs.Int("chunk", 0, "lines per transaction, server default if 0")
+	key := fs.String("k", "", "key for signing")
+	cryptoKey := fs.String("crypto-key", "", "public key of server for encryption")
+	realIP := fs.String("real-ip", "", "X-Real-IP header for trusted subnet check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: metsys import [flags] file")
+	}
+	file := fs.Arg(0)
+
+	if *format == "" {
+		*format = "ndjson"
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			*format = "csv"
+		}
+	}
+	u := *address
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	query := url.Values{"format": {*format}}
+	if *chunk > 0 {
+		query.Set("chunk", strconv.Itoa(*chunk))
+	}
+	u = strings.TrimSuffix(u, "/") + "/import?" + query.Encode()
+
+	var publicKey *rsa.PublicKey
+	if *cryptoKey != "" {
+		var err error
+		if publicKey, err = crypto.ParseRSAPublicKeyPEM(*cryptoKey); err != nil {
+			return fmt.Errorf("error parsing public key: %w", err)
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body io.ReadCloser
+	var sign string
+	if *key == "" && publicKey == nil {
+		body = gzipStream(f)
+	} else {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		if *key != "" {
+			h := hmac.New(sha256.New, []byte(*key))
+			h.Write(data)
+			sign = hex.EncodeToString(h.Sum(nil))
+		}
+		if publicKey != nil {
+			if data, err = crypto.EncryptMessageWithPublicKey(data, publicKey); err != nil {
+				return fmt.Errorf("error encrypting file: %w", err)
+			}
+		}
+		body = gzipStream(bytes.NewReader(data))
+	}
+
+	request, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Encoding", "gzip")
+	if sign != "" {
+		request.Header.Set("HashSHA256", sign)
+	}
+	if *realIP != "" {
+		request.Header.Set("X-Real-IP", *realIP)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var report importReport
+	if err = json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("import failed: status %d", resp.StatusCode)
+	}
+	fmt.Fprintf(out, "imported %d, failed %d\n", report.Imported, report.Failed)
+	for _, e := range report.Errors {
+		fmt.Fprintf(out, "line %d: %s\n", e.Line, e.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("import stopped: status %d", resp.StatusCode)
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d lines not imported", report.Failed)
+	}
+	return nil
+}
+
+// gzipStream compresses r while request is being sent, closing result stops compression
+func gzipStream(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
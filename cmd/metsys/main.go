@@ -0,0 +1,42 @@
+// Entry point for metsys command line tool.
+//
+// Usage:
+//
+//	metsys import [-a address] [-format ndjson|csv] [-chunk n] [-k key] [-crypto-key public.pem] file
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: metsys <command> [flags]
+
+commands:
+  import  load metrics with timestamps from NDJSON or CSV file into server`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "import":
+		return runImport(args[1:], out)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprintln(out, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%w", args[0], errUsage)
+	}
+}
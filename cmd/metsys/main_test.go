@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/router"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+)
+
+// TestImport тестирует загрузку файла на сервер командой import
+func TestImport(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(router.MetricsRouterWithServer(s, "secret", nil, ""))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	ndjson := filepath.Join(dir, "metrics.ndjson")
+	require.NoError(t, os.WriteFile(ndjson, []byte(`{"id":"Alloc","type":"gauge","value":1.5,"timestamp":1700000000}
+{"id":"PollCount","type":"counter","delta":3}
+`), 0o600))
+	csv := filepath.Join(dir, "metrics.csv")
+	require.NoError(t, os.WriteFile(csv, []byte("id,type,value\nHits,counter,2\nBad,gauge,x\n"), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"import", "-a", ts.URL, ndjson}, &out))
+	assert.Equal(t, "imported 2, failed 0\n", out.String())
+
+	// подписанный запрос проверяется сервером
+	out.Reset()
+	err := run([]string{"import", "-a", ts.URL, "-k", "secret", csv}, &out)
+	assert.EqualError(t, err, "1 lines not imported")
+	assert.Equal(t, "imported 1, failed 1\nline 3: invalid value \"x\"\n", out.String())
+
+	ctx := context.Background()
+	alloc, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, alloc)
+	hits, err := s.GetCounter(ctx, "Hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), hits)
+
+	assert.Error(t, run([]string{"import", "-a", ts.URL, filepath.Join(dir, "missing.csv")}, &out))
+	assert.ErrorIs(t, run(nil, &out), errUsage)
+	assert.Error(t, run([]string{"export"}, &out))
+}
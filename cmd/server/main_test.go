@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,6 +22,7 @@ import (
 )
 
 func TestPositiveServer(t *testing.T) {
+	ctx := context.Background()
 	type want struct {
 		statusCode int
 	}
@@ -59,11 +61,11 @@ func TestPositiveServer(t *testing.T) {
 			assert.Equal(t, tt.want.statusCode, resp.StatusCode)
 			switch metricType {
 			case models.Gauge:
-				v, err := s.GetGauge(metricName)
+				v, err := s.GetGauge(ctx, metricName)
 				require.NoError(t, err)
 				assert.Equal(t, metricValue, strconv.FormatFloat(v, 'f', -1, 64))
 			case models.Counter:
-				_, err := s.GetCounter(metricName)
+				_, err := s.GetCounter(ctx, metricName)
 				require.NoError(t, err)
 			default:
 				require.Error(t, fmt.Errorf("unknown metric type: %s", metricType))
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/Nikolay961996/metsys/internal/server/router"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
 	"github.com/Nikolay961996/metsys/models"
 )
 
@@ -75,6 +77,27 @@ func TestSendRequest(t *testing.T) {
 	}
 }
 
+// TestSendRejected тестирует отказ от повторной отправки метрики, отклонённой сервером
+func TestSendRejected(t *testing.T) {
+	var calls atomic.Int32
+	handler := router.MetricsRouterWithServer(storage.NewMemStorage(), "", nil, "")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	value := 1.5
+	err := Report(models.Metrics{ID: "Alloc", MType: "meter", Value: &value}, ts.URL, "", nil, "", nil)
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	require.NotNil(t, statusErr.Problem)
+	assert.Equal(t, models.ErrCodeInvalidType, statusErr.Problem.Code)
+	assert.False(t, statusErr.Retryable())
+	assert.Equal(t, int32(1), calls.Load())
+}
+
 func metricBatchServerTestHandler(r *http.Request, t *testing.T, metrics *Metrics) {
 	var mr []models.Metrics
 	var buf bytes.Buffer
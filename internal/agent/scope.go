@@ -16,6 +16,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/Nikolay961996/metsys/internal/crypto"
@@ -25,16 +26,43 @@ import (
 	"github.com/Nikolay961996/metsys/models"
 )
 
-// HTTPStatusError manual error type
+// HTTPStatusError manual error type, Problem is set if server described error
 type HTTPStatusError struct {
+	Problem    *models.Problem
 	StatusCode int
 }
 
 // Error implementation
 func (e *HTTPStatusError) Error() string {
+	if e.Problem != nil {
+		return fmt.Sprintf("HTTP error: status %d, %s: %s", e.StatusCode, e.Problem.Code, e.Problem.Detail)
+	}
 	return fmt.Sprintf("HTTP error: status %d", e.StatusCode)
 }
 
+// Retryable server may accept the same request later, rejected metrics are not resent
+func (e *HTTPStatusError) Retryable() bool {
+	if e.Problem == nil {
+		return true
+	}
+	switch e.Problem.Code {
+	case models.ErrCodeStorageUnavailable, models.ErrCodeInternal, models.ErrCodeRateLimited:
+		return true
+	}
+	return false
+}
+
+func newHTTPStatusError(r *resty.Response) *HTTPStatusError {
+	e := &HTTPStatusError{StatusCode: r.StatusCode()}
+	if strings.HasPrefix(r.Header().Get("Content-Type"), models.ProblemContentType) {
+		var p models.Problem
+		if json.Unmarshal(r.Body(), &p) == nil {
+			e.Problem = &p
+		}
+	}
+	return e
+}
+
 // Report to server
 func Report(metrics models.Metrics, serverAddress string, keyForSigning string, publicKey *rsa.PublicKey, realIP string, GRPCClient *proto.MetricsServiceClient) error {
 	if GRPCClient != nil {
@@ -45,8 +73,8 @@ func Report(metrics models.Metrics, serverAddress string, keyForSigning string,
 		_, err := (*GRPCClient).UpdateMetric(metadata.NewOutgoingContext(context.Background(), md), &proto.MetricUpdateRequest{
 			Id:    metrics.ID,
 			Type:  metrics.MType,
-			Value: *metrics.Value,
-			Delta: *metrics.Delta,
+			Value: metrics.Value,
+			Delta: metrics.Delta,
 		})
 
 		if err != nil {
@@ -193,7 +221,7 @@ func sendToServer(client *resty.Client, serverURL string, metrics *models.Metric
 			r, e := request.Post(serverURL)
 			if e == nil {
 				if r.StatusCode() != http.StatusOK {
-					return &HTTPStatusError{StatusCode: r.StatusCode()}
+					return newHTTPStatusError(r)
 				}
 				resp = r
 			}
@@ -202,14 +230,14 @@ func sendToServer(client *resty.Client, serverURL string, metrics *models.Metric
 			models.Log.Warn(fmt.Sprintf("Retry error: %s", err.Error()))
 			var netErr net.Error
 			var netStatusErr *HTTPStatusError
-			return errors.As(err, &netErr) || errors.As(err, &netStatusErr) || errors.Is(err, io.EOF)
+			return errors.As(err, &netErr) || (errors.As(err, &netStatusErr) && netStatusErr.Retryable()) || errors.Is(err, io.EOF)
 		})
 	if err != nil {
-		return fmt.Errorf("failed to send metrics. %s", err.Error())
+		return fmt.Errorf("failed to send metrics. %w", err)
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return &HTTPStatusError{resp.StatusCode()}
+		return newHTTPStatusError(resp)
 	}
 
 	return nil
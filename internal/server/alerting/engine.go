@@ -0,0 +1,164 @@
+// Package alerting rules evaluation and alert states
+package alerting
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// State of alert: pending until condition holds for rule For duration, then firing,
+// resolved once condition is gone
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// resolvedRetention resolved alerts are kept for display this long
+const resolvedRetention = 15 * time.Minute
+
+// Alert state of one rule for one metric series
+type Alert struct {
+	ActiveAt   time.Time     `json:"activeAt"`
+	FiredAt    *time.Time    `json:"firedAt,omitempty"`
+	ResolvedAt *time.Time    `json:"resolvedAt,omitempty"`
+	Labels     models.Labels `json:"labels,omitempty"`
+	Rule       string        `json:"rule"`
+	Metric     string        `json:"metric"`
+	Op         string        `json:"op"`
+	State      State         `json:"state"`
+	Value      float64       `json:"value"`
+	Threshold  float64       `json:"threshold"`
+}
+
+// Engine evaluates rules against storage and keeps alert states between evaluations
+type Engine struct {
+	storage repositories.Storage
+	alerts  map[string]*Alert // by rule name and series key
+	rules   []Rule
+	mu      sync.RWMutex
+}
+
+// NewEngine engine for rules, nothing is evaluated until Eval or Run
+func NewEngine(storage repositories.Storage, rules []Rule) *Engine {
+	return &Engine{
+		storage: storage,
+		rules:   rules,
+		alerts:  map[string]*Alert{},
+	}
+}
+
+// Run evaluates rules every interval until ctx is done
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := e.Eval(ctx, now); err != nil {
+				models.Log.Error(fmt.Sprintf("Alert rules evaluation error: %v", err))
+			}
+		}
+	}
+}
+
+// Eval evaluates all rules once at moment now
+func (e *Engine) Eval(ctx context.Context, now time.Time) error {
+	metrics, err := e.storage.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	breached := map[string]bool{}
+	for i := range e.rules {
+		r := &e.rules[i]
+		for _, m := range metrics {
+			if !r.matches(m.Name, m.Type, m.Labels) {
+				continue
+			}
+			v, err := strconv.ParseFloat(m.Value, 64)
+			if err != nil || !r.breached(v) {
+				continue
+			}
+			key := r.Name + "/" + models.SeriesKey(m.Name, m.Labels)
+			breached[key] = true
+			e.activate(key, r, m.Labels, v, now)
+		}
+	}
+
+	for key, a := range e.alerts {
+		if !breached[key] {
+			e.deactivate(key, a, now)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) activate(key string, r *Rule, labels models.Labels, v float64, now time.Time) {
+	a, ok := e.alerts[key]
+	if !ok || a.State == StateResolved {
+		a = &Alert{
+			Rule:      r.Name,
+			Metric:    r.Metric,
+			Labels:    labels,
+			Op:        r.Op,
+			Threshold: r.Threshold,
+			State:     StatePending,
+			ActiveAt:  now,
+		}
+		e.alerts[key] = a
+	}
+	a.Value = v
+
+	if a.State == StatePending && now.Sub(a.ActiveAt) >= r.For {
+		a.State = StateFiring
+		a.FiredAt = &now
+		models.Log.Warn(fmt.Sprintf("Alert %s is firing for %s: %v %s %v", a.Rule, models.SeriesKey(a.Metric, a.Labels), v, a.Op, a.Threshold))
+	}
+}
+
+func (e *Engine) deactivate(key string, a *Alert, now time.Time) {
+	switch a.State {
+	case StatePending:
+		delete(e.alerts, key)
+	case StateFiring:
+		a.State = StateResolved
+		a.ResolvedAt = &now
+		models.Log.Info(fmt.Sprintf("Alert %s is resolved for %s", a.Rule, models.SeriesKey(a.Metric, a.Labels)))
+	case StateResolved:
+		if now.Sub(*a.ResolvedAt) > resolvedRetention {
+			delete(e.alerts, key)
+		}
+	}
+}
+
+// Alerts copy of current alerts ordered by rule and series
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	r := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		r = append(r, *a)
+	}
+	slices.SortFunc(r, func(a, b Alert) int {
+		return cmp.Or(cmp.Compare(a.Rule, b.Rule), cmp.Compare(a.Labels.String(), b.Labels.String()))
+	})
+	return r
+}
@@ -0,0 +1,86 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// TestEngine_StateMachine тестирует переходы pending → firing → resolved
+func TestEngine_StateMachine(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	e := NewEngine(s, []Rule{
+		{Name: "HighAlloc", Metric: "Alloc", Type: models.Gauge, Op: ">", Threshold: 100, For: time.Minute},
+	})
+	hostA := models.SeriesKey("Alloc", models.Labels{"host": "a"})
+	hostB := models.SeriesKey("Alloc", models.Labels{"host": "b"})
+	start := time.Now()
+
+	require.NoError(t, s.SetGauge(ctx, hostA, 150))
+	require.NoError(t, s.SetGauge(ctx, hostB, 50))
+	require.NoError(t, e.Eval(ctx, start))
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Equal(t, "a", alerts[0].Labels["host"])
+
+	require.NoError(t, e.Eval(ctx, start.Add(30*time.Second)))
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	require.NoError(t, e.Eval(ctx, start.Add(time.Minute)))
+	alerts = e.Alerts()
+	assert.Equal(t, StateFiring, alerts[0].State)
+	require.NotNil(t, alerts[0].FiredAt)
+
+	require.NoError(t, s.SetGauge(ctx, hostA, 10))
+	require.NoError(t, e.Eval(ctx, start.Add(2*time.Minute)))
+	alerts = e.Alerts()
+	assert.Equal(t, StateResolved, alerts[0].State)
+	require.NotNil(t, alerts[0].ResolvedAt)
+
+	require.NoError(t, e.Eval(ctx, start.Add(2*time.Minute+resolvedRetention+time.Second)))
+	assert.Empty(t, e.Alerts())
+}
+
+// TestEngine_PendingDropped тестирует сброс pending алерта до срабатывания
+func TestEngine_PendingDropped(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	e := NewEngine(s, []Rule{
+		{Name: "TooManyPolls", Metric: "PollCount", Type: models.Counter, Op: ">=", Threshold: 10, For: time.Minute},
+	})
+	start := time.Now()
+
+	require.NoError(t, s.AddCounter(ctx, "PollCount", 10))
+	require.NoError(t, e.Eval(ctx, start))
+	require.Len(t, e.Alerts(), 1)
+
+	require.NoError(t, s.ResetCounter(ctx, "PollCount"))
+	require.NoError(t, e.Eval(ctx, start.Add(time.Second)))
+	assert.Empty(t, e.Alerts())
+}
+
+// TestEngine_ImmediateFiring тестирует срабатывание правила без задержки for
+func TestEngine_ImmediateFiring(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	e := NewEngine(s, []Rule{
+		{Name: "Cold", Metric: "temperature", Type: models.Gauge, Op: "<", Threshold: 0, Labels: models.Labels{"room": "lab"}},
+	})
+
+	require.NoError(t, s.SetGauge(ctx, models.SeriesKey("temperature", models.Labels{"room": "lab"}), -5))
+	require.NoError(t, s.SetGauge(ctx, models.SeriesKey("temperature", models.Labels{"room": "hall"}), -5))
+	require.NoError(t, e.Eval(ctx, time.Now()))
+
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, -5.0, alerts[0].Value)
+}
@@ -0,0 +1,109 @@
+// Package alerting threshold rules evaluated against stored metrics
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// ErrInvalidRule rule in config is malformed
+var ErrInvalidRule = errors.New("invalid alert rule")
+
+// Rule fires when metric value compared with threshold holds for For duration.
+// Without labels rule applies to every series of metric, labels narrow it down.
+type Rule struct {
+	Labels    models.Labels `json:"labels,omitempty"`
+	Name      string        `json:"name"`
+	Metric    string        `json:"metric"`
+	Type      string        `json:"type"` // gauge or counter
+	Op        string        `json:"op"`   // >, >=, <, <=, ==, !=
+	ForStr    string        `json:"for"`
+	Threshold float64       `json:"threshold"`
+	For       time.Duration `json:"-"`
+}
+
+// rulesFile config file layout
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules reads and validates rules from json config
+func LoadRules(path string) ([]Rule, error) {
+	d, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules file error: %w", err)
+	}
+
+	var parsed rulesFile
+	if err = json.Unmarshal(d, &parsed); err != nil {
+		return nil, fmt.Errorf("parse rules file error: %w", err)
+	}
+
+	names := map[string]bool{}
+	for i := range parsed.Rules {
+		r := &parsed.Rules[i]
+		if r.ForStr != "" {
+			r.For, err = time.ParseDuration(r.ForStr)
+			if err != nil || r.For < 0 {
+				return nil, fmt.Errorf("%w %q: bad for %q", ErrInvalidRule, r.Name, r.ForStr)
+			}
+		}
+		if err = r.validate(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("%w %q: duplicate name", ErrInvalidRule, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return parsed.Rules, nil
+}
+
+func (r *Rule) validate() error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("%w: name is empty", ErrInvalidRule)
+	case r.Metric == "":
+		return fmt.Errorf("%w %q: metric is empty", ErrInvalidRule, r.Name)
+	case r.Type != models.Gauge && r.Type != models.Counter:
+		return fmt.Errorf("%w %q: type %q", ErrInvalidRule, r.Name, r.Type)
+	case r.Labels.Validate() != nil:
+		return fmt.Errorf("%w %q: %v", ErrInvalidRule, r.Name, r.Labels.Validate())
+	}
+	if _, ok := comparisons[r.Op]; !ok {
+		return fmt.Errorf("%w %q: op %q", ErrInvalidRule, r.Name, r.Op)
+	}
+	return nil
+}
+
+var comparisons = map[string]func(v, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// matches reports whether series belongs to rule
+func (r *Rule) matches(name string, metricType string, labels models.Labels) bool {
+	if name != r.Metric || metricType != r.Type {
+		return false
+	}
+	for k, v := range r.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// breached reports whether value satisfies rule condition
+func (r *Rule) breached(v float64) bool {
+	return comparisons[r.Op](v, r.Threshold)
+}
@@ -0,0 +1,44 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadRules тестирует чтение и проверку правил из файла
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"rules":[{"name":"HighAlloc","metric":"Alloc","type":"gauge","op":">","threshold":1e9,"for":"1m"}]}`, false},
+		{"bad op", `{"rules":[{"name":"r","metric":"Alloc","type":"gauge","op":"~","threshold":1}]}`, true},
+		{"bad type", `{"rules":[{"name":"r","metric":"Alloc","type":"histogram","op":">","threshold":1}]}`, true},
+		{"bad for", `{"rules":[{"name":"r","metric":"Alloc","type":"gauge","op":">","threshold":1,"for":"soon"}]}`, true},
+		{"bad label", `{"rules":[{"name":"r","metric":"Alloc","type":"gauge","op":">","threshold":1,"labels":{"1x":"a"}}]}`, true},
+		{"duplicate", `{"rules":[{"name":"r","metric":"a","type":"gauge","op":">"},{"name":"r","metric":"b","type":"gauge","op":">"}]}`, true},
+		{"broken json", `{"rules":[`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			rules, err := LoadRules(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, rules, 1)
+			assert.Equal(t, time.Minute, rules[0].For)
+		})
+	}
+}
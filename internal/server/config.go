@@ -13,33 +13,65 @@ import (
 	"github.com/caarlos0/env/v6"
 	"go.uber.org/zap"
 
+	"github.com/Nikolay961996/metsys/internal/server/router"
 	"github.com/Nikolay961996/metsys/models"
 )
 
 type Config struct {
-	RunOnServerAddress string        `json:"address"`      // server address
-	GRPCPort           string        `json:"grpc_port"`    // gRPC server port
-	FileStoragePath    string        `json:"store_file"`   // file storage path
-	DatabaseDSN        string        `json:"database_dsn"` // database connection string
-	KeyForSigning      string        // key for sign
-	CryptoKey          string        `json:"crypto_key"` // key for decrypt (private key of server)
-	ConfigFile         string        // json config
-	StoreIntervalStr   string        `json:"store_interval"` // interval for stor
-	TrustedSubnet      string        `json:"trusted_subnet"` // trusted subnet in CIDR format
-	StoreInterval      time.Duration // interval for stor
-	Restore            bool          `json:"restore"` // need restore
+	RunOnServerAddress        string        `json:"address"`      // server address
+	GRPCPort                  string        `json:"grpc_port"`    // gRPC server port
+	FileStoragePath           string        `json:"store_file"`   // file storage path
+	DatabaseDSN               string        `json:"database_dsn"` // database connection string
+	KeyForSigning             string        // key for sign
+	CryptoKey                 string        `json:"crypto_key"` // key for decrypt (private key of server)
+	ConfigFile                string        // json config
+	StoreIntervalStr          string        `json:"store_interval"`              // interval for stor
+	TrustedSubnet             string        `json:"trusted_subnet"`              // trusted subnet in CIDR format
+	AlertRulesFile            string        `json:"alert_rules"`                 // json file with alert rules, alerting is off if empty
+	AlertIntervalStr          string        `json:"alert_interval"`              // interval for alert rules evaluation
+	NotifyURLs                string        `json:"notify_urls"`                 // comma separated webhooks for operational events
+	StatsDPort                string        `json:"statsd_port"`                 // StatsD UDP/TCP port, listener is off if empty
+	StatsDAggregationStr      string        `json:"statsd_aggregation_interval"` // StatsD samples aggregation window
+	StatsDFlushStr            string        `json:"statsd_flush_interval"`       // interval for writing StatsD aggregates to storage
+	InfluxTemplate            string        `json:"influx_template"`             // metric naming template for InfluxDB line protocol
+	InfluxCounters            string        `json:"influx_counters"`             // globs of measurement.field of integer fields stored as counters
+	GraphitePort              string        `json:"graphite_port"`               // Graphite plaintext TCP port, listener is off if empty
+	GrafanaIntervalStr        string        `json:"grafana_interval"`            // interval for recording samples served to Grafana
+	RateLimits                string        `json:"rate_limits"`                 // per client rate limits prefix=rate[:burst],..., off if empty
+	RateLimitProxies          string        `json:"rate_limit_proxies"`          // comma separated CIDRs of proxies trusted to set X-Real-IP
+	HistoryRetentionStr       string        `json:"history_retention"`           // age of history points kept, 0 - forever
+	StoreInterval             time.Duration // interval for stor
+	AlertInterval             time.Duration // interval for alert rules evaluation
+	StatsDAggregationInterval time.Duration // StatsD samples aggregation window
+	StatsDFlushInterval       time.Duration // interval for writing StatsD aggregates to storage
+	GrafanaInterval           time.Duration // interval for recording samples served to Grafana
+	HistoryRetention          time.Duration // age of history points kept, history is kept forever if 0
+	MaxBodySize               int64         `json:"max_body_size"`         // max request body in bytes as sent, no limit if 0
+	MaxDecompressedSize       int64         `json:"max_decompressed_size"` // max request body in bytes after decompression and gRPC message, no limit if 0
+	GrafanaSamples            int           `json:"grafana_samples"`       // recent samples kept per metric for Grafana, recording is off if 0
+	MaxBatchSize              int           `json:"max_batch_size"`        // max metrics in batch update, no limit if 0
+	Restore                   bool          `json:"restore"`               // need restore
 }
 
 func DefaultConfig() Config {
 	return Config{
-		RunOnServerAddress: "localhost:8080",
-		StoreInterval:      300 * time.Second,
-		FileStoragePath:    "",
-		Restore:            false,
-		DatabaseDSN:        "",
-		KeyForSigning:      "",
-		CryptoKey:          "",
-		ConfigFile:         "",
+		RunOnServerAddress:        "localhost:8080",
+		StoreInterval:             300 * time.Second,
+		AlertInterval:             10 * time.Second,
+		StatsDAggregationInterval: 10 * time.Second,
+		StatsDFlushInterval:       10 * time.Second,
+		GrafanaInterval:           10 * time.Second,
+		GrafanaSamples:            360,
+		HistoryRetention:          7 * 24 * time.Hour,
+		MaxBodySize:               router.DefaultBodyLimits.MaxBodySize,
+		MaxDecompressedSize:       router.DefaultBodyLimits.MaxDecompressedSize,
+		MaxBatchSize:              router.DefaultBodyLimits.MaxBatchSize,
+		FileStoragePath:           "",
+		Restore:                   false,
+		DatabaseDSN:               "",
+		KeyForSigning:             "",
+		CryptoKey:                 "",
+		ConfigFile:                "",
 	}
 }
 
@@ -61,12 +93,29 @@ func (c *Config) flags() {
 	i := flag.Int("i", 300, "period for local saving. 0 - sync save")
 	flag.StringVar(&c.FileStoragePath, "f", c.FileStoragePath, "path to file for saves")
 	flag.BoolVar(&c.Restore, "r", c.Restore, "restore save on start")
-	flag.StringVar(&c.DatabaseDSN, "d", c.DatabaseDSN, "database connection string")
+	flag.StringVar(&c.DatabaseDSN, "d", c.DatabaseDSN, "database connection string (sqlite://path for embedded SQLite)")
 	flag.StringVar(&c.KeyForSigning, "k", c.KeyForSigning, "key for signing")
 	flag.StringVar(&c.CryptoKey, "crypto-key", c.CryptoKey, "key for decryption")
 	flag.StringVar(&c.ConfigFile, "c", c.ConfigFile, "json config")
 	flag.StringVar(&c.TrustedSubnet, "t", c.TrustedSubnet, "trusted subnet in CIDR format")
 	flag.StringVar(&c.GRPCPort, "grpc-port", c.GRPCPort, "gRPC server port")
+	flag.StringVar(&c.AlertRulesFile, "alert-rules", c.AlertRulesFile, "json file with alert rules")
+	ai := flag.Int("alert-interval", 10, "period of alert rules evaluation in seconds")
+	flag.StringVar(&c.NotifyURLs, "notify-urls", c.NotifyURLs, "comma separated webhook urls for operational events")
+	flag.StringVar(&c.StatsDPort, "statsd-port", c.StatsDPort, "StatsD UDP/TCP port")
+	sai := flag.Int("statsd-aggregation-interval", 10, "StatsD samples aggregation window in seconds")
+	sfi := flag.Int("statsd-flush-interval", 10, "period of writing StatsD aggregates to storage in seconds")
+	flag.StringVar(&c.GraphitePort, "graphite-port", c.GraphitePort, "Graphite plaintext TCP port")
+	gi := flag.Int("grafana-interval", 10, "period of recording samples served to Grafana in seconds")
+	hr := flag.Int("history-retention", int(c.HistoryRetention.Seconds()), "age of kept history points in seconds, 0 - forever")
+	flag.IntVar(&c.GrafanaSamples, "grafana-samples", c.GrafanaSamples, "recent samples kept per metric for Grafana, 0 - off")
+	flag.Int64Var(&c.MaxBodySize, "max-body-size", c.MaxBodySize, "max request body in bytes as sent, 0 - no limit")
+	flag.Int64Var(&c.MaxDecompressedSize, "max-decompressed-size", c.MaxDecompressedSize, "max request body in bytes after decompression and max gRPC message, 0 - no limit")
+	flag.IntVar(&c.MaxBatchSize, "max-batch-size", c.MaxBatchSize, "max metrics in batch update, 0 - no limit")
+	flag.StringVar(&c.RateLimits, "rate-limits", c.RateLimits, "per client rate limits of HTTP path or gRPC method prefixes, e.g. /=100:200,/updates/=5")
+	flag.StringVar(&c.RateLimitProxies, "rate-limit-proxies", c.RateLimitProxies, "comma separated CIDRs of proxies trusted to set X-Real-IP for rate limits, e.g. 10.0.0.0/8")
+	flag.StringVar(&c.InfluxTemplate, "influx-template", c.InfluxTemplate, "metric naming template for InfluxDB line protocol, e.g. {measurement}.{tags}.{field}")
+	flag.StringVar(&c.InfluxCounters, "influx-counters", c.InfluxCounters, "comma separated globs of measurement.field of integer InfluxDB fields stored as counters, e.g. net.bytes_*,*_total")
 
 	flag.Parse()
 
@@ -76,20 +125,42 @@ func (c *Config) flags() {
 	}
 
 	c.StoreInterval = time.Duration(*i) * time.Second
+	c.AlertInterval = time.Duration(*ai) * time.Second
+	c.StatsDAggregationInterval = time.Duration(*sai) * time.Second
+	c.StatsDFlushInterval = time.Duration(*sfi) * time.Second
+	c.GrafanaInterval = time.Duration(*gi) * time.Second
+	c.HistoryRetention = time.Duration(*hr) * time.Second
 }
 
 func (c *Config) envs() {
 	var configEnv struct {
-		Restore         *bool  `env:"RESTORE"`
-		FileStoragePath string `env:"FILE_STORAGE_PATH"`
-		DatabaseDSN     string `env:"DATABASE_DSN"`
-		Address         string `env:"ADDRESS"`
-		KeyForSigning   string `env:"KEY"`
-		CryptoKey       string `env:"CRYPTO_KEY"`
-		ConfigFile      string `env:"CONFIG"`
-		TrustedSubnet   string `env:"TRUSTED_SUBNET"`
-		GRPCPort        string `env:"GRPC_PORT"`
-		StoreInterval   int32  `env:"STORE_INTERVAL"`
+		Restore                   *bool  `env:"RESTORE"`
+		GrafanaSamples            *int   `env:"GRAFANA_SAMPLES"`
+		MaxBodySize               *int64 `env:"MAX_BODY_SIZE"`
+		MaxDecompressedSize       *int64 `env:"MAX_DECOMPRESSED_SIZE"`
+		MaxBatchSize              *int   `env:"MAX_BATCH_SIZE"`
+		HistoryRetention          *int32 `env:"HISTORY_RETENTION"`
+		FileStoragePath           string `env:"FILE_STORAGE_PATH"`
+		DatabaseDSN               string `env:"DATABASE_DSN"`
+		Address                   string `env:"ADDRESS"`
+		KeyForSigning             string `env:"KEY"`
+		CryptoKey                 string `env:"CRYPTO_KEY"`
+		ConfigFile                string `env:"CONFIG"`
+		TrustedSubnet             string `env:"TRUSTED_SUBNET"`
+		GRPCPort                  string `env:"GRPC_PORT"`
+		AlertRulesFile            string `env:"ALERT_RULES"`
+		NotifyURLs                string `env:"NOTIFY_URLS"`
+		StatsDPort                string `env:"STATSD_PORT"`
+		InfluxTemplate            string `env:"INFLUX_TEMPLATE"`
+		InfluxCounters            string `env:"INFLUX_COUNTERS"`
+		GraphitePort              string `env:"GRAPHITE_PORT"`
+		RateLimits                string `env:"RATE_LIMITS"`
+		RateLimitProxies          string `env:"RATE_LIMIT_PROXIES"`
+		StoreInterval             int32  `env:"STORE_INTERVAL"`
+		AlertInterval             int32  `env:"ALERT_INTERVAL"`
+		StatsDAggregationInterval int32  `env:"STATSD_AGGREGATION_INTERVAL"`
+		StatsDFlushInterval       int32  `env:"STATSD_FLUSH_INTERVAL"`
+		GrafanaInterval           int32  `env:"GRAFANA_INTERVAL"`
 	}
 
 	err := env.Parse(&configEnv)
@@ -127,6 +198,57 @@ func (c *Config) envs() {
 	if configEnv.GRPCPort != "" {
 		c.GRPCPort = configEnv.GRPCPort
 	}
+	if configEnv.AlertRulesFile != "" {
+		c.AlertRulesFile = configEnv.AlertRulesFile
+	}
+	if configEnv.NotifyURLs != "" {
+		c.NotifyURLs = configEnv.NotifyURLs
+	}
+	if configEnv.AlertInterval != 0 {
+		c.AlertInterval = time.Duration(configEnv.AlertInterval) * time.Second
+	}
+	if configEnv.StatsDPort != "" {
+		c.StatsDPort = configEnv.StatsDPort
+	}
+	if configEnv.InfluxTemplate != "" {
+		c.InfluxTemplate = configEnv.InfluxTemplate
+	}
+	if configEnv.InfluxCounters != "" {
+		c.InfluxCounters = configEnv.InfluxCounters
+	}
+	if configEnv.GraphitePort != "" {
+		c.GraphitePort = configEnv.GraphitePort
+	}
+	if configEnv.RateLimits != "" {
+		c.RateLimits = configEnv.RateLimits
+	}
+	if configEnv.RateLimitProxies != "" {
+		c.RateLimitProxies = configEnv.RateLimitProxies
+	}
+	if configEnv.StatsDAggregationInterval != 0 {
+		c.StatsDAggregationInterval = time.Duration(configEnv.StatsDAggregationInterval) * time.Second
+	}
+	if configEnv.StatsDFlushInterval != 0 {
+		c.StatsDFlushInterval = time.Duration(configEnv.StatsDFlushInterval) * time.Second
+	}
+	if configEnv.GrafanaInterval != 0 {
+		c.GrafanaInterval = time.Duration(configEnv.GrafanaInterval) * time.Second
+	}
+	if configEnv.GrafanaSamples != nil {
+		c.GrafanaSamples = *configEnv.GrafanaSamples
+	}
+	if configEnv.HistoryRetention != nil {
+		c.HistoryRetention = time.Duration(*configEnv.HistoryRetention) * time.Second
+	}
+	if configEnv.MaxBodySize != nil {
+		c.MaxBodySize = *configEnv.MaxBodySize
+	}
+	if configEnv.MaxDecompressedSize != nil {
+		c.MaxDecompressedSize = *configEnv.MaxDecompressedSize
+	}
+	if configEnv.MaxBatchSize != nil {
+		c.MaxBatchSize = *configEnv.MaxBatchSize
+	}
 }
 
 func (c *Config) jsonConfig() {
@@ -146,6 +268,16 @@ func (c *Config) jsonConfig() {
 		models.Log.Error(fmt.Sprintf("parse config file error: %v", err))
 		return
 	}
+	// limits are pointers to tell 0 (no limit) from absent key
+	var limits struct {
+		MaxBodySize         *int64 `json:"max_body_size"`
+		MaxDecompressedSize *int64 `json:"max_decompressed_size"`
+		MaxBatchSize        *int   `json:"max_batch_size"`
+	}
+	if err = json.Unmarshal(d, &limits); err != nil {
+		models.Log.Error(fmt.Sprintf("parse config file error: %v", err))
+		return
+	}
 
 	defConfig := DefaultConfig()
 	if c.RunOnServerAddress == defConfig.RunOnServerAddress {
@@ -169,4 +301,64 @@ func (c *Config) jsonConfig() {
 	if c.GRPCPort == "" {
 		c.GRPCPort = parsed.GRPCPort
 	}
+	if c.AlertRulesFile == defConfig.AlertRulesFile {
+		c.AlertRulesFile = parsed.AlertRulesFile
+	}
+	if c.NotifyURLs == defConfig.NotifyURLs {
+		c.NotifyURLs = parsed.NotifyURLs
+	}
+	if c.AlertInterval == defConfig.AlertInterval && parsed.AlertIntervalStr != "" {
+		utils.TryParseDuration(&c.AlertInterval, parsed.AlertIntervalStr)
+	}
+	if c.StatsDPort == "" {
+		c.StatsDPort = parsed.StatsDPort
+	}
+	if c.InfluxTemplate == defConfig.InfluxTemplate {
+		c.InfluxTemplate = parsed.InfluxTemplate
+	}
+	if c.InfluxCounters == defConfig.InfluxCounters {
+		c.InfluxCounters = parsed.InfluxCounters
+	}
+	if c.GraphitePort == "" {
+		c.GraphitePort = parsed.GraphitePort
+	}
+	if c.RateLimits == defConfig.RateLimits {
+		c.RateLimits = parsed.RateLimits
+	}
+	if c.RateLimitProxies == "" {
+		c.RateLimitProxies = parsed.RateLimitProxies
+	}
+	if c.StatsDAggregationInterval == defConfig.StatsDAggregationInterval && parsed.StatsDAggregationStr != "" {
+		utils.TryParseDuration(&c.StatsDAggregationInterval, parsed.StatsDAggregationStr)
+	}
+	if c.StatsDFlushInterval == defConfig.StatsDFlushInterval && parsed.StatsDFlushStr != "" {
+		utils.TryParseDuration(&c.StatsDFlushInterval, parsed.StatsDFlushStr)
+	}
+	if c.GrafanaInterval == defConfig.GrafanaInterval && parsed.GrafanaIntervalStr != "" {
+		utils.TryParseDuration(&c.GrafanaInterval, parsed.GrafanaIntervalStr)
+	}
+	if c.HistoryRetention == defConfig.HistoryRetention && parsed.HistoryRetentionStr != "" {
+		utils.TryParseDuration(&c.HistoryRetention, parsed.HistoryRetentionStr)
+	}
+	if c.GrafanaSamples == defConfig.GrafanaSamples && parsed.GrafanaSamples != 0 {
+		c.GrafanaSamples = parsed.GrafanaSamples
+	}
+	if c.MaxBodySize == defConfig.MaxBodySize && limits.MaxBodySize != nil {
+		c.MaxBodySize = *limits.MaxBodySize
+	}
+	if c.MaxDecompressedSize == defConfig.MaxDecompressedSize && limits.MaxDecompressedSize != nil {
+		c.MaxDecompressedSize = *limits.MaxDecompressedSize
+	}
+	if c.MaxBatchSize == defConfig.MaxBatchSize && limits.MaxBatchSize != nil {
+		c.MaxBatchSize = *limits.MaxBatchSize
+	}
+}
+
+// BodyLimits request size limits of HTTP and gRPC APIs
+func (c *Config) BodyLimits() router.BodyLimits {
+	return router.BodyLimits{
+		MaxBodySize:         c.MaxBodySize,
+		MaxDecompressedSize: c.MaxDecompressedSize,
+		MaxBatchSize:        c.MaxBatchSize,
+	}
 }
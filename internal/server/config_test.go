@@ -0,0 +1,66 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfig_JSONBodyLimits тестирует чтение ограничений размера запроса из json конфигурации
+func TestConfig_JSONBodyLimits(t *testing.T) {
+	def := DefaultConfig()
+	tests := []struct {
+		set   func(c *Config)
+		check func(t *testing.T, c Config)
+		name  string
+		json  string
+	}{
+		{
+			name: "zero disables limits",
+			json: `{"max_body_size": 0, "max_decompressed_size": 0, "max_batch_size": 0}`,
+			check: func(t *testing.T, c Config) {
+				assert.Zero(t, c.MaxBodySize)
+				assert.Zero(t, c.MaxDecompressedSize)
+				assert.Zero(t, c.MaxBatchSize)
+			},
+		},
+		{
+			name: "absent keys keep defaults",
+			json: `{"address": "localhost:9090"}`,
+			check: func(t *testing.T, c Config) {
+				assert.Equal(t, def.MaxBodySize, c.MaxBodySize)
+				assert.Equal(t, def.MaxDecompressedSize, c.MaxDecompressedSize)
+				assert.Equal(t, def.MaxBatchSize, c.MaxBatchSize)
+			},
+		},
+		{
+			name: "flag wins over file",
+			json: `{"max_body_size": 100, "max_batch_size": 0}`,
+			set: func(c *Config) {
+				c.MaxBodySize = 200
+			},
+			check: func(t *testing.T, c Config) {
+				assert.Equal(t, int64(200), c.MaxBodySize)
+				assert.Equal(t, def.MaxDecompressedSize, c.MaxDecompressedSize)
+				assert.Zero(t, c.MaxBatchSize)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.json")
+			require.NoError(t, os.WriteFile(file, []byte(tt.json), 0o600))
+
+			c := DefaultConfig()
+			c.ConfigFile = file
+			if tt.set != nil {
+				tt.set(&c)
+			}
+			c.jsonConfig()
+			tt.check(t, c)
+		})
+	}
+}
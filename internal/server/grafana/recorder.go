@@ -0,0 +1,137 @@
+// Package grafana recent samples of metrics for Grafana JSON datasource
+package grafana
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// Sample value of metric at moment of recording
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// ring keeps the last len(samples) samples, next is position of the oldest one once ring is full
+type ring struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func (r *ring) add(s Sample) {
+	r.samples[r.next] = s
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// between samples in [from, to] from the oldest to the newest
+func (r *ring) between(from time.Time, to time.Time) []Sample {
+	ordered := r.samples[:r.next]
+	if r.full {
+		ordered = append(append(make([]Sample, 0, len(r.samples)), r.samples[r.next:]...), r.samples[:r.next]...)
+	}
+	result := []Sample{}
+	for _, s := range ordered {
+		if !s.Time.Before(from) && !s.Time.After(to) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Recorder samples gauges and counters of storage and keeps a bounded ring of recent samples per metric.
+// Histograms aren't recorded. Metrics deleted from storage are forgotten on next recording.
+type Recorder struct {
+	storage repositories.Storage
+	rings   map[string]*ring // by type and series key
+	size    int
+	mu      sync.RWMutex
+}
+
+// NewRecorder recorder keeping size samples per metric, nothing is recorded until Record or Run
+func NewRecorder(storage repositories.Storage, size int) *Recorder {
+	return &Recorder{
+		storage: storage,
+		size:    size,
+		rings:   map[string]*ring{},
+	}
+}
+
+// Run records samples every interval until ctx is done
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := r.Record(ctx, now); err != nil {
+				models.Log.Error(fmt.Sprintf("Grafana samples recording error: %v", err))
+			}
+		}
+	}
+}
+
+// Record adds current value of every metric as sample at moment now
+func (r *Recorder) Record(ctx context.Context, now time.Time) error {
+	current := map[string]Sample{}
+	err := r.storage.EachMetric(ctx, func(m repositories.MetricDto) error {
+		if m.Type != models.Gauge && m.Type != models.Counter {
+			return nil
+		}
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil {
+			return nil
+		}
+		current[ringKey(m.Type, models.SeriesKey(m.Name, m.Labels))] = Sample{Time: now, Value: v}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.rings {
+		if _, ok := current[key]; !ok {
+			delete(r.rings, key)
+		}
+	}
+	for key, s := range current {
+		rg, ok := r.rings[key]
+		if !ok {
+			rg = &ring{samples: make([]Sample, r.size)}
+			r.rings[key] = rg
+		}
+		rg.add(s)
+	}
+	return nil
+}
+
+// Samples recorded samples of metric within [from, to] from the oldest, empty if metric isn't recorded
+func (r *Recorder) Samples(metricType string, seriesKey string, from time.Time, to time.Time) []Sample {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rg, ok := r.rings[ringKey(metricType, seriesKey)]
+	if !ok {
+		return []Sample{}
+	}
+	return rg.between(from, to)
+}
+
+func ringKey(metricType string, seriesKey string) string {
+	return metricType + "/" + seriesKey
+}
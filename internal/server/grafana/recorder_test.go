@@ -0,0 +1,43 @@
+package grafana
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// TestRecorder тестирует кольцевой буфер последних значений и забывание удалённых метрик
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	r := NewRecorder(s, 3)
+	cpu := models.SeriesKey("cpu", models.Labels{"host": "a"})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 5 {
+		require.NoError(t, s.SetGauge(ctx, cpu, float64(i)))
+		require.NoError(t, s.AddCounter(ctx, "requests", 10))
+		require.NoError(t, r.Record(ctx, start.Add(time.Duration(i)*time.Second)))
+	}
+
+	assert.Equal(t, []Sample{
+		{Time: start.Add(2 * time.Second), Value: 2},
+		{Time: start.Add(3 * time.Second), Value: 3},
+		{Time: start.Add(4 * time.Second), Value: 4},
+	}, r.Samples(models.Gauge, cpu, start, start.Add(time.Minute)), "only the last samples are kept, oldest first")
+	assert.Equal(t, []Sample{
+		{Time: start.Add(3 * time.Second), Value: 40},
+	}, r.Samples(models.Counter, "requests", start.Add(3*time.Second), start.Add(3*time.Second)))
+	assert.Empty(t, r.Samples(models.Counter, cpu, start, start.Add(time.Minute)), "type is part of metric")
+
+	require.NoError(t, s.DeleteMetric(ctx, models.Gauge, cpu))
+	require.NoError(t, r.Record(ctx, start.Add(5*time.Second)))
+	assert.Empty(t, r.Samples(models.Gauge, cpu, start, start.Add(time.Minute)))
+	assert.Len(t, r.Samples(models.Counter, "requests", start, start.Add(time.Minute)), 3)
+}
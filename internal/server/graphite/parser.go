@@ -0,0 +1,72 @@
+// Package graphite Graphite plaintext protocol parsing
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// ErrInvalidLine plaintext line can't be parsed
+var ErrInvalidLine = errors.New("invalid graphite line")
+
+// Sample one line: path[;tag=value...] value [timestamp].
+// Dotted path is used as gauge ID as is, tags become labels.
+type Sample struct {
+	Labels    models.Labels
+	Path      string
+	Value     float64
+	Timestamp int64 // unix seconds, 0 if absent or -1 (now)
+}
+
+// ParseLine parses single line, sample is validated as gauge so only storable samples are returned
+func ParseLine(line string) (Sample, error) {
+	parts := strings.Fields(line)
+	if len(parts) != 2 && len(parts) != 3 {
+		return Sample{}, fmt.Errorf("%w %q: want path value [timestamp]", ErrInvalidLine, line)
+	}
+
+	var s Sample
+	path, tags, _ := strings.Cut(parts[0], ";")
+	if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+		return Sample{}, fmt.Errorf("%w %q: bad path", ErrInvalidLine, line)
+	}
+	s.Path = path
+	if tags != "" {
+		s.Labels = models.Labels{}
+		for _, tag := range strings.Split(tags, ";") {
+			k, v, ok := strings.Cut(tag, "=")
+			if !ok || k == "" || v == "" {
+				return Sample{}, fmt.Errorf("%w %q: bad tag %q", ErrInvalidLine, line, tag)
+			}
+			s.Labels[k] = v
+		}
+		if err := s.Labels.Validate(); err != nil {
+			return Sample{}, fmt.Errorf("%w %q: %v", ErrInvalidLine, line, err)
+		}
+	}
+
+	v, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, fmt.Errorf("%w %q: bad value", ErrInvalidLine, line)
+	}
+	s.Value = v
+
+	if len(parts) == 3 && parts[2] != "-1" {
+		ts, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || ts < 0 || math.IsInf(ts, 0) {
+			return Sample{}, fmt.Errorf("%w %q: bad timestamp", ErrInvalidLine, line)
+		}
+		s.Timestamp = int64(ts)
+	}
+
+	m := models.Metrics{ID: s.Path, MType: models.Gauge, Value: &s.Value, Labels: s.Labels}
+	if err = m.Validate(); err != nil {
+		return Sample{}, fmt.Errorf("%w %q: %v", ErrInvalidLine, line, err)
+	}
+	return s, nil
+}
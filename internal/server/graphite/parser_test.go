@@ -0,0 +1,50 @@
+package graphite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// TestParseLine тестирует разбор строк протокола Graphite
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{"with timestamp", "servers.web1.cpu 42.5 1700000000", Sample{Path: "servers.web1.cpu", Value: 42.5, Timestamp: 1700000000}, false},
+		{"no timestamp", "queue.size 7", Sample{Path: "queue.size", Value: 7}, false},
+		{"now timestamp", "queue.size 7 -1", Sample{Path: "queue.size", Value: 7}, false},
+		{"float timestamp", "queue.size 7 1700000000.5", Sample{Path: "queue.size", Value: 7, Timestamp: 1700000000}, false},
+		{"tabs", "queue.size\t7\t1700000000", Sample{Path: "queue.size", Value: 7, Timestamp: 1700000000}, false},
+		{"tags", "cpu.usage;host=web1;dc=eu 3", Sample{Path: "cpu.usage", Value: 3, Labels: models.Labels{"host": "web1", "dc": "eu"}}, false},
+		{"no value", "queue.size", Sample{}, true},
+		{"bad value", "queue.size x", Sample{}, true},
+		{"nan", "queue.size nan", Sample{}, true},
+		{"bad timestamp", "queue.size 7 yesterday", Sample{}, true},
+		{"extra field", "queue.size 7 1700000000 1", Sample{}, true},
+		{"empty segment", "queue..size 7", Sample{}, true},
+		{"bad tag", "cpu.usage;host 3", Sample{}, true},
+		{"bad tag name", "cpu.usage;host-name=web1 3", Sample{}, true},
+		{"bad path char", "servers.web*.cpu 3", Sample{}, true},
+		{"long path", "a" + strings.Repeat(".b", models.MaxMetricNameLength) + " 3", Sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
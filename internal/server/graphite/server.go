@@ -0,0 +1,174 @@
+// Package graphite TCP listener
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+const (
+	maxLineSize  = 65536
+	maxBatch     = 1000
+	flushTimeout = 5 * time.Second
+)
+
+// Server receives Graphite plaintext lines over TCP and stores them as gauges.
+// Lines read so far are written in one transaction once connection has nothing more buffered.
+type Server struct {
+	storage repositories.Storage
+	allow   func(net.Addr) bool
+	ln      net.Listener
+	conns   map[net.Conn]struct{}
+	readers sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// Listen opens TCP listener on addr, nothing is read until Run.
+// Connections from peers for which allow returns false are closed at once, nil allow accepts everyone.
+func Listen(addr string, storage repositories.Storage, allow func(net.Addr) bool) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		storage: storage,
+		allow:   allow,
+		ln:      ln,
+		conns:   map[net.Conn]struct{}{},
+	}, nil
+}
+
+// Addr address of listener
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Run starts accepting connections in background till Close
+func (s *Server) Run() {
+	s.readers.Add(1)
+	go s.serve()
+}
+
+// Close stops listener and writes lines received so far to storage
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.readers.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.readers.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				models.Log.Error(fmt.Sprintf("Graphite accept error: %v", err))
+			}
+			return
+		}
+		if s.allow != nil && !s.allow(conn.RemoteAddr()) {
+			models.Log.Warn(fmt.Sprintf("Graphite connection from %s rejected: not in trusted subnet", conn.RemoteAddr()))
+			_ = conn.Close()
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.readers.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.readers.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	batch := map[string]Sample{}
+	r := bufio.NewReaderSize(conn, maxLineSize)
+	for {
+		line, err := r.ReadSlice('\n')
+		tooLong := errors.Is(err, bufio.ErrBufferFull)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = r.ReadSlice('\n')
+		}
+
+		if tooLong {
+			models.Log.Warn(fmt.Sprintf("Graphite line longer than %d bytes skipped", maxLineSize))
+		} else if line = bytes.TrimSpace(line); len(line) > 0 {
+			if sample, perr := ParseLine(string(line)); perr != nil {
+				models.Log.Warn(perr.Error())
+			} else {
+				addLatest(batch, sample)
+			}
+		}
+
+		if err != nil || r.Buffered() == 0 || len(batch) >= maxBatch {
+			s.flush(batch)
+			clear(batch)
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				models.Log.Error(fmt.Sprintf("Graphite read error: %v", err))
+			}
+			return
+		}
+	}
+}
+
+// addLatest keeps one sample per series, later line wins unless its timestamp is older
+func addLatest(batch map[string]Sample, sample Sample) {
+	key := models.SeriesKey(sample.Path, sample.Labels)
+	if prev, ok := batch[key]; ok && sample.Timestamp != 0 && sample.Timestamp < prev.Timestamp {
+		return
+	}
+	batch[key] = sample
+}
+
+func (s *Server) flush(batch map[string]Sample) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := s.write(ctx, batch); err != nil {
+		models.Log.Error(fmt.Sprintf("Graphite write error, %d samples dropped: %v", len(batch), err))
+	}
+}
+
+func (s *Server) write(ctx context.Context, batch map[string]Sample) error {
+	tx, err := s.storage.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for key, sample := range batch {
+		if err = tx.SetGauge(ctx, key, sample.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,74 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// TestServer тестирует приём нескольких строк за одно соединение
+func TestServer(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv, err := Listen("127.0.0.1:0", s, nil)
+	require.NoError(t, err)
+	srv.Run()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(conn, "servers.web1.cpu 10 1700000010\nbroken\nservers.web?.cpu 1\nservers.web1.cpu 5 1700000000\nqueue.size 3\ncpu;host=web1 1.5\n")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.Eventually(t, func() bool {
+		_, err := s.GetGauge(ctx, models.SeriesKey("cpu", models.Labels{"host": "web1"}))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	cpu, err := s.GetGauge(ctx, "servers.web1.cpu")
+	require.NoError(t, err)
+	assert.InDelta(t, 10, cpu, 1e-9, "older line must not overwrite newer one")
+	queue, err := s.GetGauge(ctx, "queue.size")
+	require.NoError(t, err)
+	assert.InDelta(t, 3, queue, 1e-9)
+	_, err = s.GetGauge(ctx, "servers.web?.cpu")
+	assert.Error(t, err, "invalid line is dropped, the rest of batch is stored")
+
+	// строка без перевода строки записывается при закрытии соединения клиентом
+	_, err = fmt.Fprint(conn, "queue.size 4")
+	require.NoError(t, err)
+	conn.Close()
+	require.Eventually(t, func() bool {
+		queue, err = s.GetGauge(ctx, "queue.size")
+		return err == nil && queue == 4
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, srv.Close())
+}
+
+// TestServerRejectsPeer тестирует отклонение соединений не из доверенной подсети
+func TestServerRejectsPeer(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv, err := Listen("127.0.0.1:0", s, func(net.Addr) bool { return false })
+	require.NoError(t, err)
+	srv.Run()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, _ = fmt.Fprint(conn, "queue.size 3\n")
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err, "connection must be closed by server")
+	require.NoError(t, srv.Close())
+
+	_, err = s.GetGauge(context.Background(), "queue.size")
+	assert.Error(t, err)
+}
@@ -3,34 +3,59 @@ package server
 import (
 	"context"
 	"errors"
+	"path"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/Nikolay961996/metsys/internal/server/otlp"
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/internal/server/router"
-
 	"github.com/Nikolay961996/metsys/models"
 	"github.com/Nikolay961996/metsys/proto"
 )
 
 type MetricsServiceServer struct {
 	proto.UnimplementedMetricsServiceServer
-	Storage repositories.Storage
+	Storage      repositories.Storage
+	MaxBatchSize int // max metrics in BatchUpdateMetrics, no limit if 0
+}
+
+// OTLPMetricsServer OpenTelemetry metrics service (OTLP/gRPC)
+type OTLPMetricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	Receiver *otlp.Receiver
+}
+
+func (s *OTLPMetricsServer) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	resp, err := s.Receiver.Write(ctx, req)
+	if err != nil {
+		return nil, statusError(err, "")
+	}
+	return resp, nil
 }
 
 func (s *MetricsServiceServer) GetMetric(ctx context.Context, req *proto.MetricRequest) (*proto.MetricResponse, error) {
 	metric := &models.Metrics{
-		ID:    req.Id,
-		MType: req.Type,
+		ID:     req.Id,
+		MType:  req.Type,
+		Labels: req.Labels,
 	}
 
-	actualMetric, err := router.GetActualMetrics(s.Storage, metric)
+	actualMetric, err := router.GetActualMetrics(ctx, s.Storage, metric)
 	if err != nil {
-		return nil, err
+		return nil, statusError(err, req.Id)
 	}
 
 	response := &proto.MetricResponse{
-		Id:    actualMetric.ID,
-		Type:  actualMetric.MType,
-		Value: 0,
-		Delta: 0,
+		Id:     actualMetric.ID,
+		Type:   actualMetric.MType,
+		Labels: actualMetric.Labels,
+		Value:  0,
+		Delta:  0,
 	}
 
 	if actualMetric.Value != nil {
@@ -39,69 +64,217 @@ func (s *MetricsServiceServer) GetMetric(ctx context.Context, req *proto.MetricR
 	if actualMetric.Delta != nil {
 		response.Delta = *actualMetric.Delta
 	}
+	if actualMetric.Histogram != nil {
+		response.Histogram = histogramToProto(*actualMetric.Histogram)
+	}
 
 	return response, nil
 }
 
 func (s *MetricsServiceServer) UpdateMetric(ctx context.Context, req *proto.MetricUpdateRequest) (*proto.MetricResponse, error) {
-	metric := &models.Metrics{
-		ID:    req.Id,
-		MType: req.Type,
-		Value: &req.Value,
-		Delta: &req.Delta,
-	}
-
-	if metric.MType == models.Gauge {
-		s.Storage.SetGauge(metric.ID, *metric.Value)
-	} else if metric.MType == models.Counter {
-		s.Storage.AddCounter(metric.ID, *metric.Delta)
-	} else {
-		return nil, errors.New("undefined metric type")
+	metric := metricFromProto(req)
+	if err := router.StoreMetric(ctx, s.Storage, metric); err != nil {
+		return nil, statusError(err, req.Id)
 	}
 
 	return &proto.MetricResponse{
-		Id:    metric.ID,
-		Type:  metric.MType,
-		Value: req.Value,
-		Delta: req.Delta,
+		Id:        metric.ID,
+		Type:      metric.MType,
+		Value:     req.GetValue(),
+		Delta:     req.GetDelta(),
+		Histogram: req.Histogram,
+		Labels:    req.Labels,
 	}, nil
 }
 
+// BatchUpdateMetrics stores batch and reports outcome of every metric.
+// Failed batch is returned as status error with results attached as BatchMetricUpdateResponse detail.
 func (s *MetricsServiceServer) BatchUpdateMetrics(ctx context.Context, req *proto.BatchMetricUpdateRequest) (*proto.BatchMetricUpdateResponse, error) {
-	err := s.Storage.StartTransaction(ctx)
-	if err != nil {
-		return nil, err
+	if err := router.CheckBatchSize(len(req.Metrics), s.MaxBatchSize); err != nil {
+		return nil, statusError(err, "")
+	}
+	metrics := make([]models.Metrics, len(req.Metrics))
+	for i, metricReq := range req.Metrics {
+		metrics[i] = *metricFromProto(metricReq)
 	}
 
-	responses := []*proto.MetricResponse{}
-	for _, metricReq := range req.Metrics {
-		metric := &models.Metrics{
-			ID:    metricReq.Id,
-			MType: metricReq.Type,
-			Value: &metricReq.Value,
-			Delta: &metricReq.Delta,
+	results, err := router.UpdateBatch(ctx, s.Storage, metrics, !req.BestEffort)
+	if err != nil {
+		st := apiStatus(err, "")
+		if detailed, dErr := st.WithDetails(&proto.BatchMetricUpdateResponse{Results: resultsToProto(results)}); dErr == nil {
+			st = detailed
 		}
+		return nil, st.Err()
+	}
 
-		if metric.MType == models.Gauge {
-			s.Storage.SetGauge(metric.ID, *metric.Value)
-		} else if metric.MType == models.Counter {
-			s.Storage.AddCounter(metric.ID, *metric.Delta)
-		} else {
-			return nil, errors.New("undefined metric type")
+	responses := []*proto.MetricResponse{}
+	for i, metricReq := range req.Metrics {
+		if results[i].Status != models.UpdateStored {
+			continue
 		}
-
 		responses = append(responses, &proto.MetricResponse{
-			Id:    metric.ID,
-			Type:  metric.MType,
-			Value: metricReq.Value,
-			Delta: metricReq.Delta,
+			Id:        metricReq.Id,
+			Type:      metricReq.Type,
+			Value:     metricReq.GetValue(),
+			Delta:     metricReq.GetDelta(),
+			Histogram: metricReq.Histogram,
+			Labels:    metricReq.Labels,
 		})
 	}
 
-	err = s.Storage.CommitTransaction()
+	return &proto.BatchMetricUpdateResponse{Metrics: responses, Results: resultsToProto(results)}, nil
+}
+
+func (s *MetricsServiceServer) DeleteMetric(ctx context.Context, req *proto.MetricRequest) (*proto.DeleteMetricsResponse, error) {
+	labels := models.Labels(req.Labels)
+	if err := labels.Validate(); err != nil {
+		return nil, statusError(err, req.Id)
+	}
+	err := s.Storage.DeleteMetric(ctx, req.Type, models.SeriesKey(req.Id, labels))
+	if err != nil {
+		return nil, statusError(err, req.Id)
+	}
+	return &proto.DeleteMetricsResponse{Deleted: 1}, nil
+}
+
+func (s *MetricsServiceServer) DeleteMetrics(ctx context.Context, req *proto.DeleteMetricsRequest) (*proto.DeleteMetricsResponse, error) {
+	deleted, err := s.Storage.DeleteMetrics(ctx, req.Pattern)
+	if errors.Is(err, path.ErrBadPattern) {
+		return nil, statusError(models.NewAPIError(models.ErrCodeInvalidRequest, "", "invalid pattern %q: %w", req.Pattern, err), "")
+	}
+	if err != nil {
+		return nil, statusError(err, "")
+	}
+	return &proto.DeleteMetricsResponse{Deleted: int64(deleted)}, nil
+}
+
+func (s *MetricsServiceServer) ResetCounter(ctx context.Context, req *proto.ResetCounterRequest) (*proto.MetricResponse, error) {
+	labels := models.Labels(req.Labels)
+	if err := labels.Validate(); err != nil {
+		return nil, statusError(err, req.Id)
+	}
+	err := s.Storage.ResetCounter(ctx, models.SeriesKey(req.Id, labels))
 	if err != nil {
-		return nil, err
+		return nil, statusError(err, req.Id)
+	}
+	return &proto.MetricResponse{
+		Id:     req.Id,
+		Type:   models.Counter,
+		Labels: req.Labels,
+		Delta:  0,
+	}, nil
+}
+
+// metricFromProto metric with value field of its type only, missing value is left nil to be rejected by Validate
+func metricFromProto(req *proto.MetricUpdateRequest) *models.Metrics {
+	metric := &models.Metrics{
+		ID:     req.Id,
+		MType:  req.Type,
+		Labels: req.Labels,
+	}
+	switch req.Type {
+	case models.Gauge:
+		metric.Value = req.Value
+	case models.Counter:
+		metric.Delta = req.Delta
+	case models.Histogram:
+		if req.Histogram != nil {
+			h := histogramFromProto(req.Histogram)
+			metric.Histogram = &h
+		}
+	}
+	return metric
+}
+
+func resultsToProto(results []models.UpdateResult) []*proto.MetricResult {
+	pr := make([]*proto.MetricResult, len(results))
+	for i, r := range results {
+		pr[i] = &proto.MetricResult{
+			Id:     r.ID,
+			Type:   r.MType,
+			Labels: r.Labels,
+			Status: r.Status,
+			Code:   string(r.Code),
+			Reason: r.Reason,
+		}
+	}
+	return pr
+}
+
+func histogramFromProto(h *proto.Histogram) models.HistogramData {
+	return models.HistogramData{
+		Bounds: h.Bounds,
+		Counts: h.Counts,
+		Count:  h.Count,
+		Sum:    h.Sum,
 	}
+}
+
+func histogramToProto(h models.HistogramData) *proto.Histogram {
+	return &proto.Histogram{
+		Bounds: h.Bounds,
+		Counts: h.Counts,
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// errorCodeGRPC gRPC code of API error code, Internal for unknown code
+var errorCodeGRPC = map[models.ErrorCode]codes.Code{
+	models.ErrCodeNotFound:           codes.NotFound,
+	models.ErrCodeInvalidType:        codes.InvalidArgument,
+	models.ErrCodeInvalidValue:       codes.InvalidArgument,
+	models.ErrCodeInvalidName:        codes.InvalidArgument,
+	models.ErrCodeInvalidLabels:      codes.InvalidArgument,
+	models.ErrCodeInvalidRequest:     codes.InvalidArgument,
+	models.ErrCodeForbidden:          codes.PermissionDenied,
+	models.ErrCodeAborted:            codes.Aborted,
+	models.ErrCodeRateLimited:        codes.ResourceExhausted,
+	models.ErrCodeTooLarge:           codes.ResourceExhausted,
+	models.ErrCodeStorageUnavailable: codes.Unavailable,
+	models.ErrCodeInternal:           codes.Internal,
+}
+
+// statusError converts storage or validation error to gRPC status error, see apiStatus
+func statusError(err error, metric string) error {
+	return apiStatus(err, metric).Err()
+}
 
-	return &proto.BatchMetricUpdateResponse{Metrics: responses}, nil
+// apiStatus gRPC status of storage or validation error,
+// API error code and metric (named by caller if error isn't about particular one) are attached as ErrorInfo with domain metsys
+func apiStatus(err error, metric string) *status.Status {
+	code := codes.Internal
+	apiErr := router.AsAPIError(err)
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		if c, ok := errorCodeGRPC[apiErr.Code]; ok {
+			code = c
+		}
+	}
+
+	st := status.New(code, err.Error())
+	info := &errdetails.ErrorInfo{Reason: string(apiErr.Code), Domain: "metsys"}
+	if apiErr.Metric != "" {
+		metric = apiErr.Metric
+	}
+	if metric != "" {
+		info.Metadata = map[string]string{"metric": metric}
+	}
+	details := []protoadapt.MessageV1{info}
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		badRequest := &errdetails.BadRequest{}
+		for _, f := range validationErr.Fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Reason})
+		}
+		details = append(details, badRequest)
+	}
+	if detailed, dErr := st.WithDetails(details...); dErr == nil {
+		st = detailed
+	}
+	return st
 }
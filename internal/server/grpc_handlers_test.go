@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+	"github.com/Nikolay961996/metsys/proto"
+)
+
+// TestStatusError тестирует перевод ошибок API в коды gRPC с кодом ошибки в ErrorInfo
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		err    error
+		name   string
+		reason models.ErrorCode
+		code   codes.Code
+	}{
+		{repositories.ErrNotFound, "not found", models.ErrCodeNotFound, codes.NotFound},
+		{fmt.Errorf("%w: name %q", models.ErrInvalidLabels, "1x"), "labels", models.ErrCodeInvalidLabels, codes.InvalidArgument},
+		{models.NewAPIError(models.ErrCodeInvalidType, "Alloc", "undefined metric type"), "type", models.ErrCodeInvalidType, codes.InvalidArgument},
+		{fmt.Errorf("%w: connection refused", repositories.ErrUnavailable), "unavailable", models.ErrCodeStorageUnavailable, codes.Unavailable},
+		{context.Canceled, "canceled", models.ErrCodeInternal, codes.Canceled},
+		{fmt.Errorf("disk full"), "internal", models.ErrCodeInternal, codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, ok := status.FromError(statusError(tt.err, ""))
+			require.True(t, ok)
+			assert.Equal(t, tt.code, st.Code())
+			require.Len(t, st.Details(), 1)
+			info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+			require.True(t, ok)
+			assert.Equal(t, string(tt.reason), info.Reason)
+		})
+	}
+
+	srv := &MetricsServiceServer{Storage: storage.NewMemStorage()}
+	_, err := srv.UpdateMetric(context.Background(), &proto.MetricUpdateRequest{Id: "Alloc", Type: "meter"})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	_, err = srv.GetMetric(context.Background(), &proto.MetricRequest{Id: "Alloc", Type: models.Gauge})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, "Alloc", info.Metadata["metric"])
+}
+
+// TestUpdateMetricValidation тестирует отклонение некорректных метрик по gRPC с нарушениями по полям
+func TestUpdateMetricValidation(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv := &MetricsServiceServer{Storage: s}
+	ctx := context.Background()
+
+	_, err := srv.UpdateMetric(ctx, &proto.MetricUpdateRequest{Id: "Alloc", Type: models.Gauge, Value: gproto.Float64(math.NaN())})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 2)
+	badRequest, ok := st.Details()[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 1)
+	assert.Equal(t, "value", badRequest.FieldViolations[0].Field)
+
+	_, err = srv.UpdateMetric(ctx, &proto.MetricUpdateRequest{Id: "", Type: models.Histogram})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	for _, req := range []*proto.MetricUpdateRequest{
+		{Id: "Alloc", Type: models.Gauge, Delta: gproto.Int64(1)},
+		{Id: "PollCount", Type: models.Counter, Value: gproto.Float64(1)},
+	} {
+		_, err = srv.UpdateMetric(ctx, req)
+		st, _ = status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code(), "missing value of %s", req.Type)
+		badRequest, ok = st.Details()[1].(*errdetails.BadRequest)
+		require.True(t, ok)
+		assert.Contains(t, []string{"value", "delta"}, badRequest.FieldViolations[0].Field)
+	}
+	_, err = srv.BatchUpdateMetrics(ctx, &proto.BatchMetricUpdateRequest{Metrics: []*proto.MetricUpdateRequest{{Id: "Alloc", Type: models.Gauge}}})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code(), "missing value in batch")
+
+	_, err = srv.BatchUpdateMetrics(ctx, &proto.BatchMetricUpdateRequest{Metrics: []*proto.MetricUpdateRequest{
+		{Id: "PollCount", Type: models.Counter, Delta: gproto.Int64(1)},
+		{Id: "bad name", Type: models.Gauge, Value: gproto.Float64(1)},
+	}})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	_, err = s.GetCounter(ctx, "PollCount")
+	assert.ErrorIs(t, err, repositories.ErrNotFound, "batch is rolled back")
+
+	_, err = srv.UpdateMetric(ctx, &proto.MetricUpdateRequest{Id: "PollCount", Type: models.Counter, Delta: gproto.Int64(2), Value: gproto.Float64(5)})
+	require.NoError(t, err)
+	all, err := s.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "2", all[0].Value)
+
+	zero := &MetricsServiceServer{Storage: storage.NewMemStorage()}
+	_, err = zero.UpdateMetric(ctx, &proto.MetricUpdateRequest{Id: "Alloc", Type: models.Gauge, Value: gproto.Float64(0)})
+	require.NoError(t, err, "explicit zero is a value")
+	v, err := zero.Storage.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Zero(t, v)
+}
+
+// TestBatchUpdateResults тестирует результаты пакетной записи по gRPC в атомарном режиме и режиме частичной записи
+func TestBatchUpdateResults(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv := &MetricsServiceServer{Storage: s}
+	ctx := context.Background()
+	metrics := []*proto.MetricUpdateRequest{
+		{Id: "PollCount", Type: models.Counter, Delta: gproto.Int64(1)},
+		{Id: "bad name", Type: models.Gauge, Value: gproto.Float64(1)},
+	}
+
+	_, err := srv.BatchUpdateMetrics(ctx, &proto.BatchMetricUpdateRequest{Metrics: metrics})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 3)
+	batch, ok := st.Details()[2].(*proto.BatchMetricUpdateResponse)
+	require.True(t, ok)
+	require.Len(t, batch.Results, 2)
+	assert.Equal(t, string(models.ErrCodeAborted), batch.Results[0].Code)
+	assert.Equal(t, string(models.ErrCodeInvalidName), batch.Results[1].Code)
+
+	resp, err := srv.BatchUpdateMetrics(ctx, &proto.BatchMetricUpdateRequest{Metrics: metrics, BestEffort: true})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 1)
+	assert.Equal(t, "PollCount", resp.Metrics[0].Id)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, models.UpdateStored, resp.Results[0].Status)
+	assert.Equal(t, models.UpdateRejected, resp.Results[1].Status)
+	assert.NotEmpty(t, resp.Results[1].Reason)
+	d, err := s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), d)
+}
+
+// TestBatchUpdateLimit тестирует отклонение слишком длинного пакета по gRPC
+func TestBatchUpdateLimit(t *testing.T) {
+	srv := &MetricsServiceServer{Storage: storage.NewMemStorage(), MaxBatchSize: 1}
+	_, err := srv.BatchUpdateMetrics(context.Background(), &proto.BatchMetricUpdateRequest{Metrics: []*proto.MetricUpdateRequest{
+		{Id: "Alloc", Type: models.Gauge, Value: gproto.Float64(1)},
+		{Id: "Sys", Type: models.Gauge, Value: gproto.Float64(2)},
+	}})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, string(models.ErrCodeTooLarge), info.Reason)
+}
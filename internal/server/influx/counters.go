@@ -0,0 +1,48 @@
+// Package influx selection of integer fields stored as counters
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DefaultCounters integer fields with _total suffix are counters, other integer fields are gauges
+const DefaultCounters = "*_total"
+
+// ErrInvalidCounters counter field patterns are malformed
+var ErrInvalidCounters = errors.New("invalid counter fields")
+
+// Counters integer fields stored as counters keeping sender value.
+// Patterns are comma separated globs (path.Match) of measurement.field, e.g. net.bytes_*,*_total.
+type Counters struct {
+	patterns []string
+}
+
+// NewCounters parses comma separated patterns, empty string matches nothing
+func NewCounters(s string) (Counters, error) {
+	var c Counters
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return Counters{}, fmt.Errorf("%w %q: %v", ErrInvalidCounters, p, err)
+		}
+		c.patterns = append(c.patterns, p)
+	}
+	return c, nil
+}
+
+// Match true if field of measurement is a counter
+func (c Counters) Match(measurement string, field string) bool {
+	name := measurement + "." + field
+	for _, p := range c.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
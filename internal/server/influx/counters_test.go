@@ -0,0 +1,30 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCounters тестирует выбор целочисленных полей, сохраняемых счётчиками
+func TestCounters(t *testing.T) {
+	def, err := NewCounters(DefaultCounters)
+	require.NoError(t, err)
+	assert.True(t, def.Match("http", "requests_total"))
+	assert.False(t, def.Match("mem", "free"))
+	assert.False(t, def.Match("system", "procs"))
+
+	c, err := NewCounters("net.bytes_*, *_total")
+	require.NoError(t, err)
+	assert.True(t, c.Match("net", "bytes_recv"))
+	assert.True(t, c.Match("nginx", "requests_total"))
+	assert.False(t, c.Match("netstat", "bytes_recv"))
+
+	none, err := NewCounters("")
+	require.NoError(t, err)
+	assert.False(t, none.Match("http", "requests_total"))
+
+	_, err = NewCounters("net.[bytes")
+	assert.ErrorIs(t, err, ErrInvalidCounters)
+}
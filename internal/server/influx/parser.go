@@ -0,0 +1,169 @@
+// Package influx InfluxDB line protocol parsing
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLine line protocol line can't be parsed
+var ErrInvalidLine = errors.New("invalid line protocol")
+
+// FieldType type of field value
+type FieldType int
+
+const (
+	Float FieldType = iota
+	Integer
+	Unsigned
+	Boolean
+	String
+)
+
+// Field one field of point, Value is set for all types but String
+type Field struct {
+	Key   string
+	Str   string
+	Value float64
+	Type  FieldType
+}
+
+// Point one line: measurement[,tag=value...] field=value[,field=value...] [timestamp]
+type Point struct {
+	Tags        map[string]string
+	Measurement string
+	Fields      []Field
+	Timestamp   int64 // 0 if absent
+}
+
+// ParseLines parses newline separated points, empty lines and comments are skipped
+func ParseLines(body string) ([]Point, error) {
+	var points []Point
+	for n, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// ParseLine parses single point
+func ParseLine(line string) (Point, error) {
+	p := Point{Tags: map[string]string{}}
+
+	var i int
+	p.Measurement, i = scanToken(line, 0, ", ")
+	if p.Measurement == "" {
+		return Point{}, fmt.Errorf("%w %q: no measurement", ErrInvalidLine, line)
+	}
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scanToken(line, i+1, "=, ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return Point{}, fmt.Errorf("%w %q: bad tag", ErrInvalidLine, line)
+		}
+		value, i = scanToken(line, i+1, ", ")
+		if value == "" {
+			return Point{}, fmt.Errorf("%w %q: empty tag %s", ErrInvalidLine, line, key)
+		}
+		p.Tags[key] = value
+	}
+
+	if i >= len(line) || line[i] != ' ' {
+		return Point{}, fmt.Errorf("%w %q: no fields", ErrInvalidLine, line)
+	}
+	for {
+		var f Field
+		var err error
+		f.Key, i = scanToken(line, i+1, "=, ")
+		if i >= len(line) || line[i] != '=' || f.Key == "" {
+			return Point{}, fmt.Errorf("%w %q: bad field", ErrInvalidLine, line)
+		}
+		if f, i, err = scanFieldValue(line, i+1, f); err != nil {
+			return Point{}, fmt.Errorf("%w %q: field %s: %v", ErrInvalidLine, line, f.Key, err)
+		}
+		p.Fields = append(p.Fields, f)
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+	}
+
+	if rest := strings.TrimSpace(line[i:]); rest != "" {
+		ts, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("%w %q: bad timestamp", ErrInvalidLine, line)
+		}
+		p.Timestamp = ts
+	}
+	return p, nil
+}
+
+// scanToken reads from i until unescaped stop char, backslash escapes stop chars and itself
+func scanToken(line string, i int, stops string) (string, int) {
+	var b strings.Builder
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && (line[i+1] == '\\' || strings.IndexByte(stops, line[i+1]) >= 0) {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), i
+}
+
+func scanFieldValue(line string, i int, f Field) (Field, int, error) {
+	if i < len(line) && line[i] == '"' {
+		var b strings.Builder
+		for i++; i < len(line); i++ {
+			c := line[i]
+			if c == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+				i++
+				b.WriteByte(line[i])
+				continue
+			}
+			if c == '"' {
+				f.Type, f.Str = String, b.String()
+				return f, i + 1, nil
+			}
+			b.WriteByte(c)
+		}
+		return f, i, errors.New("unterminated string")
+	}
+
+	raw, next := scanToken(line, i, ", ")
+	var err error
+	switch {
+	case raw == "":
+		err = errors.New("empty value")
+	case raw == "t" || raw == "T" || raw == "true" || raw == "True" || raw == "TRUE":
+		f.Type, f.Value = Boolean, 1
+	case raw == "f" || raw == "F" || raw == "false" || raw == "False" || raw == "FALSE":
+		f.Type, f.Value = Boolean, 0
+	case strings.HasSuffix(raw, "i"):
+		var v int64
+		v, err = strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		f.Type, f.Value = Integer, float64(v)
+	case strings.HasSuffix(raw, "u"):
+		var v uint64
+		v, err = strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		f.Type, f.Value = Unsigned, float64(v)
+	default:
+		f.Type = Float
+		f.Value, err = strconv.ParseFloat(raw, 64)
+	}
+	return f, next, err
+}
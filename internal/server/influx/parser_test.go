@@ -0,0 +1,83 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseLine тестирует разбор строк line protocol
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "telegraf cpu",
+			line: "cpu,cpu=cpu-total,host=srv1 usage_idle=97.5,usage_user=1.25 1700000000000000000",
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"cpu": "cpu-total", "host": "srv1"},
+				Fields: []Field{
+					{Key: "usage_idle", Type: Float, Value: 97.5},
+					{Key: "usage_user", Type: Float, Value: 1.25},
+				},
+				Timestamp: 1700000000000000000,
+			},
+		},
+		{
+			name: "typed fields without timestamp",
+			line: `net bytes_recv=1024i,drops=3u,up=true,iface="eth 0, \"main\""`,
+			want: Point{
+				Measurement: "net",
+				Tags:        map[string]string{},
+				Fields: []Field{
+					{Key: "bytes_recv", Type: Integer, Value: 1024},
+					{Key: "drops", Type: Unsigned, Value: 3},
+					{Key: "up", Type: Boolean, Value: 1},
+					{Key: "iface", Type: String, Str: `eth 0, "main"`},
+				},
+			},
+		},
+		{
+			name: "escapes",
+			line: `disk\ io,path=/var\,log,mode\=x=rw free=1`,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": "/var,log", "mode=x": "rw"},
+				Fields:      []Field{{Key: "free", Type: Float, Value: 1}},
+			},
+		},
+		{name: "no fields", line: "cpu,host=a", wantErr: true},
+		{name: "bad tag", line: "cpu,host value=1", wantErr: true},
+		{name: "bad value", line: "cpu value=abc", wantErr: true},
+		{name: "bad integer", line: "cpu value=1.5i", wantErr: true},
+		{name: "unterminated string", line: `cpu value="abc`, wantErr: true},
+		{name: "bad timestamp", line: "cpu value=1 yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestParseLines тестирует разбор тела запроса с комментариями и ошибкой в строке
+func TestParseLines(t *testing.T) {
+	points, err := ParseLines("# comment\ncpu value=1\n\nmem used=2i\n")
+	require.NoError(t, err)
+	assert.Len(t, points, 2)
+
+	_, err = ParseLines("cpu value=1\ncpu\n")
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,94 @@
+// Package influx metric naming template
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// DefaultTemplate metric ID is measurement, tag values ordered by tag name and field joined with dots
+const DefaultTemplate = "{measurement}.{tags}.{field}"
+
+// ErrInvalidTemplate naming template is malformed
+var ErrInvalidTemplate = errors.New("invalid naming template")
+
+// Template builds metric ID of point field.
+// Template is dot separated segments with placeholders {measurement}, {field},
+// {tags} (all tag values ordered by tag name) and {tag:name} (value of one tag).
+// Segments rendered empty are dropped, so "cpu" without tags gives "cpu.usage" for default template.
+type Template struct {
+	segments []string
+}
+
+// NewTemplate parses template, it must contain {field} so fields of point don't collide
+func NewTemplate(s string) (Template, error) {
+	if !strings.Contains(s, "{field}") {
+		return Template{}, fmt.Errorf("%w %q: no {field}", ErrInvalidTemplate, s)
+	}
+	for rest := s; ; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return Template{}, fmt.Errorf("%w %q: unclosed placeholder", ErrInvalidTemplate, s)
+		}
+		name := rest[i+1 : i+j]
+		tag, isTag := strings.CutPrefix(name, "tag:")
+		if !(name == "measurement" || name == "field" || name == "tags" || (isTag && tag != "")) {
+			return Template{}, fmt.Errorf("%w %q: unknown placeholder {%s}", ErrInvalidTemplate, s, name)
+		}
+		rest = rest[i+j+1:]
+	}
+	return Template{segments: strings.Split(s, ".")}, nil
+}
+
+// MetricID ID of field of point, characters not allowed in metric name are replaced with _
+// in measurement, field and tag values (e.g. path=/ of Telegraf disk plugin)
+func (t Template) MetricID(p *Point, field string) string {
+	tags := make([]string, 0, len(p.Tags))
+	for _, k := range slices.Sorted(maps.Keys(p.Tags)) {
+		tags = append(tags, models.SanitizeMetricName(p.Tags[k]))
+	}
+
+	parts := make([]string, 0, len(t.segments))
+	for _, seg := range t.segments {
+		rendered := expand(seg, func(name string) string {
+			switch name {
+			case "measurement":
+				return models.SanitizeMetricName(p.Measurement)
+			case "field":
+				return models.SanitizeMetricName(field)
+			case "tags":
+				return strings.Join(tags, ".")
+			}
+			return models.SanitizeMetricName(p.Tags[strings.TrimPrefix(name, "tag:")])
+		})
+		if rendered != "" {
+			parts = append(parts, rendered)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// expand replaces {name} placeholders of segment
+func expand(seg string, value func(string) string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(seg, '{')
+		if i < 0 {
+			b.WriteString(seg)
+			return b.String()
+		}
+		j := strings.IndexByte(seg[i:], '}')
+		b.WriteString(seg[:i])
+		b.WriteString(value(seg[i+1 : i+j]))
+		seg = seg[i+j+1:]
+	}
+}
@@ -0,0 +1,36 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTemplate тестирует построение ID метрики по шаблону
+func TestTemplate(t *testing.T) {
+	p := &Point{Measurement: "cpu", Tags: map[string]string{"host": "srv1", "cpu": "cpu0"}}
+	bare := &Point{Measurement: "mem", Tags: map[string]string{}}
+
+	tests := []struct {
+		template string
+		point    *Point
+		want     string
+	}{
+		{DefaultTemplate, p, "cpu.cpu0.srv1.usage_idle"},
+		{DefaultTemplate, bare, "mem.usage_idle"},
+		{"{tag:host}.{measurement}_{field}", p, "srv1.cpu_usage_idle"},
+		{"{tag:dc}.{measurement}.{field}", p, "cpu.usage_idle"},
+		{DefaultTemplate, &Point{Measurement: "disk", Tags: map[string]string{"device": "sda1", "path": "/var/lib"}}, "disk.sda1._var_lib.usage_idle"},
+	}
+	for _, tt := range tests {
+		tmpl, err := NewTemplate(tt.template)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, tmpl.MetricID(tt.point, "usage_idle"), tt.template)
+	}
+
+	for _, bad := range []string{"{measurement}", "{measurement}.{field", "{host}.{field}", "{tag:}.{field}"} {
+		_, err := NewTemplate(bad)
+		assert.ErrorIs(t, err, ErrInvalidTemplate, bad)
+	}
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS metrics_history_id_type_ts_idx;
+DROP TABLE IF EXISTS metrics_history;
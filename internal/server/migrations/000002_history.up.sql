@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS metrics_history (
+     id VARCHAR(255) NOT NULL,
+     type VARCHAR(10) NOT NULL,
+     delta BIGINT,
+     value DOUBLE PRECISION,
+     ts TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS metrics_history_id_type_ts_idx ON metrics_history (id, type, ts);
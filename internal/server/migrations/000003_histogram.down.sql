@@ -0,0 +1,13 @@
+ALTER TABLE metrics_history DROP COLUMN histogram;
+DELETE FROM metrics_history WHERE type = 'histogram';
+
+CREATE TABLE metrics_old (
+     id VARCHAR(255) NOT NULL,
+     type VARCHAR(10) NOT NULL CHECK (type IN ('counter', 'gauge')),
+     delta BIGINT,
+     value DOUBLE PRECISION,
+     PRIMARY KEY (id, type)
+);
+INSERT INTO metrics_old (id, type, delta, value) SELECT id, type, delta, value FROM metrics WHERE type <> 'histogram';
+DROP TABLE metrics;
+ALTER TABLE metrics_old RENAME TO metrics;
@@ -0,0 +1,13 @@
+CREATE TABLE metrics_new (
+     id VARCHAR(255) NOT NULL,
+     type VARCHAR(10) NOT NULL CHECK (type IN ('counter', 'gauge', 'histogram')),
+     delta BIGINT,
+     value DOUBLE PRECISION,
+     histogram TEXT,
+     PRIMARY KEY (id, type)
+);
+INSERT INTO metrics_new (id, type, delta, value) SELECT id, type, delta, value FROM metrics;
+DROP TABLE metrics;
+ALTER TABLE metrics_new RENAME TO metrics;
+
+ALTER TABLE metrics_history ADD COLUMN histogram TEXT;
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS metrics_history_id_labels_type_ts_idx;
+DELETE FROM metrics_history WHERE labels <> '';
+ALTER TABLE metrics_history DROP COLUMN labels;
+CREATE INDEX IF NOT EXISTS metrics_history_id_type_ts_idx ON metrics_history (id, type, ts);
+
+CREATE TABLE metrics_unlabeled (
+     id VARCHAR(255) NOT NULL,
+     type VARCHAR(10) NOT NULL CHECK (type IN ('counter', 'gauge', 'histogram')),
+     delta BIGINT,
+     value DOUBLE PRECISION,
+     histogram TEXT,
+     PRIMARY KEY (id, type)
+);
+INSERT INTO metrics_unlabeled (id, type, delta, value, histogram) SELECT id, type, delta, value, histogram FROM metrics WHERE labels = '';
+DROP TABLE metrics;
+ALTER TABLE metrics_unlabeled RENAME TO metrics;
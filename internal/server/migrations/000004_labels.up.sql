@@ -0,0 +1,16 @@
+CREATE TABLE metrics_labeled (
+     id VARCHAR(255) NOT NULL,
+     labels TEXT NOT NULL DEFAULT '',
+     type VARCHAR(10) NOT NULL CHECK (type IN ('counter', 'gauge', 'histogram')),
+     delta BIGINT,
+     value DOUBLE PRECISION,
+     histogram TEXT,
+     PRIMARY KEY (id, labels, type)
+);
+INSERT INTO metrics_labeled (id, type, delta, value, histogram) SELECT id, type, delta, value, histogram FROM metrics;
+DROP TABLE metrics;
+ALTER TABLE metrics_labeled RENAME TO metrics;
+
+ALTER TABLE metrics_history ADD COLUMN labels TEXT NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS metrics_history_id_type_ts_idx;
+CREATE INDEX IF NOT EXISTS metrics_history_id_labels_type_ts_idx ON metrics_history (id, labels, type, ts);
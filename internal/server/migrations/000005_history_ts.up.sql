@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS metrics_history_ts_idx ON metrics_history (ts);
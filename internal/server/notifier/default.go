@@ -0,0 +1,29 @@
+// Package notifier process wide notifier used by storage and middlewares
+package notifier
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var defaultNotifier atomic.Pointer[Notifier]
+
+// SetDefault makes n receiver of Emit, nil turns notifications off
+func SetDefault(n *Notifier) {
+	defaultNotifier.Store(n)
+}
+
+// Emit sends event to default notifier if any
+func Emit(kind Kind, source string, message string) {
+	if n := defaultNotifier.Load(); n != nil {
+		n.Notify(Event{Kind: kind, Source: source, Message: message})
+	}
+}
+
+// EmitSync sends event and waits for delivery, for failures right before exit
+func EmitSync(kind Kind, source string, message string, timeout time.Duration) {
+	if n := defaultNotifier.Load(); n != nil {
+		n.Notify(Event{Kind: kind, Source: source, Message: message})
+		n.Flush(timeout)
+	}
+}
@@ -0,0 +1,228 @@
+// Package notifier delivers server operational events to webhooks
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Nikolay961996/metsys/models"
+	"github.com/Nikolay961996/metsys/utils"
+)
+
+// Kind of operational event
+type Kind string
+
+const (
+	StorageUnavailable   Kind = "storage_unavailable"    // DB can't be reached after retries
+	FlushFailed          Kind = "flush_failed"           // FileStorage snapshot or journal can't be written
+	MigrationFailed      Kind = "migration_failed"       // DB migrations failed on start
+	TrustedSubnetInvalid Kind = "trusted_subnet_invalid" // trusted subnet config can't be parsed
+)
+
+const (
+	queueSize     = 100
+	maxDeliveries = 100             // delivery records kept for inspection
+	dedupWindow   = 5 * time.Minute // same event is sent at most once per window
+	sendTimeout   = 5 * time.Second
+)
+
+// Event payload posted to webhooks
+type Event struct {
+	Time       time.Time `json:"time"`
+	Kind       Kind      `json:"kind"`
+	Source     string    `json:"source"`
+	Message    string    `json:"message"`
+	Suppressed int       `json:"suppressed,omitempty"` // repeats dropped since previous delivery
+}
+
+// Delivery outcome of sending event to one webhook
+type Delivery struct {
+	Time      time.Time `json:"time"`
+	URL       string    `json:"url"`
+	Error     string    `json:"error,omitempty"`
+	Event     Event     `json:"event"`
+	Attempts  int       `json:"attempts"`
+	Delivered bool      `json:"delivered"`
+}
+
+// HTTPStatusError webhook answered with not 2xx status
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("webhook responded with status %d", e.StatusCode)
+}
+
+type dedupState struct {
+	sent       time.Time
+	suppressed int
+}
+
+// Notifier queues events and posts them to every webhook url.
+// Payload is signed with HashSHA256 header when key is set, like server responses.
+type Notifier struct {
+	client     *http.Client
+	queue      chan Event
+	seen       map[string]*dedupState
+	key        string
+	urls       []string
+	deliveries []Delivery
+	pending    sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// New notifier for urls, events are delivered only while Run is active
+func New(urls []string, key string) *Notifier {
+	return &Notifier{
+		client: &http.Client{Timeout: sendTimeout},
+		queue:  make(chan Event, queueSize),
+		seen:   map[string]*dedupState{},
+		urls:   urls,
+		key:    key,
+	}
+}
+
+// Notify queues event without blocking, repeats within dedupWindow are only counted
+func (n *Notifier) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	n.mu.Lock()
+	key := string(e.Kind) + "|" + e.Source + "|" + e.Message
+	st, ok := n.seen[key]
+	if ok && e.Time.Sub(st.sent) < dedupWindow {
+		st.suppressed++
+		n.mu.Unlock()
+		return
+	}
+	if !ok {
+		st = &dedupState{}
+		n.seen[key] = st
+	}
+	e.Suppressed = st.suppressed
+	st.sent = e.Time
+	st.suppressed = 0
+	n.mu.Unlock()
+
+	n.pending.Add(1)
+	select {
+	case n.queue <- e:
+	default:
+		n.pending.Done()
+		models.Log.Warn(fmt.Sprintf("Notification queue is full, event %s dropped", e.Kind))
+	}
+}
+
+// Run delivers queued events until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-n.queue:
+			for _, url := range n.urls {
+				n.record(n.deliver(ctx, url, e))
+			}
+			n.pending.Done()
+		}
+	}
+}
+
+// Flush waits until queued events are delivered or timeout passes
+func (n *Notifier) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// Deliveries recent delivery records, oldest first
+func (n *Notifier) Deliveries() []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Delivery{}, n.deliveries...)
+}
+
+func (n *Notifier) deliver(ctx context.Context, url string, e Event) Delivery {
+	d := Delivery{Event: e, URL: url}
+	body, err := json.Marshal(e)
+	if err == nil {
+		err = utils.RetryerConContext(ctx, func() error {
+			d.Attempts++
+			return n.post(ctx, url, body)
+		}, shouldRetryWebhookError)
+	}
+
+	d.Time = time.Now().UTC()
+	d.Delivered = err == nil
+	if err != nil {
+		d.Error = err.Error()
+		models.Log.Error(fmt.Sprintf("Failed to notify %s about %s: %v", url, e.Kind, err))
+	}
+	return d
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if n.key != "" {
+		h := hmac.New(sha256.New, []byte(n.key))
+		h.Write(body)
+		request.Header.Set("HashSHA256", hex.EncodeToString(h.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+func (n *Notifier) record(d Delivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries = append(n.deliveries, d)
+	if len(n.deliveries) > maxDeliveries {
+		n.deliveries = n.deliveries[len(n.deliveries)-maxDeliveries:]
+	}
+}
+
+// shouldRetryWebhookError network failures, 5xx and 429 are worth retrying
+func shouldRetryWebhookError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver тестовый webhook, запоминающий полученные события
+type receiver struct {
+	events   []Event
+	statuses []int // ответы по порядку, дальше 200
+	signs    []string
+	calls    int
+	mu       sync.Mutex
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	status := http.StatusOK
+	if rc.calls < len(rc.statuses) {
+		status = rc.statuses[rc.calls]
+	}
+	rc.calls++
+	if status == http.StatusOK {
+		var e Event
+		_ = json.Unmarshal(body, &e)
+		rc.events = append(rc.events, e)
+		rc.signs = append(rc.signs, r.Header.Get("HashSHA256"))
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Event{}, rc.events...)
+}
+
+func startNotifier(t *testing.T, key string, urls ...string) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	n := New(urls, key)
+	go n.Run(ctx)
+	return n
+}
+
+// TestNotifier_DeliveryAndSigning тестирует доставку и подпись события
+func TestNotifier_DeliveryAndSigning(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	n := startNotifier(t, "secret", ts.URL)
+	n.Notify(Event{Kind: StorageUnavailable, Source: "db", Message: "connection refused"})
+	n.Flush(5 * time.Second)
+
+	events := rc.received()
+	require.Len(t, events, 1)
+	assert.Equal(t, StorageUnavailable, events[0].Kind)
+	assert.Equal(t, "connection refused", events[0].Message)
+
+	body, _ := json.Marshal(n.Deliveries()[0].Event)
+	h := hmac.New(sha256.New, []byte("secret"))
+	h.Write(body)
+	assert.Equal(t, hex.EncodeToString(h.Sum(nil)), rc.signs[0])
+
+	deliveries := n.Deliveries()
+	require.Len(t, deliveries, 1)
+	assert.True(t, deliveries[0].Delivered)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+}
+
+// TestNotifier_Dedup тестирует подавление повторов в окне дедупликации
+func TestNotifier_Dedup(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	n := startNotifier(t, "", ts.URL)
+	start := time.Now()
+	e := Event{Kind: FlushFailed, Source: "file", Message: "disk full"}
+	for _, at := range []time.Duration{0, time.Minute, 2 * time.Minute, dedupWindow + time.Second} {
+		e.Time = start.Add(at)
+		n.Notify(e)
+	}
+	n.Notify(Event{Kind: FlushFailed, Source: "file", Message: "other", Time: start})
+	n.Flush(5 * time.Second)
+
+	events := rc.received()
+	require.Len(t, events, 3)
+	assert.Equal(t, 0, events[0].Suppressed)
+	assert.Equal(t, 2, events[1].Suppressed)
+	assert.Empty(t, rc.signs[0])
+}
+
+// TestNotifier_Retry тестирует повтор при 5xx и отказ без повторов при 4xx
+func TestNotifier_Retry(t *testing.T) {
+	flaky := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	flakyServer := httptest.NewServer(flaky)
+	defer flakyServer.Close()
+	rejecting := &receiver{statuses: []int{http.StatusBadRequest}}
+	rejectingServer := httptest.NewServer(rejecting)
+	defer rejectingServer.Close()
+
+	n := startNotifier(t, "", flakyServer.URL, rejectingServer.URL)
+	n.Notify(Event{Kind: MigrationFailed, Source: "db", Message: "dirty database"})
+	n.Flush(10 * time.Second)
+
+	deliveries := n.Deliveries()
+	require.Len(t, deliveries, 2)
+	assert.True(t, deliveries[0].Delivered)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.False(t, deliveries[1].Delivered)
+	assert.Equal(t, 1, deliveries[1].Attempts)
+	assert.Contains(t, deliveries[1].Error, "400")
+}
+
+// TestEmit тестирует отправку через notifier по умолчанию
+func TestEmit(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	Emit(TrustedSubnetInvalid, "router", "ignored without default notifier")
+
+	SetDefault(startNotifier(t, "", ts.URL))
+	defer SetDefault(nil)
+	EmitSync(TrustedSubnetInvalid, "router", "bad cidr", 5*time.Second)
+
+	events := rc.received()
+	require.Len(t, events, 1)
+	assert.Equal(t, "bad cidr", events[0].Message)
+}
@@ -0,0 +1,241 @@
+// Package otlp OpenTelemetry metrics receiver
+package otlp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// series value of one series collected from request.
+// Cumulative series carry sender total and keep the latest point,
+// delta series are summed over the request.
+type series struct {
+	hist       *models.HistogramData
+	metric     models.Metrics
+	value      float64
+	time       uint64
+	cumulative bool
+}
+
+// batch series of request by type and series key
+type batch struct {
+	series   map[string]*series
+	errs     []string
+	rejected int64
+}
+
+func newBatch() *batch {
+	return &batch{series: map[string]*series{}}
+}
+
+func (b *batch) reject(metric string, reason string) {
+	b.rejected++
+	if len(b.errs) < 10 {
+		b.errs = append(b.errs, metric+": "+reason)
+	}
+}
+
+func (b *batch) add(s *series) {
+	key := s.metric.MType + "/" + s.metric.Key()
+	prev, ok := b.series[key]
+	switch {
+	case !ok, s.cumulative && s.time >= prev.time, s.cumulative != prev.cumulative:
+		b.series[key] = s
+	case s.cumulative:
+	case s.hist != nil:
+		if err := prev.hist.Merge(*s.hist); err != nil {
+			b.reject(s.metric.ID, err.Error())
+		}
+	default:
+		prev.value += s.value
+	}
+}
+
+// convert collects data points of request.
+// Gauge and non-monotonic Sum become gauges, monotonic Sum becomes counter, Histogram becomes histogram.
+// Exponential histograms and summaries are rejected.
+func convert(req *colmetricspb.ExportMetricsServiceRequest) *batch {
+	b := newBatch()
+	for _, rm := range req.GetResourceMetrics() {
+		resource := resourceLabels(rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				convertMetric(b, m, resource)
+			}
+		}
+	}
+	return b
+}
+
+func convertMetric(b *batch, m *metricspb.Metric, resource models.Labels) {
+	name := m.GetName()
+	if name == "" {
+		b.reject(name, "empty metric name")
+		return
+	}
+
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			addNumber(b, name, models.Gauge, true, p, resource)
+		}
+	case *metricspb.Metric_Sum:
+		metricType := models.Gauge
+		if data.Sum.GetIsMonotonic() {
+			metricType = models.Counter
+		}
+		cumulative := data.Sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, p := range data.Sum.GetDataPoints() {
+			addNumber(b, name, metricType, cumulative, p, resource)
+		}
+	case *metricspb.Metric_Histogram:
+		cumulative := data.Histogram.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, p := range data.Histogram.GetDataPoints() {
+			addHistogram(b, name, cumulative, p, resource)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for range data.ExponentialHistogram.GetDataPoints() {
+			b.reject(name, "exponential histogram is not supported")
+		}
+	case *metricspb.Metric_Summary:
+		for range data.Summary.GetDataPoints() {
+			b.reject(name, "summary is not supported")
+		}
+	default:
+		b.reject(name, "no data")
+	}
+}
+
+func addNumber(b *batch, name string, metricType string, cumulative bool, p *metricspb.NumberDataPoint, resource models.Labels) {
+	if noRecordedValue(p.GetFlags()) {
+		return
+	}
+	var v float64
+	switch value := p.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		v = value.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		v = float64(value.AsInt)
+	default:
+		b.reject(name, "no value")
+		return
+	}
+
+	b.add(&series{
+		metric:     models.Metrics{ID: name, MType: metricType, Labels: pointLabels(resource, p.GetAttributes())},
+		value:      v,
+		time:       p.GetTimeUnixNano(),
+		cumulative: cumulative,
+	})
+}
+
+func addHistogram(b *batch, name string, cumulative bool, p *metricspb.HistogramDataPoint, resource models.Labels) {
+	if noRecordedValue(p.GetFlags()) {
+		return
+	}
+	h := models.HistogramData{
+		Bounds: p.GetExplicitBounds(),
+		Counts: p.GetBucketCounts(),
+		Count:  p.GetCount(),
+		Sum:    p.GetSum(),
+	}
+	if len(h.Bounds) == 0 && len(h.Counts) == 0 {
+		h.Counts = []uint64{h.Count}
+	}
+	if err := h.Validate(); err != nil {
+		b.reject(name, err.Error())
+		return
+	}
+
+	b.add(&series{
+		metric:     models.Metrics{ID: name, MType: models.Histogram, Labels: pointLabels(resource, p.GetAttributes())},
+		hist:       &h,
+		time:       p.GetTimeUnixNano(),
+		cumulative: cumulative,
+	})
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+// resourceLabels job and instance from service attributes, like Prometheus does for OTLP
+func resourceLabels(attrs []*commonpb.KeyValue) models.Labels {
+	labels := models.Labels{}
+	var namespace string
+	for _, kv := range attrs {
+		switch kv.GetKey() {
+		case "service.name":
+			labels["job"] = attributeValue(kv.GetValue())
+		case "service.namespace":
+			namespace = attributeValue(kv.GetValue())
+		case "service.instance.id":
+			labels["instance"] = attributeValue(kv.GetValue())
+		}
+	}
+	if namespace != "" && labels["job"] != "" {
+		labels["job"] = namespace + "/" + labels["job"]
+	}
+	return labels
+}
+
+// pointLabels resource labels with data point attributes, attribute names are sanitized.
+// Empty values are dropped, as Prometheus treats them as absent labels.
+func pointLabels(resource models.Labels, attrs []*commonpb.KeyValue) models.Labels {
+	labels := make(models.Labels, len(resource)+len(attrs))
+	for k, v := range resource {
+		labels[k] = v
+	}
+	for _, kv := range attrs {
+		labels[labelName(kv.GetKey())] = attributeValue(kv.GetValue())
+	}
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// labelName replaces characters not allowed in label name ("service.name" -> "service_name")
+func labelName(key string) string {
+	name := strings.Map(func(c rune) rune {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			return c
+		}
+		return '_'
+	}, key)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return "_" + name
+	}
+	return name
+}
+
+func attributeValue(v *commonpb.AnyValue) string {
+	switch value := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return value.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(value.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(value.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(value.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return fmt.Sprintf("%x", value.BytesValue)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,124 @@
+// Package otlp receiver storing converted data points
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// Receiver converts OTLP metrics and writes them into storage, used by OTLP/gRPC and OTLP/HTTP handlers
+type Receiver struct {
+	storage repositories.Storage
+}
+
+// NewReceiver receiver writing into storage
+func NewReceiver(storage repositories.Storage) *Receiver {
+	return &Receiver{storage: storage}
+}
+
+// Write stores request in one transaction, values of cumulative series are resolved against stored ones inside it.
+// Data points which can't be stored are reported in partial success, storage failures fail the whole request.
+func (r *Receiver) Write(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	b := convert(req)
+	if err := r.check(ctx, b); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.storage.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, s := range b.series {
+		key := s.metric.Key()
+		switch {
+		case s.metric.MType == models.Gauge && s.cumulative:
+			err = tx.SetGauge(ctx, key, *s.metric.Value)
+		case s.metric.MType == models.Gauge:
+			err = tx.AddGauge(ctx, key, *s.metric.Value)
+		case s.metric.MType == models.Counter && s.cumulative:
+			err = tx.SetCounter(ctx, key, *s.metric.Delta)
+		case s.metric.MType == models.Counter:
+			if *s.metric.Delta != 0 {
+				err = tx.AddCounter(ctx, key, *s.metric.Delta)
+			}
+		case s.metric.MType == models.Histogram && s.cumulative:
+			err = tx.AddCumulativeHistogram(ctx, key, *s.hist)
+		case s.metric.MType == models.Histogram:
+			if s.hist.Count != 0 {
+				err = tx.AddHistogram(ctx, key, *s.hist)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if b.rejected > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: b.rejected,
+			ErrorMessage:       strings.Join(b.errs, "; "),
+		}
+	}
+	return resp, nil
+}
+
+// check fills metric values of series and validates them, invalid series are rejected.
+// Counters must be whole numbers, histogram bounds must match stored ones.
+func (r *Receiver) check(ctx context.Context, b *batch) error {
+	for key, s := range b.series {
+		switch s.metric.MType {
+		case models.Gauge:
+			v := s.value
+			s.metric.Value = &v
+		case models.Counter:
+			if s.value != math.Trunc(s.value) || s.value < math.MinInt64 || s.value >= math.MaxInt64 {
+				b.reject(s.metric.ID, fmt.Sprintf("counter value %v is not an integer", s.value))
+				delete(b.series, key)
+				continue
+			}
+			d := int64(s.value)
+			s.metric.Delta = &d
+		case models.Histogram:
+			s.metric.Histogram = s.hist
+		}
+		if err := s.metric.Validate(); err != nil {
+			b.reject(s.metric.ID, err.Error())
+			delete(b.series, key)
+			continue
+		}
+		if s.metric.MType != models.Histogram {
+			continue
+		}
+
+		// mem transaction reports bounds mismatch only on commit, so it is checked before
+		stored, err := r.storage.GetHistogram(ctx, s.metric.Key())
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(s.hist.Bounds, stored.Bounds) {
+			b.reject(s.metric.ID, fmt.Sprintf("%v: bounds %v differ from stored %v", models.ErrHistogramBounds, s.hist.Bounds, stored.Bounds))
+			delete(b.series, key)
+		}
+	}
+	return nil
+}
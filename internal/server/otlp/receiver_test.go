@@ -0,0 +1,192 @@
+package otlp
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+)
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func exportRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttr("service.name", "checkout"),
+			stringAttr("host.name", "ignored"),
+		}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+func sum(name string, monotonic bool, temporality metricspb.AggregationTemporality, v int64) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		IsMonotonic:            monotonic,
+		AggregationTemporality: temporality,
+		DataPoints: []*metricspb.NumberDataPoint{{
+			Attributes: []*commonpb.KeyValue{stringAttr("http.method", "GET")},
+			Value:      &metricspb.NumberDataPoint_AsInt{AsInt: v},
+		}},
+	}}}
+}
+
+func histogram(name string, temporality metricspb.AggregationTemporality, counts []uint64, total float64) *metricspb.Metric {
+	var count uint64
+	for _, c := range counts {
+		count += c
+	}
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+		AggregationTemporality: temporality,
+		DataPoints: []*metricspb.HistogramDataPoint{{
+			ExplicitBounds: []float64{0.1, 1},
+			BucketCounts:   counts,
+			Count:          count,
+			Sum:            &total,
+		}},
+	}}}
+}
+
+const (
+	cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta      = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+)
+
+// TestReceiver тестирует преобразование и запись метрик OTLP
+func TestReceiver(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	r := NewReceiver(s)
+
+	gauge := &metricspb.Metric{Name: "queue.size", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+		DataPoints: []*metricspb.NumberDataPoint{
+			{TimeUnixNano: 2, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 7.5}},
+			{TimeUnixNano: 1, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 3}},
+		},
+	}}}
+	exp := &metricspb.Metric{Name: "latency.exp", Data: &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+		DataPoints: []*metricspb.ExponentialHistogramDataPoint{{Count: 1}},
+	}}}
+
+	resp, err := r.Write(ctx, exportRequest(
+		gauge,
+		sum("http.requests", true, cumulative, 10),
+		sum("jobs.done", true, delta, 4),
+		sum("connections", false, cumulative, 5),
+		sum("inflight", false, delta, 2),
+		histogram("latency", cumulative, []uint64{1, 2, 0}, 1.5),
+		histogram("latency.delta", delta, []uint64{1, 0, 0}, 0.05),
+		exp,
+	))
+	require.NoError(t, err)
+	require.NotNil(t, resp.PartialSuccess)
+	assert.Equal(t, int64(1), resp.PartialSuccess.RejectedDataPoints)
+	assert.Contains(t, resp.PartialSuccess.ErrorMessage, "latency.exp")
+
+	v, err := s.GetGauge(ctx, `queue.size{job="checkout"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 7.5, v, 1e-9, "latest point wins")
+
+	series := `{http_method="GET",job="checkout"}`
+	resp, err = r.Write(ctx, exportRequest(
+		sum("http.requests", true, cumulative, 25),
+		sum("jobs.done", true, delta, 4),
+		sum("inflight", false, delta, -1),
+		histogram("latency", cumulative, []uint64{2, 3, 1}, 3),
+		histogram("latency.delta", delta, []uint64{0, 1, 0}, 0.5),
+	))
+	require.NoError(t, err)
+	assert.Nil(t, resp.PartialSuccess)
+
+	c, err := s.GetCounter(ctx, "http.requests"+series)
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), c, "cumulative sum keeps sender value")
+	c, err = s.GetCounter(ctx, "jobs.done"+series)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), c, "delta sum is accumulated")
+	v, err = s.GetGauge(ctx, "connections"+series)
+	require.NoError(t, err)
+	assert.InDelta(t, 5, v, 1e-9)
+	v, err = s.GetGauge(ctx, "inflight"+series)
+	require.NoError(t, err)
+	assert.InDelta(t, 1, v, 1e-9)
+
+	h, err := s.GetHistogram(ctx, `latency{job="checkout"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3, 1}, h.Counts)
+	assert.Equal(t, uint64(6), h.Count)
+	assert.InDelta(t, 3, h.Sum, 1e-9)
+	h, err = s.GetHistogram(ctx, `latency.delta{job="checkout"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 1, 0}, h.Counts)
+
+	// sender restarted: counter goes down, histogram starts over
+	_, err = r.Write(ctx, exportRequest(
+		sum("http.requests", true, cumulative, 3),
+		histogram("latency", cumulative, []uint64{1, 0, 0}, 0.05),
+	))
+	require.NoError(t, err)
+	c, err = s.GetCounter(ctx, "http.requests"+series)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), c)
+	h, err = s.GetHistogram(ctx, `latency{job="checkout"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3, 3, 1}, h.Counts)
+
+	badBounds := histogram("latency", delta, []uint64{1, 0}, 1)
+	badBounds.GetHistogram().DataPoints[0].ExplicitBounds = []float64{5}
+	resp, err = r.Write(ctx, exportRequest(badBounds))
+	require.NoError(t, err)
+	require.NotNil(t, resp.PartialSuccess)
+	assert.Equal(t, int64(1), resp.PartialSuccess.RejectedDataPoints)
+}
+
+// TestReceiver_InvalidPoints тестирует отклонение нечисловых датчиков и дробных счётчиков
+func TestReceiver_InvalidPoints(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	r := NewReceiver(s)
+
+	gauge := func(name string, v float64) *metricspb.Metric {
+		return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: v}}},
+		}}}
+	}
+	fractional := sum("cpu.seconds", true, cumulative, 0)
+	fractional.GetSum().DataPoints[0].Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: 1.5}
+
+	resp, err := r.Write(ctx, exportRequest(
+		gauge("temperature", math.NaN()),
+		gauge("pressure", math.Inf(1)),
+		gauge("humidity", 40),
+		fractional,
+		sum("http.requests", true, cumulative, 10),
+	))
+	require.NoError(t, err)
+	require.NotNil(t, resp.PartialSuccess)
+	assert.Equal(t, int64(3), resp.PartialSuccess.RejectedDataPoints)
+	assert.Contains(t, resp.PartialSuccess.ErrorMessage, "temperature")
+	assert.Contains(t, resp.PartialSuccess.ErrorMessage, "pressure")
+	assert.Contains(t, resp.PartialSuccess.ErrorMessage, "cpu.seconds")
+
+	_, err = s.GetGauge(ctx, `temperature{job="checkout"}`)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	_, err = s.GetCounter(ctx, `cpu.seconds{http_method="GET",job="checkout"}`)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	v, err := s.GetGauge(ctx, `humidity{job="checkout"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 40, v, 1e-9)
+	c, err := s.GetCounter(ctx, `http.requests{http_method="GET",job="checkout"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), c)
+}
@@ -0,0 +1,251 @@
+// Package ratelimit token buckets of clients per route for HTTP and gRPC APIs
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers identifying client, address is used if both are missing
+const (
+	APIKeyHeader  = "X-API-Key"
+	AgentIDHeader = "X-Agent-ID"
+)
+
+const (
+	sweepInterval       = time.Minute // period of forgetting buckets refilled to burst
+	maxBuckets          = 100000      // buckets kept at once, a random one is evicted for new client beyond it
+	maxThrottledClients = 1000        // throttled clients in stats, only totals are counted for others
+)
+
+// Rule rate of requests of one client to routes with prefix, Burst requests are allowed at once.
+// Prefix is matched against HTTP path or full gRPC method (/metrics.MetricsService/UpdateMetric).
+type Rule struct {
+	Prefix string  `json:"prefix"`
+	Rate   float64 `json:"rate"` // requests per second
+	Burst  int     `json:"burst"`
+}
+
+// ParseRules rules in format prefix=rate[:burst],... e.g. /=100:200,/updates/=5,
+// burst is the rate rounded up if omitted
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, limit, ok := strings.Cut(item, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("rate limit %q: want /prefix=rate[:burst]", item)
+		}
+		rateStr, burstStr, hasBurst := strings.Cut(limit, ":")
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("rate limit %q: rate must be positive number", item)
+		}
+		burst := int(math.Ceil(rate))
+		if hasBurst {
+			if burst, err = strconv.Atoi(burstStr); err != nil || burst < 1 {
+				return nil, fmt.Errorf("rate limit %q: burst must be positive integer", item)
+			}
+		}
+		rules = append(rules, Rule{Prefix: prefix, Rate: rate, Burst: burst})
+	}
+	return rules, nil
+}
+
+// ParseProxies comma separated CIDR networks of reverse proxies, e.g. 10.0.0.0/8,127.0.0.1/32
+func ParseProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit proxy %q: %w", item, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// bucket tokens of client for rule at moment last
+type bucket struct {
+	last   time.Time
+	tokens float64
+}
+
+// refill adds tokens for time passed since last, up to burst
+func (b *bucket) refill(r *Rule, now time.Time) {
+	b.tokens = min(float64(r.Burst), b.tokens+now.Sub(b.last).Seconds()*r.Rate)
+	b.last = now
+}
+
+type bucketKey struct {
+	rule   *Rule
+	client string
+}
+
+// ClientStats throttling of client
+type ClientStats struct {
+	LastThrottled time.Time `json:"last_throttled"`
+	Client        string    `json:"client"`
+	Throttled     int64     `json:"throttled"`
+}
+
+// RuleStats requests of rule since start, clients are the throttled ones sorted by name
+type RuleStats struct {
+	Clients []ClientStats `json:"clients"`
+	Rule
+	Allowed   int64 `json:"allowed"`
+	Throttled int64 `json:"throttled"`
+}
+
+// Limiter token bucket per client and rule, the rule with the longest matching prefix applies.
+// Routes without rule aren't limited.
+type Limiter struct {
+	lastSweep time.Time
+	now       func() time.Time
+	buckets   map[bucketKey]*bucket
+	stats     map[*Rule]*RuleStats
+	throttled map[bucketKey]*ClientStats
+	rules     []*Rule // by prefix length, the longest first
+	proxies   []*net.IPNet
+	mu        sync.Mutex
+}
+
+// NewLimiter limiter of rules, the last of rules with the same prefix applies.
+// X-Real-IP is trusted only from proxies, clients without API key and agent ID are told by peer address otherwise.
+func NewLimiter(rules []Rule, proxies []*net.IPNet) *Limiter {
+	l := &Limiter{
+		proxies:   proxies,
+		now:       time.Now,
+		buckets:   make(map[bucketKey]*bucket),
+		stats:     make(map[*Rule]*RuleStats),
+		throttled: make(map[bucketKey]*ClientStats),
+	}
+	for _, r := range rules {
+		l.rules = slices.DeleteFunc(l.rules, func(old *Rule) bool { return old.Prefix == r.Prefix })
+		l.rules = append(l.rules, &r)
+	}
+	slices.SortStableFunc(l.rules, func(a, b *Rule) int { return len(b.Prefix) - len(a.Prefix) })
+	for _, r := range l.rules {
+		l.stats[r] = &RuleStats{Rule: *r}
+	}
+	return l
+}
+
+// Client identity of client for Allow: API key (hashed not to expose it in stats), agent ID,
+// X-Real-IP if peer is trusted proxy or peer IP otherwise.
+// Client without key and agent ID can't choose bucket, X-Real-IP of untrusted peer is ignored.
+func (l *Limiter) Client(peer string, realIP string, apiKey string, agentID string) string {
+	switch {
+	case apiKey != "":
+		sum := sha256.Sum256([]byte(apiKey))
+		return "key:" + hex.EncodeToString(sum[:8])
+	case agentID != "":
+		return "agent:" + agentID
+	}
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		host = peer
+	}
+	if ip := net.ParseIP(host); realIP != "" && ip != nil && slices.ContainsFunc(l.proxies, func(n *net.IPNet) bool { return n.Contains(ip) }) {
+		host = realIP
+	}
+	return "ip:" + host
+}
+
+// Allow takes token of client for route, delay till the next token is returned if client is throttled
+func (l *Limiter) Allow(client string, route string) (bool, time.Duration) {
+	i := slices.IndexFunc(l.rules, func(r *Rule) bool { return strings.HasPrefix(route, r.Prefix) })
+	if i < 0 {
+		return true, 0
+	}
+	rule := l.rules[i]
+	key := bucketKey{rule: rule, client: client}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.evict()
+		}
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(rule, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		l.stats[rule].Allowed++
+		return true, 0
+	}
+
+	l.stats[rule].Throttled++
+	c, ok := l.throttled[key]
+	if !ok && len(l.throttled) < maxThrottledClients {
+		c = &ClientStats{Client: client}
+		l.throttled[key] = c
+	}
+	if c != nil {
+		c.Throttled++
+		c.LastThrottled = now
+	}
+	return false, time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+}
+
+// sweep forgets buckets refilled to burst, they are the same as new ones
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*key.rule.Rate >= float64(key.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// evict forgets random bucket, it is refilled to burst if client comes back
+func (l *Limiter) evict() {
+	for key := range l.buckets {
+		delete(l.buckets, key)
+		return
+	}
+}
+
+// Stats counters of rules in order of matching
+func (l *Limiter) Stats() []RuleStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]RuleStats, 0, len(l.rules))
+	for _, r := range l.rules {
+		s := *l.stats[r]
+		s.Clients = []ClientStats{}
+		for key, c := range l.throttled {
+			if key.rule == r {
+				s.Clients = append(s.Clients, *c)
+			}
+		}
+		slices.SortFunc(s.Clients, func(a, b ClientStats) int { return strings.Compare(a.Client, b.Client) })
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRules тестирует разбор правил ограничения частоты запросов
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(" /=100:200, /updates/=2.5 ,/metrics.MetricsService/=10:1")
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Prefix: "/", Rate: 100, Burst: 200},
+		{Prefix: "/updates/", Rate: 2.5, Burst: 3},
+		{Prefix: "/metrics.MetricsService/", Rate: 10, Burst: 1},
+	}, rules)
+
+	rules, err = ParseRules("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, s := range []string{"updates=1", "/=0", "/=-1", "/=x", "/=1:0", "/=1:1.5", "/"} {
+		_, err = ParseRules(s)
+		assert.Error(t, err, s)
+	}
+}
+
+// TestLimiter тестирует корзины токенов по клиентам и маршрутам и счётчики ограничений
+func TestLimiter(t *testing.T) {
+	l := NewLimiter([]Rule{
+		{Prefix: "/", Rate: 100, Burst: 100},
+		{Prefix: "/update/", Rate: 1, Burst: 2},
+	}, nil)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for range 2 {
+		ok, _ := l.Allow("ip:10.0.0.1", "/update/gauge/Alloc/1")
+		assert.True(t, ok)
+	}
+	ok, delay := l.Allow("ip:10.0.0.1", "/update/gauge/Alloc/1")
+	assert.False(t, ok, "burst is spent")
+	assert.Equal(t, time.Second, delay)
+	ok, _ = l.Allow("ip:10.0.0.2", "/update/")
+	assert.True(t, ok, "clients have own buckets")
+	ok, _ = l.Allow("ip:10.0.0.1", "/updates/")
+	assert.True(t, ok, "the longest matching prefix applies")
+	ok, _ = l.Allow("ip:10.0.0.1", "metrics.MetricsService/UpdateMetric")
+	assert.True(t, ok, "route without rule isn't limited")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, delay = l.Allow("ip:10.0.0.1", "/update/")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay)
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("ip:10.0.0.1", "/update/")
+	assert.True(t, ok, "token is refilled")
+
+	stats := l.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "/update/", stats[0].Prefix)
+	assert.Equal(t, int64(4), stats[0].Allowed)
+	assert.Equal(t, int64(2), stats[0].Throttled)
+	assert.Equal(t, []ClientStats{{Client: "ip:10.0.0.1", Throttled: 2, LastThrottled: now.Add(-500 * time.Millisecond)}}, stats[0].Clients)
+	assert.Equal(t, "/", stats[1].Prefix)
+	assert.Equal(t, int64(1), stats[1].Allowed)
+	assert.Empty(t, stats[1].Clients)
+
+	now = now.Add(time.Hour)
+	l.Allow("ip:10.0.0.3", "/")
+	assert.Len(t, l.buckets, 1, "refilled buckets are forgotten")
+}
+
+// TestLimiterClient тестирует определение клиента по ключу API, ID агента, адресу соединения и X-Real-IP доверенных прокси
+func TestLimiterClient(t *testing.T) {
+	proxies, err := ParseProxies("10.0.0.0/8, 127.0.0.1/32")
+	require.NoError(t, err)
+	require.Len(t, proxies, 2)
+	_, err = ParseProxies("10.0.0.0")
+	assert.Error(t, err)
+
+	l := NewLimiter(nil, proxies)
+	assert.Equal(t, "ip:192.168.1.1", l.Client("192.168.1.1:5000", "1.2.3.4", "", ""), "untrusted peer")
+	assert.Equal(t, "ip:1.2.3.4", l.Client("10.1.2.3:5000", "1.2.3.4", "", ""))
+	assert.Equal(t, "ip:127.0.0.1", l.Client("127.0.0.1:5000", "", "", ""))
+	assert.Equal(t, "ip:::1", l.Client("[::1]:5000", "1.2.3.4", "", ""))
+	assert.Equal(t, "agent:host-1", l.Client("192.168.1.1:5000", "1.2.3.4", "", "host-1"))
+	key := l.Client("192.168.1.1:5000", "", "secret", "host-1")
+	assert.True(t, strings.HasPrefix(key, "key:"), "API key is preferred to agent ID")
+	assert.NotContains(t, key, "secret", "API key isn't exposed")
+	assert.Equal(t, key, l.Client("10.1.2.3:5000", "", "secret", ""), "key identifies client from any address")
+}
+
+// TestLimiterMaxBuckets тестирует вытеснение корзин при превышении их числа
+func TestLimiterMaxBuckets(t *testing.T) {
+	l := NewLimiter([]Rule{{Prefix: "/", Rate: 0.001, Burst: 1}}, nil)
+	for i := range maxBuckets + 10 {
+		ok, _ := l.Allow(fmt.Sprintf("ip:client-%d", i), "/")
+		assert.True(t, ok)
+	}
+	assert.Len(t, l.buckets, maxBuckets)
+}
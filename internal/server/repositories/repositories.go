@@ -1,22 +1,101 @@
 // Package repositories consist storage interface
 package repositories
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
 
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// ErrNotFound metric is absent in storage
+var ErrNotFound = errors.New("metric not found")
+
+// ErrUnavailable storage can't serve requests now (connection lost, server down), request may be retried later
+var ErrUnavailable = errors.New("storage unavailable")
+
+// ErrTxDone transaction already committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// MetricDto metric for listing, Histogram is set for histograms only
 type MetricDto struct {
-	Name  string
-	Type  string
-	Value string
+	Histogram *models.HistogramData `json:"histogram,omitempty"`
+	Labels    models.Labels         `json:"labels,omitempty"`
+	Name      string                `json:"id"`
+	Type      string                `json:"type"`
+	Value     string                `json:"value"`
+}
+
+// HistoryPoint timestamped value of metric.
+// Value filled for gauge, Delta (running total) for counter, Histogram (merged total) for histogram.
+type HistoryPoint struct {
+	Timestamp time.Time             `json:"timestamp"`
+	Value     *float64              `json:"value,omitempty"`
+	Delta     *int64                `json:"delta,omitempty"`
+	Histogram *models.HistogramData `json:"histogram,omitempty"`
+}
+
+// MetricWriter write side of storage, shared by Storage and Tx
+type MetricWriter interface {
+	SetGauge(ctx context.Context, metricName string, value float64) error
+	AddCounter(ctx context.Context, metricName string, value int64) error
+	// AddHistogram merges histogram into stored one, bounds must match (models.ErrHistogramBounds)
+	AddHistogram(ctx context.Context, metricName string, value models.HistogramData) error
+}
+
+// Backfiller optional part of Tx writing samples of the past, e.g. on import.
+// Sample lands in history at ts in time order: gauge current value changes only if ts is not older
+// than its latest point, counter delta is added to current total and to totals of later points.
+type Backfiller interface {
+	SetGaugeAt(ctx context.Context, metricName string, value float64, ts time.Time) error
+	AddCounterAt(ctx context.Context, metricName string, value int64, ts time.Time) error
+}
+
+// HistoryPruner optional part of Storage bounding history: points older than before are removed,
+// current values are kept. Returns number of removed points.
+type HistoryPruner interface {
+	PruneHistory(ctx context.Context, before time.Time) (int, error)
+}
+
+// Tx isolated batch of writes.
+// Nothing is visible to readers until Commit, Rollback discards the batch.
+// Rollback after Commit is harmless and returns ErrTxDone.
+type Tx interface {
+	MetricWriter
+	// SetCounter sets counter to absolute value, e.g. cumulative counter of sender, value is its new running total.
+	// Unlike delta computed from GetCounter before transaction, concurrent writes of the counter aren't lost.
+	SetCounter(ctx context.Context, metricName string, value int64) error
+	// AddGauge adds delta to stored gauge (to 0 if absent), e.g. delta of up-down counter of sender
+	AddGauge(ctx context.Context, metricName string, delta float64) error
+	// AddCumulativeHistogram merges growth of sender total histogram since stored one (see HistogramData.GrowthSince),
+	// the whole value after sender reset. Bounds must match (models.ErrHistogramBounds).
+	AddCumulativeHistogram(ctx context.Context, metricName string, value models.HistogramData) error
+	Commit() error
+	Rollback() error
 }
 
+// Storage contract for metrics backends.
+// Every call is bounded by ctx and reports backend failures through error,
+// missing metrics are reported with ErrNotFound.
+// metricName is series key (models.SeriesKey), so metrics with different labels are stored apart.
 type Storage interface {
-	SetGauge(metricName string, value float64)
-	GetGauge(metricName string) (float64, error)
-	AddCounter(metricName string, value int64)
-	GetCounter(metricName string) (int64, error)
-	GetAll() []MetricDto
-	Close()
+	MetricWriter
+	GetGauge(ctx context.Context, metricName string) (float64, error)
+	GetCounter(ctx context.Context, metricName string) (int64, error)
+	GetHistogram(ctx context.Context, metricName string) (models.HistogramData, error)
+	GetAll(ctx context.Context) ([]MetricDto, error)
+	// EachMetric calls fn for every metric without collecting them all in memory, stops on first error of fn and returns it.
+	// Storage isn't held while fn runs, metrics are read in parts before fn is called for them.
+	EachMetric(ctx context.Context, fn func(MetricDto) error) error
+	GetHistory(ctx context.Context, metricType string, metricName string, from time.Time, to time.Time) ([]HistoryPoint, error)
+	// DeleteMetric removes metric with its history, ErrNotFound if absent
+	DeleteMetric(ctx context.Context, metricType string, metricName string) error
+	// DeleteMetrics removes all metrics which names (labels aside) match shell pattern (path.Match syntax), returns removed count
+	DeleteMetrics(ctx context.Context, pattern string) (int, error)
+	// ResetCounter sets counter to zero keeping its history, ErrNotFound if absent
+	ResetCounter(ctx context.Context, metricName string) error
+	Begin(ctx context.Context) (Tx, error)
+	Close() error
 	PingContext(ctx context.Context) error
-	StartTransaction(ctx context.Context) error
-	CommitTransaction() error
 }
@@ -0,0 +1,127 @@
+// Package router consist batch update of metrics
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// UpdateBatch writes metrics and reports outcome of every one in request order.
+// Atomic batch is stored in one transaction and only if every metric is accepted,
+// otherwise valid metrics are stored one by one and rejected ones are skipped.
+// Error is returned if batch fails as a whole: the first rejected metric of atomic batch
+// or storage failure, metrics not stored because of it are rejected as aborted.
+func UpdateBatch(ctx context.Context, storage repositories.Storage, metrics []models.Metrics, atomic bool) ([]models.UpdateResult, error) {
+	results := make([]models.UpdateResult, len(metrics))
+	var rejected error
+	for i := range metrics {
+		m := &metrics[i]
+		results[i] = models.UpdateResult{ID: m.ID, MType: m.MType, Labels: m.Labels, Status: models.UpdateStored}
+		if err := m.Validate(); err != nil {
+			rejectResult(&results[i], err)
+			if rejected == nil {
+				rejected = err
+			}
+		}
+	}
+
+	if !atomic {
+		for i := range metrics {
+			if results[i].Status == models.UpdateRejected {
+				continue
+			}
+			if err := storeMetric(ctx, storage, &metrics[i]); err != nil {
+				rejectResult(&results[i], err)
+				if errorStatus(err) >= http.StatusInternalServerError {
+					abortResults(results[i+1:], err)
+					return results, err
+				}
+			}
+		}
+		return results, nil
+	}
+
+	if rejected != nil {
+		abortResults(results, rejected)
+		return results, rejected
+	}
+	if err := storeBatch(ctx, storage, metrics, results); err != nil {
+		abortResults(results, err)
+		return results, err
+	}
+	return results, nil
+}
+
+// storeBatch writes valid metrics in one transaction, metric failed to be written is rejected
+func storeBatch(ctx context.Context, storage repositories.Storage, metrics []models.Metrics, results []models.UpdateResult) error {
+	tx, err := storage.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for i := range metrics {
+		if err = storeMetric(ctx, tx, &metrics[i]); err != nil {
+			rejectResult(&results[i], err)
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// StoreMetric validates metric and writes it by its type, used by HTTP and gRPC single metric updates
+func StoreMetric(ctx context.Context, w repositories.MetricWriter, mr *models.Metrics) error {
+	if err := mr.Validate(); err != nil {
+		return err
+	}
+	return storeMetric(ctx, w, mr)
+}
+
+// storeMetric writes valid metric by its type, error names the metric
+func storeMetric(ctx context.Context, w repositories.MetricWriter, mr *models.Metrics) error {
+	var err error
+	switch mr.MType {
+	case models.Gauge:
+		err = w.SetGauge(ctx, mr.Key(), *mr.Value)
+	case models.Counter:
+		err = w.AddCounter(ctx, mr.Key(), *mr.Delta)
+	case models.Histogram:
+		err = w.AddHistogram(ctx, mr.Key(), *mr.Histogram)
+	}
+	if err != nil {
+		return &models.APIError{Code: AsAPIError(err).Code, Metric: mr.ID, Err: fmt.Errorf("update metric %s: %w", mr.ID, err)}
+	}
+	return nil
+}
+
+func rejectResult(r *models.UpdateResult, err error) {
+	r.Status = models.UpdateRejected
+	r.Code = AsAPIError(err).Code
+	r.Reason = err.Error()
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		r.Errors = validationErr.Fields
+	}
+}
+
+// abortResults rejects metrics not rejected yet, they aren't stored because of err
+func abortResults(results []models.UpdateResult, err error) {
+	for i := range results {
+		if results[i].Status == models.UpdateStored {
+			results[i].Status = models.UpdateRejected
+			results[i].Code = models.ErrCodeAborted
+			results[i].Reason = fmt.Sprintf("not stored: %v", err)
+		}
+	}
+}
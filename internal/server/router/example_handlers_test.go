@@ -67,6 +67,165 @@ func Example_getMetricValueHandler() {
 	// Output: Status: 200, Value: 123.45
 }
 
+// Example_getMetricHistoryHandler демонстрирует получение истории значений метрики
+func Example_getMetricHistoryHandler() {
+	r := router.MetricsRouterTest()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, v := range []string{"1", "2", "3"} {
+		resp, err := http.Post(server.URL+"/update/counter/history_hits/"+v, "", nil)
+		if err != nil {
+			fmt.Printf("Ошибка: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}
+
+	from := time.Now().Add(-time.Minute).Unix()
+	resp, err := http.Get(fmt.Sprintf("%s/history/counter/history_hits?from=%d&step=1h", server.URL, from))
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var points []struct {
+		Delta int64 `json:"delta"`
+	}
+	json.NewDecoder(resp.Body).Decode(&points)
+
+	fmt.Printf("Status: %d, Points: %d, Last: %d", resp.StatusCode, len(points), points[len(points)-1].Delta)
+	// Output: Status: 200, Points: 1, Last: 6
+}
+
+// Example_getMetricsListHandler демонстрирует выборку метрик по меткам
+func Example_getMetricsListHandler() {
+	r := router.MetricsRouterTest()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, host := range []string{"web-1", "web-2", "db-1"} {
+		resp, err := http.Post(server.URL+"/update/gauge/cpu_load/0.5?label=host="+host, "", nil)
+		if err != nil {
+			fmt.Printf("Ошибка: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + `/values/?match=host=~"web-.*"`)
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var metrics []struct {
+		Labels map[string]string `json:"labels"`
+	}
+	json.NewDecoder(resp.Body).Decode(&metrics)
+	fmt.Printf("Status: %d, Metrics: %d", resp.StatusCode, len(metrics))
+	// Output: Status: 200, Metrics: 2
+}
+
+// Example_deleteMetricHandler демонстрирует удаление метрики
+func Example_deleteMetricHandler() {
+	r := router.MetricsRouterTest()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/update/gauge/typo_metric/1", "", nil)
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	request, _ := http.NewRequest(http.MethodDelete, server.URL+"/value/gauge/typo_metric", nil)
+	resp, err = http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	resp.Body.Close()
+	deleteStatus := resp.StatusCode
+
+	resp, err = http.Get(server.URL + "/value/gauge/typo_metric")
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	fmt.Printf("Delete: %d, Get: %d", deleteStatus, resp.StatusCode)
+	// Output: Delete: 200, Get: 404
+}
+
+// Example_deleteMetricsHandler демонстрирует удаление метрик по шаблону имени
+func Example_deleteMetricsHandler() {
+	r := router.MetricsRouterTest()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, name := range []string{"host-1", "host-2", "service"} {
+		resp, err := http.Post(server.URL+"/update/gauge/"+name+"/1", "", nil)
+		if err != nil {
+			fmt.Printf("Ошибка: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, server.URL+"/values/?pattern=host-*", nil)
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+
+	fmt.Printf("Status: %d, Body: %s", resp.StatusCode, body.String())
+	// Output: Status: 200, Body: {"deleted":2}
+}
+
+// Example_resetCounterHandler демонстрирует сброс счётчика
+func Example_resetCounterHandler() {
+	r := router.MetricsRouterTest()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/update/counter/requests/42", "", nil)
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	resp, err = http.Post(server.URL+"/reset/requests", "", nil)
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(server.URL + "/value/counter/requests")
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+
+	fmt.Printf("Status: %d, Value: %s", resp.StatusCode, body.String())
+	// Output: Status: 200, Value: 0
+}
+
 // Example_updateMetricHandler демонстрирует обновление метрики через URL параметры
 func Example_updateMetricHandler() {
 	r := router.MetricsRouterTest()
@@ -167,6 +326,41 @@ func Example_updateMetricJSONHandler() {
 	// Output: Status: 200
 }
 
+// Example_updateHistogramJSONHandler демонстрирует отправку гистограммы задержек
+func Example_updateHistogramJSONHandler() {
+	r := router.MetricsRouterTest()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	h := models.NewHistogram([]float64{0.1, 0.5, 1})
+	h.Observe(0.07)
+	h.Observe(0.3)
+	metric := models.Metrics{
+		ID:        "latency",
+		MType:     "histogram",
+		Histogram: &h,
+	}
+
+	jsonData, _ := json.Marshal(metric)
+	resp, err := http.Post(server.URL+"/update/", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	resp.Body.Close()
+	resp, err = http.Post(server.URL+"/update/", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		fmt.Printf("Ошибка: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var result models.Metrics
+	json.NewDecoder(resp.Body).Decode(&result)
+	fmt.Printf("Status: %d, %s", resp.StatusCode, result.Histogram)
+	// Output: Status: 200, count=4 sum=0.74
+}
+
 // Example_updatesMetricJSONHandler демонстрирует пакетное обновление метрик
 func Example_updatesMetricJSONHandler() {
 	r := router.MetricsRouterTest()
@@ -0,0 +1,42 @@
+// Package router consist alerts handler
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/internal/server/alerting"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// AlertSource current alerts, implemented by alerting.Engine
+type AlertSource interface {
+	Alerts() []alerting.Alert
+}
+
+// getAlertsHandler current alerts as json, empty list if alerting is off
+func getAlertsHandler(alerts AlertSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		resp, err := json.Marshal(currentAlerts(alerts))
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
+
+func currentAlerts(alerts AlertSource) []alerting.Alert {
+	if alerts == nil {
+		return []alerting.Alert{}
+	}
+	return alerts.Alerts()
+}
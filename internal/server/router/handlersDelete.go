@@ -0,0 +1,96 @@
+// Package router consist deletion and reset handlers
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// deleteMetricsResponse result of bulk deletion
+type deleteMetricsResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+func deleteMetricHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+
+		metricType := chi.URLParam(r, "metricType")
+		metricName, err := seriesKeyParam(r)
+		if err != nil {
+			writeProblem(w, err, chi.URLParam(r, "metricName"))
+			return
+		}
+
+		err = storage.DeleteMetric(r.Context(), metricType, metricName)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("delete metric %s: %w", metricName, err), metricName)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// deleteMetricsHandler removes metrics by name pattern from ?pattern=, e.g. host-*
+func deleteMetricsHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		pattern := r.URL.Query().Get("pattern")
+		if pattern == "" {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "pattern is empty"), "")
+			return
+		}
+
+		deleted, err := storage.DeleteMetrics(r.Context(), pattern)
+		if errors.Is(err, path.ErrBadPattern) {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "invalid pattern %q: %w", pattern, err), "")
+			return
+		}
+		if err != nil {
+			writeProblem(w, fmt.Errorf("delete metrics %s: %w", pattern, err), "")
+			return
+		}
+
+		resp, err := json.Marshal(deleteMetricsResponse{Deleted: deleted})
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
+
+func resetCounterHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+
+		metricName, err := seriesKeyParam(r)
+		if err != nil {
+			writeProblem(w, err, chi.URLParam(r, "metricName"))
+			return
+		}
+
+		err = storage.ResetCounter(r.Context(), metricName)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("reset counter %s: %w", metricName, err), metricName)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
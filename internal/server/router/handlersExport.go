@@ -0,0 +1,97 @@
+// Package router consist streaming export handler
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+const (
+	exportNDJSON = "ndjson"
+	exportCSV    = "csv"
+)
+
+// exportCSVHeader columns of CSV export, labels are in canonical form a="1",b="2"
+var exportCSVHeader = []string{"id", "type", "value", "labels"}
+
+// getExportHandler streams all metrics as NDJSON (one metric object per line, as in /values/) or CSV
+// while reading them from storage in parts, narrowed by ?match= label matchers.
+// Storage isn't held while metrics are written to slow client (see Storage.EachMetric).
+// Storage failure after the first metric is sent can only cut the stream.
+func getExportHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		matchers, err := labelMatchersParam(r)
+		if err != nil {
+			writeProblem(w, err, "")
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = exportNDJSON
+		}
+
+		var write func(repositories.MetricDto) error
+		header := func() error { return nil }
+		flush := func() error { return nil }
+		switch format {
+		case exportNDJSON:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			write = func(m repositories.MetricDto) error {
+				return enc.Encode(m)
+			}
+		case exportCSV:
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			cw := csv.NewWriter(w)
+			header = func() error {
+				return cw.Write(exportCSVHeader)
+			}
+			write = func(m repositories.MetricDto) error {
+				return cw.Write([]string{m.Name, m.Type, m.Value, m.Labels.String()})
+			}
+			flush = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+		default:
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "unknown export format %q, want %s or %s", format, exportNDJSON, exportCSV), "")
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=metrics.%s", format))
+
+		// CSV header goes with the first metric, so early storage failure still gets proper error status
+		var sent int
+		err = storage.EachMetric(r.Context(), func(m repositories.MetricDto) error {
+			if !models.MatchLabels(matchers, m.Labels) {
+				return nil
+			}
+			if sent == 0 {
+				if err := header(); err != nil {
+					return err
+				}
+			}
+			sent++
+			return write(m)
+		})
+		if err != nil && sent == 0 {
+			w.Header().Del("Content-Disposition")
+			writeProblem(w, fmt.Errorf("get metrics: %w", err), "")
+			return
+		}
+		if err == nil && sent == 0 {
+			err = header()
+		}
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error export metrics: %v", err))
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package router consist Grafana JSON datasource handlers
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/grafana"
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// SampleSource recent samples of metrics, implemented by grafana.Recorder
+type SampleSource interface {
+	Samples(metricType string, seriesKey string, from time.Time, to time.Time) []grafana.Sample
+}
+
+// grafanaRange time range of Grafana panel
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// bounds of range, open end is now
+func (r grafanaRange) bounds() (time.Time, time.Time) {
+	if r.To.IsZero() {
+		return r.From, time.Now()
+	}
+	return r.From, r.To
+}
+
+// grafanaSearchRequest body of /search, target is substring of series key
+type grafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+// grafanaQueryRequest body of /query, target is series key returned by /search
+type grafanaQueryRequest struct {
+	Range   grafanaRange `json:"range"`
+	Targets []struct {
+		Payload struct {
+			Type string `json:"type"` // gauge or counter, both if empty
+		} `json:"payload"`
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	} `json:"targets"`
+	MaxDataPoints int `json:"maxDataPoints"`
+}
+
+// grafanaSeries time series of /query, datapoints are [value, unix milliseconds]
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaAnnotationRequest body of /annotations, query is rule or metric name, all alerts if empty
+type grafanaAnnotationRequest struct {
+	Range      grafanaRange    `json:"range"`
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+// grafanaAnnotation alert activation shown on Grafana panel
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+	Time       int64           `json:"time"`
+}
+
+// grafanaTestHandler answers connection test of datasource
+func grafanaTestHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// grafanaSearchHandler series keys of gauges and counters containing target, sorted
+func grafanaSearchHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req grafanaSearchRequest
+		if !readGrafanaRequest(w, r, &req) {
+			return
+		}
+
+		keys := []string{}
+		err := storage.EachMetric(r.Context(), func(m repositories.MetricDto) error {
+			if m.Type != models.Gauge && m.Type != models.Counter {
+				return nil
+			}
+			if key := models.SeriesKey(m.Name, m.Labels); strings.Contains(key, req.Target) {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			writeProblem(w, fmt.Errorf("get metrics: %w", err), "")
+			return
+		}
+		slices.Sort(keys)
+		writeGrafanaResponse(w, slices.Compact(keys))
+	}
+}
+
+// grafanaQueryHandler recent samples of targets within range, thinned to maxDataPoints.
+// Series is returned for every recorded type of target, no samples are kept without source.
+func grafanaQueryHandler(samples SampleSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req grafanaQueryRequest
+		if !readGrafanaRequest(w, r, &req) {
+			return
+		}
+
+		from, to := req.Range.bounds()
+		result := []grafanaSeries{}
+		for _, t := range req.Targets {
+			if t.Type != "" && t.Type != "timeserie" {
+				writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "unsupported target type %q, want timeserie", t.Type), t.Target)
+				return
+			}
+			types := []string{models.Gauge, models.Counter}
+			switch t.Payload.Type {
+			case "":
+			case models.Gauge, models.Counter:
+				types = []string{t.Payload.Type}
+			default:
+				writeProblem(w, models.NewAPIError(models.ErrCodeInvalidType, "", "unsupported metric type %q", t.Payload.Type), t.Target)
+				return
+			}
+			if samples == nil {
+				result = append(result, grafanaSeries{Target: t.Target, Datapoints: [][2]float64{}})
+				continue
+			}
+			for _, metricType := range types {
+				points := samples.Samples(metricType, models.SeriesKey(models.SplitSeriesKey(t.Target)), from, to)
+				if len(points) == 0 && len(types) > 1 {
+					continue
+				}
+				result = append(result, grafanaSeries{Target: t.Target, Datapoints: grafanaDatapoints(points, req.MaxDataPoints)})
+			}
+		}
+		writeGrafanaResponse(w, result)
+	}
+}
+
+// grafanaDatapoints keeps every n-th sample (the newest included) so no more than limit remain, all if limit is 0
+func grafanaDatapoints(samples []grafana.Sample, limit int) [][2]float64 {
+	step := 1
+	if limit > 0 && len(samples) > limit {
+		step = (len(samples) + limit - 1) / limit
+	}
+	points := make([][2]float64, 0, len(samples)/step+1)
+	for i := (len(samples) - 1) % step; i < len(samples); i += step {
+		points = append(points, [2]float64{samples[i].Value, float64(samples[i].Time.UnixMilli())})
+	}
+	return points
+}
+
+// grafanaAnnotationsHandler alerts activated within range, empty list if alerting is off
+func grafanaAnnotationsHandler(alerts AlertSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req grafanaAnnotationRequest
+		if !readGrafanaRequest(w, r, &req) {
+			return
+		}
+		var annotation struct {
+			Query string `json:"query"`
+		}
+		if len(req.Annotation) > 0 {
+			_ = json.Unmarshal(req.Annotation, &annotation)
+		}
+
+		from, to := req.Range.bounds()
+		result := []grafanaAnnotation{}
+		for _, a := range currentAlerts(alerts) {
+			if a.ActiveAt.Before(from) || a.ActiveAt.After(to) {
+				continue
+			}
+			if annotation.Query != "" && annotation.Query != a.Rule && annotation.Query != a.Metric {
+				continue
+			}
+			result = append(result, grafanaAnnotation{
+				Annotation: req.Annotation,
+				Time:       a.ActiveAt.UnixMilli(),
+				Title:      a.Rule,
+				Text:       fmt.Sprintf("%s: %v %s %v", models.SeriesKey(a.Metric, a.Labels), a.Value, a.Op, a.Threshold),
+				Tags:       []string{string(a.State)},
+			})
+		}
+		writeGrafanaResponse(w, result)
+	}
+}
+
+func readGrafanaRequest(w http.ResponseWriter, r *http.Request, req any) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeProblem(w, bodyReadError(err), "")
+		return false
+	}
+	return true
+}
+
+func writeGrafanaResponse(w http.ResponseWriter, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+		return
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(resp); err != nil {
+		models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+	}
+}
@@ -6,12 +6,30 @@ import (
 	"html/template"
 	"net/http"
 
+	"github.com/Nikolay961996/metsys/internal/server/alerting"
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 )
 
-func getDashboardHandler(storage repositories.Storage) http.HandlerFunc {
+// dashboardData template data of dashboard
+type dashboardData struct {
+	Metrics []repositories.MetricDto
+	Alerts  []alerting.Alert
+}
+
+func getDashboardHandler(storage repositories.Storage, alerts AlertSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		metrics := storage.GetAll()
+		matchers, err := labelMatchersParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metrics, err := storage.GetAll(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error get metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		metrics = filterMetrics(metrics, matchers)
 
 		t, err := template.ParseFiles("./internal/server/router/metrics.html")
 		if err != nil {
@@ -21,7 +39,8 @@ func getDashboardHandler(storage repositories.Storage) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-		if err := t.Execute(w, metrics); err != nil {
+		data := dashboardData{Metrics: metrics, Alerts: currentAlerts(alerts)}
+		if err := t.Execute(w, data); err != nil {
 			http.Error(w, fmt.Sprintf("Error executing template: %v", err), http.StatusInternalServerError)
 			return
 		}
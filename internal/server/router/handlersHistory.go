@@ -0,0 +1,131 @@
+// Package router consist history handlers
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+func getMetricHistoryHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		metricType := chi.URLParam(r, "metricType")
+		metricName, err := seriesKeyParam(r)
+		if err != nil {
+			writeProblem(w, err, chi.URLParam(r, "metricName"))
+			return
+		}
+
+		from, to, step, err := parseHistoryQuery(r)
+		if err != nil {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "%w", err), metricName)
+			return
+		}
+
+		name, labels := models.SplitSeriesKey(metricName)
+		_, err = GetActualMetrics(r.Context(), storage, &models.Metrics{ID: name, MType: metricType, Labels: labels})
+		if err != nil {
+			writeProblem(w, err, metricName)
+			return
+		}
+
+		points, err := storage.GetHistory(r.Context(), metricType, metricName, from, to)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("get history: %w", err), metricName)
+			return
+		}
+
+		resp, err := json.Marshal(downsampleHistory(points, from, step))
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), metricName)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
+
+// parseHistoryQuery reads from/to (RFC3339 or unix seconds) and step (duration or seconds).
+func parseHistoryQuery(r *http.Request) (time.Time, time.Time, time.Duration, error) {
+	q := r.URL.Query()
+	from := time.Unix(0, 0).UTC()
+	to := time.Now().UTC()
+	var step time.Duration
+	var err error
+
+	if v := q.Get("from"); v != "" {
+		from, err = parseHistoryTime(v)
+		if err != nil {
+			return from, to, step, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		to, err = parseHistoryTime(v)
+		if err != nil {
+			return from, to, step, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if v := q.Get("step"); v != "" {
+		step, err = time.ParseDuration(v)
+		if err != nil {
+			seconds, e := strconv.ParseInt(v, 10, 64)
+			if e != nil {
+				return from, to, step, fmt.Errorf("invalid step: %w", err)
+			}
+			step = time.Duration(seconds) * time.Second
+		}
+		if step < 0 {
+			return from, to, step, errors.New("invalid step: negative")
+		}
+	}
+	if to.Before(from) {
+		return from, to, step, errors.New("invalid range: to before from")
+	}
+
+	return from, to, step, nil
+}
+
+func parseHistoryTime(v string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+// downsampleHistory keeps the last point of every step interval counted from "from".
+func downsampleHistory(points []repositories.HistoryPoint, from time.Time, step time.Duration) []repositories.HistoryPoint {
+	if step == 0 || len(points) == 0 {
+		return points
+	}
+
+	r := []repositories.HistoryPoint{}
+	bucket := int64(-1)
+	for _, p := range points {
+		b := int64(p.Timestamp.Sub(from) / step)
+		if b == bucket {
+			r[len(r)-1] = p
+			continue
+		}
+		bucket = b
+		r = append(r, p)
+	}
+	return r
+}
@@ -0,0 +1,322 @@
+// Package router consist bulk import handler
+package router
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+const (
+	importChunkSize    = 1000
+	importMaxChunkSize = 10000
+	importMaxErrors    = 1000
+	importMaxLineSize  = 1 << 20
+	// importMaxSkew allowed drift of sender clock, later samples are rejected as they would hide live writes
+	importMaxSkew = time.Minute
+)
+
+// errBackfillUnsupported storage transaction can't write samples with timestamps
+var errBackfillUnsupported = errors.New("storage doesn't support writes with timestamp")
+
+// importLine parsed line of import, err is set for line which can't be imported
+type importLine struct {
+	err    error
+	ts     time.Time // zero if line has no timestamp, sample is written at import time
+	metric models.Metrics
+	line   int
+}
+
+// importRecord NDJSON line: metric as in /update/ with optional timestamp
+type importRecord struct {
+	models.Metrics
+	Timestamp json.RawMessage `json:"timestamp"`
+}
+
+// importError failed line of import report
+type importError struct {
+	Error string `json:"error"`
+	Line  int    `json:"line"`
+}
+
+// importReport result of import, lines are numbered from 1 (CSV header included).
+// Errors are capped at importMaxErrors, Failed counts them all.
+type importReport struct {
+	Errors   []importError `json:"errors"`
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+}
+
+func (r *importReport) fail(line int, err error) {
+	r.Failed++
+	if len(r.Errors) < importMaxErrors {
+		r.Errors = append(r.Errors, importError{Line: line, Error: err.Error()})
+	}
+}
+
+// importHandler loads NDJSON or CSV of {id,type,value|delta,timestamp} while reading request.
+// Every chunk of lines is written in own transaction, so failed storage write loses only its chunk.
+// Bad lines are skipped and listed in report, import stops on storage failure or unreadable body.
+func importHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chunkSize := importChunkSize
+		if v := r.URL.Query().Get("chunk"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > importMaxChunkSize {
+				writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "invalid chunk %q, want 1..%d", v, importMaxChunkSize), "")
+				return
+			}
+			chunkSize = n
+		}
+
+		var next func() (importLine, error)
+		switch importFormat(r) {
+		case exportNDJSON:
+			next = ndjsonImportLines(r.Body)
+		case exportCSV:
+			next = csvImportLines(r.Body)
+		default:
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "unknown import format, want %s or %s", exportNDJSON, exportCSV), "")
+			return
+		}
+
+		report := importReport{Errors: []importError{}}
+		status := http.StatusOK
+		chunk := make([]importLine, 0, chunkSize)
+		now := time.Now()
+		for {
+			l, err := next()
+			if err != nil && !errors.Is(err, io.EOF) {
+				report.fail(l.line, err)
+				status = bodyReadStatus(err)
+			}
+			if err == nil {
+				if l.err == nil {
+					l.err = validateImportLine(l, now)
+				}
+				if l.err != nil {
+					report.fail(l.line, l.err)
+				} else {
+					chunk = append(chunk, l)
+				}
+			}
+
+			if len(chunk) > 0 && (err != nil || len(chunk) == chunkSize) {
+				if werr := writeImportChunk(r.Context(), storage, chunk); werr != nil {
+					models.Log.Error(fmt.Sprintf("Error import metrics: %v", werr))
+					for _, c := range chunk {
+						report.fail(c.line, werr)
+					}
+					status = errorStatus(werr)
+					break
+				}
+				report.Imported += len(chunk)
+				chunk = chunk[:0]
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		resp, err := json.Marshal(report)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		if _, err = w.Write(resp); err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
+
+// importFormat ?format= or content type of body, NDJSON by default
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		return exportCSV
+	}
+	return exportNDJSON
+}
+
+// ndjsonImportLines reads one metric object per line, empty lines are skipped
+func ndjsonImportLines(body io.Reader) func() (importLine, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), importMaxLineSize)
+	var n int
+	return func() (importLine, error) {
+		for scanner.Scan() {
+			n++
+			raw := strings.TrimSpace(scanner.Text())
+			if raw == "" {
+				continue
+			}
+			l := importLine{line: n}
+			var rec importRecord
+			if l.err = json.Unmarshal([]byte(raw), &rec); l.err != nil {
+				return l, nil
+			}
+			l.metric = rec.Metrics
+			l.ts, l.err = parseImportTimestamp(rec.Timestamp)
+			return l, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return importLine{line: n + 1}, err
+		}
+		return importLine{}, io.EOF
+	}
+}
+
+// csvImportLines reads CSV with header naming columns: id, type, value, delta, timestamp, labels.
+// Counter takes delta column or value column if delta is empty, so /export output can be imported.
+func csvImportLines(body io.Reader) func() (importLine, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	var columns map[string]int
+	return func() (importLine, error) {
+		for {
+			record, err := reader.Read()
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return importLine{line: parseErr.Line, err: err}, nil
+			}
+			if errors.Is(err, io.EOF) && columns == nil {
+				return importLine{line: 1}, errors.New("no CSV header")
+			}
+			if err != nil {
+				line, _ := reader.FieldPos(0)
+				return importLine{line: line}, err
+			}
+			line, _ := reader.FieldPos(0)
+
+			if columns == nil {
+				columns = map[string]int{}
+				for i, name := range record {
+					columns[strings.ToLower(strings.TrimSpace(name))] = i
+				}
+				if _, ok := columns["id"]; !ok {
+					return importLine{line: line}, errors.New("CSV header has no id column")
+				}
+				if _, ok := columns["type"]; !ok {
+					return importLine{line: line}, errors.New("CSV header has no type column")
+				}
+				continue
+			}
+
+			field := func(name string) string {
+				if i, ok := columns[name]; ok && i < len(record) {
+					return strings.TrimSpace(record[i])
+				}
+				return ""
+			}
+			l := importLine{line: line, metric: models.Metrics{ID: field("id"), MType: field("type")}}
+			if labels := field("labels"); labels != "" {
+				if l.metric.Labels, l.err = models.ParseLabels(labels); l.err != nil {
+					return l, nil
+				}
+			}
+			switch l.metric.MType {
+			case models.Gauge:
+				if v := field("value"); v != "" {
+					value, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						l.err = fmt.Errorf("invalid value %q", v)
+						return l, nil
+					}
+					l.metric.Value = &value
+				}
+			case models.Counter:
+				d := field("delta")
+				if d == "" {
+					d = field("value")
+				}
+				if d != "" {
+					delta, err := strconv.ParseInt(d, 10, 64)
+					if err != nil {
+						l.err = fmt.Errorf("invalid delta %q", d)
+						return l, nil
+					}
+					l.metric.Delta = &delta
+				}
+			}
+			if ts := field("timestamp"); ts != "" {
+				l.ts, l.err = parseHistoryTime(ts)
+			}
+			return l, nil
+		}
+	}
+}
+
+// parseImportTimestamp unix seconds (number, fractions allowed) or string as in /history/
+func parseImportTimestamp(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Time{}, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return parseHistoryTime(s)
+	}
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %s", raw)
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
+
+func validateImportLine(l importLine, now time.Time) error {
+	switch {
+	case l.metric.MType == models.Histogram:
+		return errors.New("histogram import is not supported")
+	case l.ts.After(now.Add(importMaxSkew)):
+		return fmt.Errorf("timestamp %s is in the future", l.ts.Format(time.RFC3339))
+	}
+	return l.metric.Validate()
+}
+
+func writeImportChunk(ctx context.Context, storage repositories.Storage, chunk []importLine) error {
+	tx, err := storage.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	backfill, _ := tx.(repositories.Backfiller)
+	for _, l := range chunk {
+		key := l.metric.Key()
+		switch {
+		case l.ts.IsZero() && l.metric.MType == models.Gauge:
+			err = tx.SetGauge(ctx, key, *l.metric.Value)
+		case l.ts.IsZero():
+			err = tx.AddCounter(ctx, key, *l.metric.Delta)
+		case backfill == nil:
+			err = errBackfillUnsupported
+		case l.metric.MType == models.Gauge:
+			err = backfill.SetGaugeAt(ctx, key, *l.metric.Value, l.ts)
+		default:
+			err = backfill.AddCounterAt(ctx, key, *l.metric.Delta, l.ts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
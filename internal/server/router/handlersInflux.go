@@ -0,0 +1,76 @@
+// Package router consist InfluxDB line protocol handlers
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Nikolay961996/metsys/internal/server/influx"
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// influxWriteHandler accepts InfluxDB line protocol (Telegraf outputs.influxdb).
+// Every field becomes metric named by template: integer fields matched by counters are counters
+// keeping sender value, other numeric and boolean fields are gauges. String fields and fields
+// with metric ID longer than allowed are skipped, so other fields are still stored.
+func influxWriteHandler(storage repositories.Storage, template influx.Template, counters influx.Counters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProblem(w, bodyReadError(err), "")
+			return
+		}
+		points, err := influx.ParseLines(string(body))
+		if err != nil {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "parse line protocol: %w", err), "")
+			return
+		}
+
+		samples := map[string]*ingestSample{}
+		for i := range points {
+			p := &points[i]
+			for _, f := range p.Fields {
+				var metricType string
+				switch f.Type {
+				case influx.Float, influx.Boolean:
+					metricType = models.Gauge
+				case influx.Integer, influx.Unsigned:
+					metricType = models.Gauge
+					if counters.Match(p.Measurement, f.Key) {
+						metricType = models.Counter
+					}
+				default:
+					continue
+				}
+				id := template.MetricID(p, f.Key)
+				if len(id) > models.MaxMetricNameLength {
+					models.Log.Warn(fmt.Sprintf("Skip field %s of %s: metric ID longer than %d bytes", f.Key, p.Measurement, models.MaxMetricNameLength))
+					continue
+				}
+				addLatestSample(samples, models.Metrics{ID: id, MType: metricType}, f.Value, p.Timestamp)
+			}
+		}
+
+		if !writeLatestSamples(r.Context(), w, storage, samples) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// influxQueryHandler answers CREATE DATABASE sent by Telegraf on start, other queries aren't supported
+func influxQueryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.FormValue("q"))
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+		if !strings.HasPrefix(strings.ToUpper(q), "CREATE DATABASE") {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte(`{"error":"only CREATE DATABASE is supported"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	}
+}
@@ -0,0 +1,90 @@
+// Package router consist helpers shared by ingestion protocol handlers
+package router
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// ingestSample latest sample of series received by ingestion protocol
+type ingestSample struct {
+	metric    models.Metrics
+	value     float64
+	timestamp int64
+}
+
+// addLatestSample keeps sample unless newer one of the same series is already there
+func addLatestSample(samples map[string]*ingestSample, metric models.Metrics, value float64, timestamp int64) {
+	key := metric.MType + "/" + metric.Key()
+	if prev, ok := samples[key]; ok && prev.timestamp > timestamp {
+		return
+	}
+	metric.Value = &value
+	samples[key] = &ingestSample{metric: metric, value: value, timestamp: timestamp}
+}
+
+// maxReportedSkips counters named in response about skipped samples
+const maxReportedSkips = 10
+
+// writeLatestSamples stores samples in one transaction.
+// Counters are absolute values on sender side, so stored counter is set equal to them.
+// Counter samples which aren't integer are skipped, the rest is stored and client gets 400 naming them.
+func writeLatestSamples(ctx context.Context, w http.ResponseWriter, storage repositories.Storage, samples map[string]*ingestSample) bool {
+	tx, err := storage.Begin(ctx)
+	if err != nil {
+		writeProblem(w, fmt.Errorf("start transaction: %w", err), "")
+		return false
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var skipped []string
+	for _, s := range samples {
+		if s.metric.MType != models.Counter {
+			if !updateMetrics(ctx, w, tx, &s.metric) {
+				return false
+			}
+			continue
+		}
+		total, ok := counterValue(s.value)
+		if !ok {
+			models.Log.Warn(fmt.Sprintf("Skip counter %s: value %v isn't integer", s.metric.Key(), s.value))
+			skipped = append(skipped, fmt.Sprintf("%s=%v", s.metric.Key(), s.value))
+			continue
+		}
+		s.metric.Value, s.metric.Delta = nil, &total
+		if err = s.metric.Validate(); err == nil {
+			err = tx.SetCounter(ctx, s.metric.Key(), total)
+		}
+		if err != nil {
+			writeProblem(w, err, s.metric.ID)
+			return false
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeProblem(w, fmt.Errorf("commit transaction: %w", err), "")
+		return false
+	}
+	if len(skipped) > 0 {
+		writeProblem(w, models.NewAPIError(models.ErrCodeInvalidValue, "", "%d counter samples aren't integer and weren't stored, other samples are stored: %s",
+			len(skipped), strings.Join(skipped[:min(len(skipped), maxReportedSkips)], ", ")), "")
+		return false
+	}
+	return true
+}
+
+// counterValue v as counter total, false if v is fractional or out of int64 range
+func counterValue(v float64) (int64, bool) {
+	if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(v), true
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/models"
@@ -15,13 +16,15 @@ import (
 
 func isCorrectMethod(expectedMethod string, w http.ResponseWriter, r *http.Request) bool {
 	if r.Method != http.MethodPost {
-		http.Error(w, fmt.Sprintf("Only %s method allowed", expectedMethod), http.StatusMethodNotAllowed)
+		writeProblem(w, models.NewAPIError(models.ErrCodeMethodNotAllowed, "", "only %s method allowed", expectedMethod), "")
 		return false
 	}
 	return true
 }
 
-func baseJSONHandler(w http.ResponseWriter, r *http.Request, storage repositories.Storage, innerFunc func(http.ResponseWriter, repositories.Storage, *models.Metrics) bool) {
+var errMetricTypeNotFound = errors.New("metric type not found")
+
+func baseJSONHandler(w http.ResponseWriter, r *http.Request, storage repositories.Storage, innerFunc func(context.Context, http.ResponseWriter, repositories.MetricWriter, *models.Metrics) bool) {
 	w.Header().Set("content-type", "application/json; charset=utf-8")
 	if !isCorrectMethod(http.MethodPost, w, r) {
 		return
@@ -32,16 +35,15 @@ func baseJSONHandler(w http.ResponseWriter, r *http.Request, storage repositorie
 	}
 
 	if innerFunc != nil {
-		ok := innerFunc(w, storage, mr)
+		ok := innerFunc(r.Context(), w, storage, mr)
 		if !ok {
 			return
 		}
 	}
 
-	actualMr, err := GetActualMetrics(storage, mr)
+	actualMr, err := GetActualMetrics(r.Context(), storage, mr)
 	if err != nil {
-		models.Log.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeProblem(w, err, mr.ID)
 		return
 	}
 
@@ -60,7 +62,9 @@ func updateMetricJSONHandler(storage repositories.Storage) http.HandlerFunc {
 	}
 }
 
-func updatesMetricJSONHandler(storage repositories.Storage) http.HandlerFunc {
+// updatesMetricJSONHandler stores batch and reports outcome of every metric,
+// atomic=false stores valid metrics even if others are rejected, batch longer than maxBatchSize is rejected with 413
+func updatesMetricJSONHandler(storage repositories.Storage, maxBatchSize int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		models.Log.Info("Get batch metrics")
 		w.Header().Set("content-type", "application/json; charset=utf-8")
@@ -72,66 +76,81 @@ func updatesMetricJSONHandler(storage repositories.Storage) http.HandlerFunc {
 			return
 		}
 		models.Log.Info(fmt.Sprintf("Batch: %v", mrs))
-
-		ctx := context.Background()
-		err := storage.StartTransaction(ctx)
-		if err != nil {
-			models.Log.Error(fmt.Sprintf("Error start transaction: %v", err))
-			http.Error(w, fmt.Sprintf("Error start transaction: %v", err), http.StatusBadRequest)
+		if err := CheckBatchSize(len(mrs), maxBatchSize); err != nil {
+			writeProblem(w, err, "")
 			return
 		}
-		for _, mr := range mrs {
-			_ = updateMetrics(w, storage, &mr)
-		}
 
-		err = storage.CommitTransaction()
+		atomic := true
+		if v := r.URL.Query().Get("atomic"); v != "" {
+			var err error
+			if atomic, err = strconv.ParseBool(v); err != nil {
+				writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "invalid atomic %q: %w", v, err), "")
+				return
+			}
+		}
 
+		results, err := UpdateBatch(r.Context(), storage, mrs, atomic)
 		if err != nil {
-			models.Log.Error(fmt.Sprintf("Error commit transaction: %v", err))
-			http.Error(w, fmt.Sprintf("Error commit transaction: %v", err), http.StatusBadRequest)
+			p := newProblem(err, "")
+			p.Results = results
+			writeProblemDocument(w, p)
 			return
 		}
 
+		resp, err := json.Marshal(models.BatchResponse{Results: results})
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
 		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(resp); err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
 	}
 }
 
-func GetActualMetrics(storage repositories.Storage, mr *models.Metrics) (*models.Metrics, error) {
+func GetActualMetrics(ctx context.Context, storage repositories.Storage, mr *models.Metrics) (*models.Metrics, error) {
 	var actual = models.Metrics{
-		ID:    mr.ID,
-		MType: mr.MType,
-		Value: nil,
-		Delta: nil,
+		ID:     mr.ID,
+		MType:  mr.MType,
+		Labels: mr.Labels,
+		Value:  nil,
+		Delta:  nil,
+	}
+	if err := mr.Labels.Validate(); err != nil {
+		return nil, err
 	}
 
 	switch mr.MType {
 	case models.Gauge:
-		v, err := storage.GetGauge(mr.ID)
+		v, err := storage.GetGauge(ctx, mr.Key())
 		if err != nil {
-			return nil, errors.New("metric not found")
+			return nil, err
 		}
 		actual.Value = &v
 	case models.Counter:
-		v, err := storage.GetCounter(mr.ID)
+		v, err := storage.GetCounter(ctx, mr.Key())
 		if err != nil {
-			return nil, errors.New("metric not found")
+			return nil, err
 		}
 		actual.Delta = &v
+	case models.Histogram:
+		v, err := storage.GetHistogram(ctx, mr.Key())
+		if err != nil {
+			return nil, err
+		}
+		actual.Histogram = &v
 	default:
-		return nil, errors.New("metric type not found")
+		return nil, errMetricTypeNotFound
 	}
 
 	return &actual, nil
 }
 
-func updateMetrics(w http.ResponseWriter, storage repositories.Storage, mr *models.Metrics) bool {
-	if mr.MType == models.Gauge {
-		storage.SetGauge(mr.ID, *mr.Value)
-	} else if mr.MType == models.Counter {
-		storage.AddCounter(mr.ID, *mr.Delta)
-	} else {
-		models.Log.Error(fmt.Sprintf("Error undefind type: %v", mr.MType))
-		http.Error(w, fmt.Sprintf("Error unmarshalling body: %v", mr.MType), http.StatusBadRequest)
+func updateMetrics(ctx context.Context, w http.ResponseWriter, storage repositories.MetricWriter, mr *models.Metrics) bool {
+	if err := StoreMetric(ctx, storage, mr); err != nil {
+		writeProblem(w, err, mr.ID)
 		return false
 	}
 
@@ -141,8 +160,7 @@ func updateMetrics(w http.ResponseWriter, storage repositories.Storage, mr *mode
 func writeJSONMetrics(w http.ResponseWriter, metrics *models.Metrics) {
 	resp, err := json.Marshal(metrics)
 	if err != nil {
-		models.Log.Error(fmt.Sprintf("Error marshalling body: %v", err))
-		http.Error(w, fmt.Sprintf("Error marshalling body: %v", err), http.StatusInternalServerError)
+		writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
 		return
 	}
 
@@ -160,14 +178,12 @@ func readJSONMetrics(w http.ResponseWriter, r *http.Request) *models.Metrics {
 	defer r.Body.Close()
 
 	if err != nil {
-		models.Log.Error(fmt.Sprintf("Error reading body: %v", err))
-		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		writeProblem(w, bodyReadError(err), "")
 		return nil
 	}
 
 	if err := json.Unmarshal(buf.Bytes(), &mr); err != nil {
-		models.Log.Error(fmt.Sprintf("Error unmarshalling body: %v", err))
-		http.Error(w, fmt.Sprintf("Error unmarshalling body: %v", err), http.StatusBadRequest)
+		writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "unmarshal body: %w", err), "")
 		return nil
 	}
 
@@ -181,14 +197,12 @@ func readJSONMetricsArray(w http.ResponseWriter, r *http.Request) []models.Metri
 	defer r.Body.Close()
 
 	if err != nil {
-		models.Log.Error(fmt.Sprintf("Error reading body: %v", err))
-		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		writeProblem(w, bodyReadError(err), "")
 		return nil
 	}
 
 	if err := json.Unmarshal(buf.Bytes(), &mr); err != nil {
-		models.Log.Error(fmt.Sprintf("Error unmarshalling body: %v", err))
-		http.Error(w, fmt.Sprintf("Error unmarshalling body: %v", err), http.StatusBadRequest)
+		writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "unmarshal body: %w", err), "")
 		return nil
 	}
 
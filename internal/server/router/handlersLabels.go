@@ -0,0 +1,92 @@
+// Package router consist label helpers and labeled listing handler
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// seriesKeyParam series key from {metricName} and repeated ?label=name=value
+func seriesKeyParam(r *http.Request) (string, error) {
+	labels := models.Labels{}
+	for _, l := range r.URL.Query()["label"] {
+		name, value, ok := strings.Cut(l, "=")
+		if !ok {
+			return "", fmt.Errorf("%w: label %q", models.ErrInvalidLabels, l)
+		}
+		labels[name] = value
+	}
+	if err := labels.Validate(); err != nil {
+		return "", err
+	}
+	return models.SeriesKey(chi.URLParam(r, "metricName"), labels), nil
+}
+
+// labelMatchersParam matchers from repeated ?match=, e.g. match=host=a&match=region=~"eu-.*"
+func labelMatchersParam(r *http.Request) ([]models.LabelMatcher, error) {
+	var matchers []models.LabelMatcher
+	for _, s := range r.URL.Query()["match"] {
+		m, err := models.ParseLabelMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// filterMetrics metrics which labels satisfy all matchers
+func filterMetrics(metrics []repositories.MetricDto, matchers []models.LabelMatcher) []repositories.MetricDto {
+	if len(matchers) == 0 {
+		return metrics
+	}
+	r := []repositories.MetricDto{}
+	for _, m := range metrics {
+		if models.MatchLabels(matchers, m.Labels) {
+			r = append(r, m)
+		}
+	}
+	return r
+}
+
+// getMetricsListHandler all metrics as json, narrowed by ?match= label matchers
+func getMetricsListHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		matchers, err := labelMatchersParam(r)
+		if err != nil {
+			writeProblem(w, err, "")
+			return
+		}
+
+		metrics, err := storage.GetAll(r.Context())
+		if err != nil {
+			writeProblem(w, fmt.Errorf("get metrics: %w", err), "")
+			return
+		}
+		metrics = filterMetrics(metrics, matchers)
+		if metrics == nil {
+			metrics = []repositories.MetricDto{}
+		}
+
+		resp, err := json.Marshal(metrics)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package router consist webhook deliveries handler
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// DeliverySource recent webhook deliveries, implemented by notifier.Notifier
+type DeliverySource interface {
+	Deliveries() []notifier.Delivery
+}
+
+// getNotificationsHandler delivery status of operational events as json
+func getNotificationsHandler(deliveries DeliverySource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		result := []notifier.Delivery{}
+		if deliveries != nil {
+			result = deliveries.Deliveries()
+		}
+		resp, err := json.Marshal(result)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
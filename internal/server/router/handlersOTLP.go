@@ -0,0 +1,84 @@
+// Package router consist OTLP/HTTP metrics handler
+package router
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Nikolay961996/metsys/internal/server/otlp"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+const (
+	otlpProtobuf = "application/x-protobuf"
+	otlpJSON     = "application/json"
+)
+
+// otlpMetricsHandler OTLP/HTTP metrics export, protobuf or JSON encoded.
+// Response and error status are encoded like request, as OTLP specification requires.
+func otlpMetricsHandler(receiver *otlp.Receiver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		var unmarshal func([]byte, proto.Message) error
+		var marshal func(proto.Message) ([]byte, error)
+		switch contentType {
+		case otlpProtobuf:
+			unmarshal, marshal = proto.Unmarshal, proto.Marshal
+		case otlpJSON:
+			unmarshal, marshal = protojson.Unmarshal, protojson.Marshal
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("content-type", contentType)
+
+		writeStatus := func(httpStatus int, code codes.Code, err error) {
+			models.Log.Error(fmt.Sprintf("Error OTLP export: %v", err))
+			body, _ := marshal(status.New(code, err.Error()).Proto())
+			w.WriteHeader(httpStatus)
+			_, _ = w.Write(body)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			code := codes.InvalidArgument
+			if bodyReadStatus(err) == http.StatusRequestEntityTooLarge {
+				code = codes.ResourceExhausted
+			}
+			writeStatus(bodyReadStatus(err), code, err)
+			return
+		}
+		var req colmetricspb.ExportMetricsServiceRequest
+		if err = unmarshal(body, &req); err != nil {
+			writeStatus(http.StatusBadRequest, codes.InvalidArgument, err)
+			return
+		}
+
+		resp, err := receiver.Write(r.Context(), &req)
+		if err != nil {
+			httpStatus := errorStatus(err)
+			code := codes.Internal
+			if httpStatus == http.StatusBadRequest {
+				code = codes.InvalidArgument
+			}
+			writeStatus(httpStatus, code, err)
+			return
+		}
+
+		out, err := marshal(resp)
+		if err != nil {
+			writeStatus(http.StatusInternalServerError, codes.Internal, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(out)
+	}
+}
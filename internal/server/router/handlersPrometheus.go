@@ -0,0 +1,152 @@
+// Package router consist prometheus exposition handler
+package router
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// getPrometheusMetricsHandler all stored metrics in Prometheus text format,
+// OpenMetrics when client asks for it in Accept
+func getPrometheusMetricsHandler(storage repositories.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := storage.GetAll(r.Context())
+		if err != nil {
+			writeProblem(w, fmt.Errorf("get metrics: %w", err), "")
+			return
+		}
+
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("content-type", openMetricsContentType)
+		} else {
+			w.Header().Set("content-type", prometheusContentType)
+		}
+		w.WriteHeader(http.StatusOK)
+
+		if err = writeExposition(w, metrics, openMetrics); err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
+
+// writeExposition renders metrics grouped into families by sanitized name.
+// Metric which sanitized name is taken by metric of other type is skipped.
+func writeExposition(out io.Writer, metrics []repositories.MetricDto, openMetrics bool) error {
+	type sample struct {
+		metric repositories.MetricDto
+		name   string
+	}
+	samples := make([]sample, 0, len(metrics))
+	for _, m := range metrics {
+		samples = append(samples, sample{metric: m, name: sanitizeMetricName(m.Name)})
+	}
+	slices.SortFunc(samples, func(a, b sample) int {
+		return cmp.Or(
+			cmp.Compare(a.name, b.name),
+			cmp.Compare(a.metric.Type, b.metric.Type),
+			cmp.Compare(a.metric.Labels.String(), b.metric.Labels.String()),
+		)
+	})
+
+	w := bufio.NewWriter(out)
+	family, familyType := "", ""
+	for _, s := range samples {
+		name := s.name
+		if openMetrics && s.metric.Type == models.Counter {
+			name = strings.TrimSuffix(name, "_total")
+		}
+		if name == family && s.metric.Type != familyType {
+			models.Log.Warn(fmt.Sprintf("Metric %s of type %s clashes with %s %s, skipped", s.metric.Name, s.metric.Type, familyType, family))
+			continue
+		}
+		if name != family {
+			family, familyType = name, s.metric.Type
+			fmt.Fprintf(w, "# TYPE %s %s\n", family, s.metric.Type)
+		}
+
+		labels := s.metric.Labels
+		switch s.metric.Type {
+		case models.Counter:
+			if openMetrics {
+				name += "_total"
+			}
+			writeSample(w, name, labels, "", "", s.metric.Value)
+		case models.Gauge:
+			writeSample(w, name, labels, "", "", s.metric.Value)
+		case models.Histogram:
+			if s.metric.Histogram == nil {
+				continue
+			}
+			var cumulative uint64
+			for _, b := range s.metric.Histogram.Buckets() {
+				cumulative += b.Count
+				writeSample(w, name+"_bucket", labels, "le", b.UpperBound, fmt.Sprint(cumulative))
+			}
+			writeSample(w, name+"_sum", labels, "", "", fmt.Sprint(s.metric.Histogram.Sum))
+			writeSample(w, name+"_count", labels, "", "", fmt.Sprint(s.metric.Histogram.Count))
+		}
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+	return w.Flush()
+}
+
+// writeSample one line: name{labels,extra="value"} value
+func writeSample(w *bufio.Writer, name string, labels models.Labels, extraName string, extraValue string, value string) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, k := range slices.Sorted(maps.Keys(labels)) {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, k, escapeLabelValue(labels[k]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraName, escapeLabelValue(extraValue))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+// sanitizeMetricName replaces characters not allowed in Prometheus metric name with "_"
+func sanitizeMetricName(id string) string {
+	name := strings.Map(func(c rune) rune {
+		if c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			return c
+		}
+		return '_'
+	}, id)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return "_" + name
+	}
+	return name
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
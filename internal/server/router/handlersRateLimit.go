@@ -0,0 +1,34 @@
+// Package router consist rate limiting status handler
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/internal/server/ratelimit"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// getRateLimitHandler throttling counters of rate limit rules as json, empty list if rate limiting is off
+func getRateLimitHandler(limiter RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		result := []ratelimit.RuleStats{}
+		if limiter != nil {
+			result = limiter.Stats()
+		}
+		resp, err := json.Marshal(result)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("marshal body: %w", err), "")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+		}
+	}
+}
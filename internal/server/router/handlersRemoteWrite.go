@@ -0,0 +1,156 @@
+// Package router consist prometheus remote write handler
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+	"github.com/Nikolay961996/metsys/proto/prompb"
+)
+
+// maxRemoteFamilies metric families which types are kept, metadata of new families over it is ignored
+const maxRemoteFamilies = 10000
+
+// remoteFamilies metric types from remote write metadata.
+// Prometheus sends metadata apart from samples, so types are kept between requests.
+type remoteFamilies struct {
+	types map[string]prompb.MetricMetadata_MetricType
+	mu    sync.RWMutex
+}
+
+func (f *remoteFamilies) update(metadata []*prompb.MetricMetadata) {
+	if len(metadata) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ignored := 0
+	for _, md := range metadata {
+		name := md.GetMetricFamilyName()
+		if _, ok := f.types[name]; !ok && len(f.types) >= maxRemoteFamilies {
+			ignored++
+			continue
+		}
+		f.types[name] = md.GetType()
+	}
+	if ignored > 0 {
+		models.Log.Warn(fmt.Sprintf("Remote write metadata of %d families ignored: %d families are known already", ignored, maxRemoteFamilies))
+	}
+}
+
+func (f *remoteFamilies) get(name string) (prompb.MetricMetadata_MetricType, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	t, ok := f.types[name]
+	return t, ok
+}
+
+// remoteWriteHandler accepts Prometheus remote write requests (snappy compressed protobuf).
+// Every series is stored by its latest sample: counters keep remote value as is,
+// other series are stored as gauges. Stale markers (NaN) are skipped.
+// Body decoding to more than maxDecompressedSize bytes is rejected with 413, no limit if 0.
+func remoteWriteHandler(storage repositories.Storage, maxDecompressedSize int64) http.HandlerFunc {
+	families := &remoteFamilies{types: map[string]prompb.MetricMetadata_MetricType{}}
+	return func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProblem(w, bodyReadError(err), "")
+			return
+		}
+		if n, err := snappy.DecodedLen(compressed); err == nil && maxDecompressedSize > 0 && int64(n) > maxDecompressedSize {
+			writeProblem(w, models.NewAPIError(models.ErrCodeTooLarge, "", "decompressed body of %d bytes is larger than %d bytes", n, maxDecompressedSize), "")
+			return
+		}
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "decompress body: %w", err), "")
+			return
+		}
+		var req prompb.WriteRequest
+		if err = proto.Unmarshal(body, &req); err != nil {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "unmarshal body: %w", err), "")
+			return
+		}
+
+		families.update(req.GetMetadata())
+		samples, err := latestSamples(&req, families)
+		if err != nil {
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "remote write series: %w", err), "")
+			return
+		}
+
+		if !writeLatestSamples(r.Context(), w, storage, samples) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// latestSamples maps series of request onto metrics keeping the newest sample of each series
+func latestSamples(req *prompb.WriteRequest, families *remoteFamilies) (map[string]*ingestSample, error) {
+	samples := map[string]*ingestSample{}
+	for _, ts := range req.GetTimeseries() {
+		var name string
+		labels := models.Labels{}
+		for _, l := range ts.GetLabels() {
+			if l.GetName() == "__name__" {
+				name = l.GetValue()
+			} else {
+				labels[l.GetName()] = l.GetValue()
+			}
+		}
+		if name == "" {
+			return nil, errors.New("series without __name__ label")
+		}
+		if err := labels.Validate(); err != nil {
+			return nil, fmt.Errorf("series %s: %w", name, err)
+		}
+		if len(labels) == 0 {
+			labels = nil
+		}
+
+		metricType := remoteMetricType(name, families)
+		for _, s := range ts.GetSamples() {
+			if math.IsNaN(s.GetValue()) {
+				continue
+			}
+			addLatestSample(samples, models.Metrics{ID: name, MType: metricType, Labels: labels}, s.GetValue(), s.GetTimestamp())
+		}
+	}
+	return samples, nil
+}
+
+// remoteMetricType counter for counter families and cumulative parts of histograms and summaries,
+// gauge otherwise. Without metadata "_total" suffix marks counter.
+func remoteMetricType(name string, families *remoteFamilies) string {
+	if t, ok := families.get(name); ok {
+		if t == prompb.MetricMetadata_COUNTER {
+			return models.Counter
+		}
+		return models.Gauge
+	}
+	if base, ok := strings.CutSuffix(name, "_total"); ok {
+		if t, ok := families.get(base); !ok || t == prompb.MetricMetadata_COUNTER {
+			return models.Counter
+		}
+	}
+	for _, suffix := range []string{"_bucket", "_count"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			switch t, _ := families.get(base); t {
+			case prompb.MetricMetadata_HISTOGRAM, prompb.MetricMetadata_SUMMARY:
+				return models.Counter
+			}
+		}
+	}
+	return models.Gauge
+}
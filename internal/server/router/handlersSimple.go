@@ -3,7 +3,8 @@ package router
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -18,10 +19,10 @@ import (
 
 func pingDatabase(storage repositories.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 		if err := storage.PingContext(ctx); err != nil {
-			http.Error(w, "", http.StatusInternalServerError)
+			writeProblem(w, fmt.Errorf("ping storage: %w", err), "")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -33,33 +34,48 @@ func getMetricValueHandler(storage repositories.Storage) http.HandlerFunc {
 		w.Header().Set("content-type", "text/plain; charset=utf-8")
 
 		metricType := chi.URLParam(r, "metricType")
-		metricName := chi.URLParam(r, "metricName")
+		metricName, err := seriesKeyParam(r)
+		if err != nil {
+			writeProblem(w, err, chi.URLParam(r, "metricName"))
+			return
+		}
 
 		var result string
 		switch metricType {
 		case models.Gauge:
-			v, err := storage.GetGauge(metricName)
+			v, err := storage.GetGauge(r.Context(), metricName)
 			if err != nil {
-				w.WriteHeader(http.StatusNotFound)
+				writeProblem(w, err, metricName)
 				return
 			}
 			result = strconv.FormatFloat(v, 'f', -1, 64)
 		case models.Counter:
-			v, err := storage.GetCounter(metricName)
+			v, err := storage.GetCounter(r.Context(), metricName)
 			if err != nil {
-				w.WriteHeader(http.StatusNotFound)
+				writeProblem(w, err, metricName)
 				return
 			}
 			result = strconv.FormatInt(v, 10)
+		case models.Histogram:
+			v, err := storage.GetHistogram(r.Context(), metricName)
+			if err != nil {
+				writeProblem(w, err, metricName)
+				return
+			}
+			d, err := json.Marshal(v)
+			if err != nil {
+				writeProblem(w, err, metricName)
+				return
+			}
+			result = string(d)
 		default:
-			w.WriteHeader(http.StatusNotFound)
+			writeProblem(w, fmt.Errorf("%w: %q", errMetricTypeNotFound, metricType), metricName)
 			return
 		}
 
-		_, err := io.WriteString(w, result)
+		_, err = io.WriteString(w, result)
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			return
+			models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
 		}
 	}
 }
@@ -75,9 +91,13 @@ func updateMetricHandler(storage repositories.Storage) http.HandlerFunc {
 			return
 		}
 		if metricType == models.Gauge {
-			storage.SetGauge(metricName, gaugeValue)
+			err = storage.SetGauge(r.Context(), metricName, gaugeValue)
 		} else if metricType == models.Counter {
-			storage.AddCounter(metricName, counterValue)
+			err = storage.AddCounter(r.Context(), metricName, counterValue)
+		}
+		if err != nil {
+			writeProblem(w, fmt.Errorf("update metric %s: %w", metricName, err), metricName)
+			return
 		}
 
 		w.Header().Set("content-type", "text/plain; charset=utf-8")
@@ -89,37 +109,42 @@ func updateErrorPathHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 		if len(parts) != 4 {
-			http.Error(w, "Invalid URL format", http.StatusNotFound)
+			writeProblem(w, models.NewAPIError(models.ErrCodeNotFound, "", "invalid URL format, want /update/{type}/{name}/{value}"), "")
 			return
 		}
 
 		if parts[1] != models.Gauge && parts[1] != models.Counter {
-			http.Error(w, "Invalid metric type", http.StatusBadRequest)
+			writeProblem(w, models.NewAPIError(models.ErrCodeInvalidType, parts[2], "invalid metric type %q", parts[1]), "")
 			return
 		}
 
-		http.NotFound(w, r)
+		writeProblem(w, models.NewAPIError(models.ErrCodeNotFound, parts[2], "metric not found"), "")
 	}
 }
 
 func parseMetricData(r *http.Request, w http.ResponseWriter) (string, string, int64, float64, error) {
 	metricType := chi.URLParam(r, "metricType")
-	metricName := chi.URLParam(r, "metricName")
 	metricValueStr := chi.URLParam(r, "metricValue")
 
-	if len(metricName) == 0 {
-		http.Error(w, "Metric name is empty", http.StatusNotFound)
-		return "", "", 0, 0, errors.New("metric name is empty")
+	if len(chi.URLParam(r, "metricName")) == 0 {
+		err := models.NewAPIError(models.ErrCodeNotFound, "", "metric name is empty")
+		writeProblem(w, err, "")
+		return "", "", 0, 0, err
+	}
+	metricName, err := seriesKeyParam(r)
+	if err != nil {
+		writeProblem(w, err, chi.URLParam(r, "metricName"))
+		return "", "", 0, 0, err
 	}
 
 	if metricType != models.Counter && metricType != models.Gauge {
-		http.Error(w, "Invalid metric type", http.StatusBadRequest)
-		return "", "", 0, 0, errors.New("invalid metric type")
+		err = models.NewAPIError(models.ErrCodeInvalidType, metricName, "invalid metric type %q", metricType)
+		writeProblem(w, err, "")
+		return "", "", 0, 0, err
 	}
 
 	var counterValue int64
 	var gaugeValue float64
-	var err error
 	if metricType == models.Counter {
 		counterValue, err = strconv.ParseInt(metricValueStr, 10, 64)
 	} else {
@@ -127,8 +152,16 @@ func parseMetricData(r *http.Request, w http.ResponseWriter) (string, string, in
 	}
 
 	if err != nil {
-		http.Error(w, "Invalid metric value", http.StatusBadRequest)
-		return "", "", 0, 0, errors.New("invalid metric value")
+		err = models.NewAPIError(models.ErrCodeInvalidValue, metricName, "invalid %s value %q", metricType, metricValueStr)
+		writeProblem(w, err, "")
+		return "", "", 0, 0, err
+	}
+
+	// labels are checked by seriesKeyParam
+	m := models.Metrics{ID: chi.URLParam(r, "metricName"), MType: metricType, Value: &gaugeValue, Delta: &counterValue}
+	if err = m.Validate(); err != nil {
+		writeProblem(w, err, "")
+		return "", "", 0, 0, err
 	}
 
 	return metricName, metricType, counterValue, gaugeValue, nil
@@ -0,0 +1,1049 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Nikolay961996/metsys/internal/server/alerting"
+	"github.com/Nikolay961996/metsys/internal/server/grafana"
+	"github.com/Nikolay961996/metsys/internal/server/influx"
+	"github.com/Nikolay961996/metsys/internal/server/ratelimit"
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+	"github.com/Nikolay961996/metsys/proto/prompb"
+)
+
+var errStorageDown = errors.New("storage down")
+
+type brokenStorage struct {
+	*storage.MemStorage
+}
+
+func (b *brokenStorage) SetGauge(_ context.Context, _ string, _ float64) error {
+	return errStorageDown
+}
+
+func (b *brokenStorage) AddCounter(_ context.Context, _ string, _ int64) error {
+	return errStorageDown
+}
+
+func (b *brokenStorage) GetGauge(_ context.Context, _ string) (float64, error) {
+	return 0, errStorageDown
+}
+
+func (b *brokenStorage) EachMetric(_ context.Context, _ func(repositories.MetricDto) error) error {
+	return errStorageDown
+}
+
+func (b *brokenStorage) Begin(_ context.Context) (repositories.Tx, error) {
+	return nil, errStorageDown
+}
+
+// TestStorageFailureStatus тестирует ответы сервера при недоступном хранилище
+func TestStorageFailureStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"url update", http.MethodPost, "/update/gauge/memory/1.5", "", http.StatusInternalServerError},
+		{"json update", http.MethodPost, "/update/", `{"id":"cp","type":"counter","delta":1}`, http.StatusInternalServerError},
+		{"batch update", http.MethodPost, "/updates/", `[{"id":"cp","type":"counter","delta":1}]`, http.StatusInternalServerError},
+		{"url value", http.MethodGet, "/value/gauge/memory", "", http.StatusInternalServerError},
+		{"json value missing", http.MethodPost, "/value/", `{"id":"cp","type":"counter"}`, http.StatusNotFound},
+		{"export", http.MethodGet, "/export", "", http.StatusInternalServerError},
+	}
+
+	ts := httptest.NewServer(MetricsRouterWithServer(&brokenStorage{storage.NewMemStorage()}, "", nil, ""))
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(tt.method, ts.URL+tt.url, bytes.NewBufferString(tt.body))
+			require.NoError(t, err)
+
+			resp, err := ts.Client().Do(request)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+// TestBatchRollback тестирует откат пакета при ошибке в одном из элементов
+func TestBatchRollback(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+
+	body := `[{"id":"good","type":"gauge","value":1.5},{"id":"bad","type":"unknown","value":2}]`
+	resp, err := ts.Client().Post(ts.URL+"/updates/", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, err = s.GetGauge(context.Background(), "good")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+// TestBatchResults тестирует результаты по каждой метрике пакета в атомарном режиме и режиме частичной записи
+func TestBatchResults(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+	ctx := context.Background()
+	body := `[{"id":"Alloc","type":"gauge","value":1.5},{"id":"Sys","type":"gauge"},{"id":"PollCount","type":"counter","delta":2}]`
+
+	post := func(url string) (*http.Response, []models.UpdateResult) {
+		resp, err := ts.Client().Post(ts.URL+url, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var r models.BatchResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+		return resp, r.Results
+	}
+	statuses := func(results []models.UpdateResult) []string {
+		var out []string
+		for _, r := range results {
+			out = append(out, r.ID+":"+r.Status+":"+string(r.Code))
+		}
+		return out
+	}
+
+	resp, results := post("/updates/")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, models.ProblemContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"Alloc:rejected:aborted", "Sys:rejected:invalid_value", "PollCount:rejected:aborted"}, statuses(results))
+	require.Len(t, results[1].Errors, 1)
+	assert.Equal(t, "value", results[1].Errors[0].Field)
+	_, err := s.GetGauge(ctx, "Alloc")
+	assert.ErrorIs(t, err, repositories.ErrNotFound, "atomic batch is stored all or nothing")
+
+	resp, results = post("/updates/?atomic=false")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"Alloc:stored:", "Sys:rejected:invalid_value", "PollCount:stored:"}, statuses(results))
+	assert.NotEmpty(t, results[1].Reason)
+	v, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+	d, err := s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), d)
+
+	body = `[{"id":"Alloc","type":"gauge","value":2}]`
+	resp, results = post("/updates/?atomic=true")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"Alloc:stored:"}, statuses(results))
+
+	resp, _ = post("/updates/?atomic=maybe")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	down := httptest.NewServer(MetricsRouterWithServer(&brokenStorage{storage.NewMemStorage()}, "", nil, ""))
+	defer down.Close()
+	body = `[{"id":"Alloc","type":"gauge","value":1},{"id":"Sys","type":"gauge","value":2}]`
+	r, err := down.Client().Post(down.URL+"/updates/?atomic=false", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer r.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, r.StatusCode)
+	var p models.Problem
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+	assert.Equal(t, []string{"Alloc:rejected:internal", "Sys:rejected:aborted"}, statuses(p.Results), "batch stops on storage failure")
+}
+
+// TestLabels тестирует запись и чтение метрик с метками от разных агентов
+func TestLabels(t *testing.T) {
+	ts := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, ""))
+	defer ts.Close()
+
+	body := `[{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}},` +
+		`{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"b","dc":"eu"}}]`
+	resp, err := ts.Client().Post(ts.URL+"/updates/", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		want int
+	}{
+		{"value by labels", "/value/gauge/Alloc?label=host=b&label=dc=eu", "2", http.StatusOK},
+		{"value without labels", "/value/gauge/Alloc", "", http.StatusNotFound},
+		{"bad label", "/value/gauge/Alloc?label=1host=a", "", http.StatusBadRequest},
+		{"list by equal", "/values/?match=host=a", `[{"labels":{"host":"a"},"id":"Alloc","type":"gauge","value":"1"}]`, http.StatusOK},
+		{"list by regexp", `/values/?match=host=~"a|b"&match=dc!=eu`, `[{"labels":{"host":"a"},"id":"Alloc","type":"gauge","value":"1"}]`, http.StatusOK},
+		{"list none", "/values/?match=host=c", `[]`, http.StatusOK},
+		{"bad matcher", "/values/?match=host", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ts.Client().Get(ts.URL + tt.url)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want, resp.StatusCode)
+			if tt.body != "" {
+				b, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+
+	resp, err = ts.Client().Post(ts.URL+"/update/", "application/json",
+		bytes.NewBufferString(`{"id":"Alloc","type":"gauge","value":1,"labels":{"bad-name":"a"}}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+type staticAlerts []alerting.Alert
+
+func (a staticAlerts) Alerts() []alerting.Alert {
+	return a
+}
+
+// TestAlerts тестирует вывод алертов в /alerts и на дашборде
+func TestAlerts(t *testing.T) {
+	t.Chdir("../../..")
+	alerts := staticAlerts{{
+		Rule:      "HighAlloc",
+		Metric:    "Alloc",
+		Labels:    models.Labels{"host": "a"},
+		Op:        ">",
+		Threshold: 100,
+		Value:     150,
+		State:     alerting.StateFiring,
+		ActiveAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}}
+	ts := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, "", WithAlerts(alerts)))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/alerts")
+	require.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `[{"activeAt":"2024-01-01T00:00:00Z","labels":{"host":"a"},"rule":"HighAlloc","metric":"Alloc",`+
+		`"op":">","state":"firing","value":150,"threshold":100}]`, string(b))
+
+	resp, err = ts.Client().Get(ts.URL + "/")
+	require.NoError(t, err)
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(b), `<tr class="firing">`)
+	assert.Contains(t, string(b), "HighAlloc")
+
+	plain := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, ""))
+	defer plain.Close()
+	resp, err = plain.Client().Get(plain.URL + "/alerts")
+	require.NoError(t, err)
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "[]", string(b))
+}
+
+// TestPrometheusMetrics тестирует вывод метрик в формате Prometheus и OpenMetrics
+func TestPrometheusMetrics(t *testing.T) {
+	ts := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, ""))
+	defer ts.Close()
+
+	body := `[{"id":"Alloc","type":"gauge","value":1.5,"labels":{"host":"a\"b"}},` +
+		`{"id":"poll.count","type":"counter","delta":3},` +
+		`{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,2,0],"count":3,"sum":1.2}}]`
+	resp, err := ts.Client().Post(ts.URL+"/updates/", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{
+			name:        "prometheus text",
+			contentType: "text/plain; version=0.0.4; charset=utf-8",
+			want: "# TYPE Alloc gauge\n" +
+				"Alloc{host=\"a\\\"b\"} 1.5\n" +
+				"# TYPE latency histogram\n" +
+				"latency_bucket{le=\"0.1\"} 1\n" +
+				"latency_bucket{le=\"1\"} 3\n" +
+				"latency_bucket{le=\"+Inf\"} 3\n" +
+				"latency_sum 1.2\n" +
+				"latency_count 3\n" +
+				"# TYPE poll_count counter\n" +
+				"poll_count 3\n",
+		},
+		{
+			name:        "openmetrics",
+			accept:      "application/openmetrics-text; version=1.0.0",
+			contentType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			want: "# TYPE Alloc gauge\n" +
+				"Alloc{host=\"a\\\"b\"} 1.5\n" +
+				"# TYPE latency histogram\n" +
+				"latency_bucket{le=\"0.1\"} 1\n" +
+				"latency_bucket{le=\"1\"} 3\n" +
+				"latency_bucket{le=\"+Inf\"} 3\n" +
+				"latency_sum 1.2\n" +
+				"latency_count 3\n" +
+				"# TYPE poll_count counter\n" +
+				"poll_count_total 3\n" +
+				"# EOF\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+			require.NoError(t, err)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			b, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+// TestSanitizeMetricName тестирует замену недопустимых символов в имени метрики
+func TestSanitizeMetricName(t *testing.T) {
+	tests := map[string]string{
+		"Alloc":        "Alloc",
+		"poll.count":   "poll_count",
+		"http-req:sec": "http_req:sec",
+		"9lives":       "_9lives",
+		"тест":         "____",
+		"":             "_",
+	}
+	for id, want := range tests {
+		assert.Equal(t, want, sanitizeMetricName(id), id)
+	}
+}
+
+func remoteWriteBody(t *testing.T, req *prompb.WriteRequest) *bytes.Reader {
+	b, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return bytes.NewReader(snappy.Encode(nil, b))
+}
+
+func remoteSeries(name string, value float64, ts int64, labels ...string) *prompb.TimeSeries {
+	series := &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: name}},
+		Samples: []*prompb.Sample{{Value: value, Timestamp: ts}},
+	}
+	for i := 0; i+1 < len(labels); i += 2 {
+		series.Labels = append(series.Labels, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return series
+}
+
+// TestRemoteWrite тестирует приём метрик по протоколу Prometheus remote write
+func TestRemoteWrite(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+	ctx := context.Background()
+
+	write := func(req *prompb.WriteRequest) int {
+		resp, err := ts.Client().Post(ts.URL+"/api/v1/write", "application/x-protobuf", remoteWriteBody(t, req))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	older := remoteSeries("temperature", 20, 1000, "room", "a")
+	older.Samples = append(older.Samples, &prompb.Sample{Value: math.NaN(), Timestamp: 3000})
+	status := write(&prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			remoteSeries("http_requests_total", 10, 1000, "code", "200"),
+			remoteSeries("temperature", 21.5, 2000, "room", "a"),
+			older,
+			remoteSeries("jobs_done", 7, 1000),
+			remoteSeries("rpc_seconds_count", 4, 1000),
+		},
+		Metadata: []*prompb.MetricMetadata{
+			{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "jobs_done"},
+			{Type: prompb.MetricMetadata_HISTOGRAM, MetricFamilyName: "rpc_seconds"},
+		},
+	})
+	require.Equal(t, http.StatusNoContent, status)
+
+	v, err := s.GetGauge(ctx, `temperature{room="a"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 21.5, v, 1e-9)
+	for key, want := range map[string]int64{`http_requests_total{code="200"}`: 10, "jobs_done": 7, "rpc_seconds_count": 4} {
+		c, err := s.GetCounter(ctx, key)
+		require.NoError(t, err, key)
+		assert.Equal(t, want, c, key)
+	}
+
+	require.NoError(t, s.AddCounter(ctx, "jobs_done", 100))
+	require.Equal(t, http.StatusBadRequest, write(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{
+		remoteSeries("http_requests_total", 15, 2000, "code", "200"),
+		remoteSeries("jobs_done", 2, 2000),
+		remoteSeries("cpu_seconds_total", 1.5, 2000),
+	}}), "fractional counter is reported to client")
+	c, err := s.GetCounter(ctx, `http_requests_total{code="200"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), c)
+	c, err = s.GetCounter(ctx, "jobs_done")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), c, "counter is set to remote value regardless of writes in between")
+	_, err = s.GetCounter(ctx, "cpu_seconds_total")
+	assert.ErrorIs(t, err, repositories.ErrNotFound, "fractional counter isn't rounded")
+
+	assert.Equal(t, http.StatusBadRequest, write(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "job", Value: "x"}}, Samples: []*prompb.Sample{{Value: 1}}},
+	}}))
+
+	resp, err := ts.Client().Post(ts.URL+"/api/v1/write", "application/x-protobuf", bytes.NewBufferString("not snappy"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	trusted := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, "10.0.0.0/8"))
+	defer trusted.Close()
+	resp, err = trusted.Client().Post(trusted.URL+"/api/v1/write", "application/x-protobuf",
+		remoteWriteBody(t, &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{remoteSeries("up", 1, 1000)}}))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// TestRemoteFamiliesLimit тестирует ограничение числа запоминаемых семейств метрик
+func TestRemoteFamiliesLimit(t *testing.T) {
+	families := &remoteFamilies{types: map[string]prompb.MetricMetadata_MetricType{}}
+	metadata := make([]*prompb.MetricMetadata, 0, maxRemoteFamilies+1)
+	for i := range maxRemoteFamilies + 1 {
+		metadata = append(metadata, &prompb.MetricMetadata{Type: prompb.MetricMetadata_GAUGE, MetricFamilyName: fmt.Sprintf("family_%d", i)})
+	}
+	families.update(metadata)
+	assert.Len(t, families.types, maxRemoteFamilies)
+
+	families.update([]*prompb.MetricMetadata{{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "family_0"}})
+	typ, ok := families.get("family_0")
+	require.True(t, ok)
+	assert.Equal(t, prompb.MetricMetadata_COUNTER, typ, "known family is still updated")
+}
+
+// TestInfluxWrite тестирует приём метрик в формате InfluxDB line protocol
+func TestInfluxWrite(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+	ctx := context.Background()
+
+	write := func(body string) int {
+		resp, err := ts.Client().Post(ts.URL+"/write?db=telegraf", "text/plain", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusNoContent, write("cpu,cpu=cpu0,host=srv1 usage_idle=97.5,usage_user=2 1000\n"+
+		"cpu,cpu=cpu0,host=srv1 usage_idle=90 900\n"+
+		"net,host=srv1 requests_total=1024i,iface=\"eth0\",up=true\n"))
+
+	v, err := s.GetGauge(ctx, "cpu.cpu0.srv1.usage_idle")
+	require.NoError(t, err)
+	assert.InDelta(t, 97.5, v, 1e-9, "older point doesn't override newer")
+	v, err = s.GetGauge(ctx, "net.srv1.up")
+	require.NoError(t, err)
+	assert.InDelta(t, 1, v, 1e-9)
+	c, err := s.GetCounter(ctx, "net.srv1.requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), c)
+	_, err = s.GetGauge(ctx, "net.srv1.iface")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	require.Equal(t, http.StatusNoContent, write("net,host=srv1 requests_total=2048i\n"))
+	c, err = s.GetCounter(ctx, "net.srv1.requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), c)
+
+	// целочисленные поля без суффикса _total остаются датчиками, в том числе после записи дробного значения
+	require.Equal(t, http.StatusNoContent, write("mem,host=srv1 free=123i\nsystem,host=srv1 procs=4i\n"))
+	require.Equal(t, http.StatusNoContent, write("mem,host=srv1 free=99.5\n"))
+	v, err = s.GetGauge(ctx, "mem.srv1.free")
+	require.NoError(t, err)
+	assert.InDelta(t, 99.5, v, 1e-9)
+	v, err = s.GetGauge(ctx, "system.srv1.procs")
+	require.NoError(t, err)
+	assert.InDelta(t, 4, v, 1e-9)
+	_, err = s.GetCounter(ctx, "system.srv1.procs")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	assert.Equal(t, http.StatusBadRequest, write("cpu usage_idle=oops\n"))
+
+	require.Equal(t, http.StatusNoContent, write("disk,device=sda1,fstype=ext4,path=/ free=1234i\n"+
+		"cpu usage_idle=50\n"+
+		"mem,host="+strings.Repeat("a", models.MaxMetricNameLength)+" used=1\n"))
+	v, err = s.GetGauge(ctx, "disk.sda1.ext4._.free")
+	require.NoError(t, err, "tag values are sanitized")
+	assert.InDelta(t, 1234, v, 1e-9)
+	v, err = s.GetGauge(ctx, "cpu.usage_idle")
+	require.NoError(t, err, "field with too long ID doesn't fail others")
+	assert.InDelta(t, 50, v, 1e-9)
+
+	resp, err := ts.Client().Post(ts.URL+"/query?q="+url.QueryEscape(`CREATE DATABASE "telegraf"`), "", nil)
+	require.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"results":[{"statement_id":0}]}`, string(b))
+
+	tmpl, err := influx.NewTemplate("{tag:host}.{measurement}_{field}")
+	require.NoError(t, err)
+	custom := httptest.NewServer(MetricsRouterWithServer(s, "", nil, "", WithInfluxTemplate(tmpl)))
+	defer custom.Close()
+	resp, err = custom.Client().Post(custom.URL+"/write", "text/plain", bytes.NewBufferString("mem,host=srv2 used_percent=42"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	v, err = s.GetGauge(ctx, "srv2.mem_used_percent")
+	require.NoError(t, err)
+	assert.InDelta(t, 42, v, 1e-9)
+}
+
+// TestOTLPMetrics тестирует приём метрик OTLP/HTTP в protobuf и JSON
+func TestOTLPMetrics(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+	ctx := context.Background()
+
+	req := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "queue.size",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 4}},
+			}}},
+		}}}},
+	}}}
+	b, err := proto.Marshal(req)
+	require.NoError(t, err)
+	resp, err := ts.Client().Post(ts.URL+"/v1/metrics", "application/x-protobuf", bytes.NewReader(b))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-protobuf", resp.Header.Get("Content-Type"))
+	var out colmetricspb.ExportMetricsServiceResponse
+	require.NoError(t, proto.Unmarshal(body, &out))
+	assert.Nil(t, out.PartialSuccess)
+
+	v, err := s.GetGauge(ctx, "queue.size")
+	require.NoError(t, err)
+	assert.InDelta(t, 4, v, 1e-9)
+
+	jsonBody := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"jobs.done","sum":{"isMonotonic":true,` +
+		`"aggregationTemporality":1,"dataPoints":[{"asInt":"3"}]}}]}]}]}`
+	resp, err = ts.Client().Post(ts.URL+"/v1/metrics", "application/json", bytes.NewBufferString(jsonBody))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	c, err := s.GetCounter(ctx, "jobs.done")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), c)
+
+	resp, err = ts.Client().Post(ts.URL+"/v1/metrics", "application/x-protobuf", bytes.NewBufferString("\xff\xff"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = ts.Client().Post(ts.URL+"/v1/metrics", "text/plain", bytes.NewBufferString("x"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+// TestIsTrustedPeer тестирует проверку адреса сокета по доверенной подсети
+func TestIsTrustedPeer(t *testing.T) {
+	peer := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 40000}
+	assert.True(t, IsTrustedPeer(peer, ""))
+	assert.True(t, IsTrustedPeer(peer, "192.168.1.0/24"))
+	assert.False(t, IsTrustedPeer(peer, "10.0.0.0/8"))
+	assert.False(t, IsTrustedPeer(peer, "bad subnet"))
+}
+
+// TestExport тестирует потоковую выгрузку метрик в NDJSON и CSV
+func TestExport(t *testing.T) {
+	s := storage.NewMemStorage()
+	ctx := context.Background()
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, s.AddCounter(ctx, models.SeriesKey("PollCount", models.Labels{"host": "a"}), 3))
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+
+	get := func(url string, gzipped bool) (*http.Response, string) {
+		request, err := http.NewRequest(http.MethodGet, ts.URL+url, nil)
+		require.NoError(t, err)
+		if gzipped {
+			request.Header.Set("Accept-Encoding", "gzip")
+		}
+		resp, err := ts.Client().Do(request)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var reader io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			reader, err = gzip.NewReader(resp.Body)
+			require.NoError(t, err)
+		}
+		b, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+
+	resp, body := get("/export?format=ndjson", false)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	assert.ElementsMatch(t, []string{
+		`{"id":"Alloc","type":"gauge","value":"1.5"}`,
+		`{"labels":{"host":"a"},"id":"PollCount","type":"counter","value":"3"}`,
+	}, lines)
+
+	resp, body = get("/export?format=csv", true)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "type", "value", "labels"}, records[0])
+	assert.ElementsMatch(t, [][]string{
+		{"Alloc", "gauge", "1.5", ""},
+		{"PollCount", "counter", "3", `host="a"`},
+	}, records[1:])
+
+	resp, body = get("/export?format=csv&match=host=b", false)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "id,type,value,labels\n", body)
+
+	resp, _ = get("/export?format=xml", false)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestImport тестирует загрузку метрик с отметками времени и построчный отчёт об ошибках
+func TestImport(t *testing.T) {
+	s := storage.NewMemStorage()
+	ctx := context.Background()
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 10))
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+
+	post := func(url string, contentType string, body string) (int, importReport) {
+		resp, err := ts.Client().Post(ts.URL+url, contentType, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var report importReport
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		return resp.StatusCode, report
+	}
+
+	hourAgo := time.Now().Add(-time.Hour).Unix()
+	body := fmt.Sprintf(`{"id":"Alloc","type":"gauge","value":1,"timestamp":%d}
+{"id":"PollCount","type":"counter","delta":2,"timestamp":"%s"}
+
+{"id":"PollCount","type":"counter","delta":3}
+{"id":"Broken","type":"gauge"}
+not json
+{"id":"Future","type":"gauge","value":1,"timestamp":%d}
+`, hourAgo, time.Now().Add(-2*time.Hour).Format(time.RFC3339), time.Now().Add(time.Hour).Unix())
+	status, report := post("/import?chunk=2", "application/x-ndjson", body)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 3, report.Imported)
+	assert.Equal(t, 3, report.Failed)
+	require.Len(t, report.Errors, 3)
+	assert.Equal(t, []int{5, 6, 7}, []int{report.Errors[0].Line, report.Errors[1].Line, report.Errors[2].Line})
+
+	gauge, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, gauge, "backfilled sample must not replace current value")
+	history, err := s.GetHistory(ctx, models.Gauge, "Alloc", time.Time{}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, hourAgo, history[0].Timestamp.Unix())
+	counter, err := s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	csvBody := "id,type,value,labels,timestamp\n" +
+		fmt.Sprintf("Temp,gauge,21.5,\"host=\"\"a\"\"\",%d\n", hourAgo) +
+		"Hits,counter,4,,\n" +
+		"Hits,counter,x,,\n"
+	status, report = post("/import", "text/csv", csvBody)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, report.Imported)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, 4, report.Errors[0].Line)
+	temp, err := s.GetGauge(ctx, models.SeriesKey("Temp", models.Labels{"host": "a"}))
+	require.NoError(t, err)
+	assert.Equal(t, 21.5, temp)
+
+	resp, err := ts.Client().Post(ts.URL+"/import?format=xml", "text/plain", strings.NewReader(""))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	broken := httptest.NewServer(MetricsRouterWithServer(&brokenStorage{storage.NewMemStorage()}, "", nil, ""))
+	defer broken.Close()
+	resp, err = broken.Client().Post(broken.URL+"/import", "application/x-ndjson", strings.NewReader(`{"id":"a","type":"gauge","value":1}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 0, report.Imported)
+	assert.Equal(t, 1, report.Failed)
+}
+
+// TestGrafana тестирует API для Grafana JSON datasource: поиск метрик, последние значения и аннотации алертов
+func TestGrafana(t *testing.T) {
+	s := storage.NewMemStorage()
+	ctx := context.Background()
+	cpu := models.SeriesKey("cpu", models.Labels{"host": "a"})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder := grafana.NewRecorder(s, 10)
+	for i := range 4 {
+		require.NoError(t, s.SetGauge(ctx, cpu, float64(i)))
+		require.NoError(t, s.AddCounter(ctx, "requests", 1))
+		require.NoError(t, recorder.Record(ctx, start.Add(time.Duration(i)*time.Second)))
+	}
+	require.NoError(t, s.SetGauge(ctx, "requests", 0.5))
+	alerts := staticAlerts{{
+		Rule:      "HighCPU",
+		Metric:    "cpu",
+		Labels:    models.Labels{"host": "a"},
+		Op:        ">",
+		Threshold: 2,
+		Value:     3,
+		State:     alerting.StateFiring,
+		ActiveAt:  start.Add(3 * time.Second),
+	}}
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, "", WithSamples(recorder), WithAlerts(alerts)))
+	defer ts.Close()
+
+	post := func(path string, body string) (int, string) {
+		resp, err := ts.Client().Post(ts.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/grafana/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	status, body := post("/grafana/search", `{"target":""}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `["cpu{host=\"a\"}","requests"]`, body)
+	status, body = post("/grafana/search", `{"target":"cpu"}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `["cpu{host=\"a\"}"]`, body)
+
+	status, body = post("/grafana/query", `{"range":{"from":"2024-01-01T00:00:01Z","to":"2024-01-01T00:00:03Z"},"maxDataPoints":2,`+
+		`"targets":[{"target":"cpu{host=\"a\"}","refId":"A","type":"timeserie"},{"target":"requests","payload":{"type":"counter"}}]}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `[{"target":"cpu{host=\"a\"}","datapoints":[[1,1704067201000],[3,1704067203000]]},`+
+		`{"target":"requests","datapoints":[[2,1704067201000],[4,1704067203000]]}]`, body, "series are thinned to maxDataPoints")
+
+	status, _ = post("/grafana/query", `{"targets":[{"target":"cpu","type":"table"}]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = post("/grafana/query", `not json`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, body = post("/grafana/annotations", `{"range":{"from":"2024-01-01T00:00:00Z","to":"2024-01-01T00:01:00Z"},"annotation":{"name":"alerts","query":"HighCPU"}}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `[{"annotation":{"name":"alerts","query":"HighCPU"},"time":1704067203000,"title":"HighCPU",`+
+		`"text":"cpu{host=\"a\"}: 3 > 2","tags":["firing"]}]`, body)
+	status, body = post("/grafana/annotations", `{"range":{"from":"2024-01-01T00:00:00Z","to":"2024-01-01T00:00:01Z"},"annotation":{}}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `[]`, body)
+}
+
+type unavailableStorage struct {
+	*storage.MemStorage
+}
+
+func (u *unavailableStorage) GetGauge(_ context.Context, _ string) (float64, error) {
+	return 0, fmt.Errorf("%w: connection refused", repositories.ErrUnavailable)
+}
+
+// TestProblemResponses тестирует ошибки API в виде problem+json с машиночитаемым кодом
+func TestProblemResponses(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+	down := httptest.NewServer(MetricsRouterWithServer(&unavailableStorage{storage.NewMemStorage()}, "", nil, ""))
+	defer down.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		method string
+		body   string
+		code   models.ErrorCode
+		metric string
+		status int
+	}{
+		{"missing metric", ts.URL + "/value/gauge/Alloc", http.MethodGet, "", models.ErrCodeNotFound, "Alloc", http.StatusNotFound},
+		{"missing metric json", ts.URL + "/value/", http.MethodPost, `{"id":"Alloc","type":"gauge"}`, models.ErrCodeNotFound, "Alloc", http.StatusNotFound},
+		{"unknown type", ts.URL + "/update/meter/Alloc/1", http.MethodPost, "", models.ErrCodeInvalidType, "Alloc", http.StatusBadRequest},
+		{"unknown type json", ts.URL + "/update/", http.MethodPost, `{"id":"Alloc","type":"meter"}`, models.ErrCodeInvalidType, "Alloc", http.StatusBadRequest},
+		{"bad value", ts.URL + "/update/counter/PollCount/1.5", http.MethodPost, "", models.ErrCodeInvalidValue, "PollCount", http.StatusBadRequest},
+		{"bad label", ts.URL + "/update/gauge/Alloc/1?label=1x=a", http.MethodPost, "", models.ErrCodeInvalidLabels, "Alloc", http.StatusBadRequest},
+		{"bad json", ts.URL + "/update/", http.MethodPost, `{"id":`, models.ErrCodeInvalidRequest, "", http.StatusBadRequest},
+		{"storage down", down.URL + "/value/gauge/Alloc", http.MethodGet, "", models.ErrCodeStorageUnavailable, "Alloc", http.StatusServiceUnavailable},
+		{"history missing metric", ts.URL + "/history/gauge/Alloc", http.MethodGet, "", models.ErrCodeNotFound, "Alloc", http.StatusNotFound},
+		{"history bad range", ts.URL + "/history/gauge/Alloc?step=x", http.MethodGet, "", models.ErrCodeInvalidRequest, "Alloc", http.StatusBadRequest},
+		{"history storage down", down.URL + "/history/gauge/Alloc", http.MethodGet, "", models.ErrCodeStorageUnavailable, "Alloc", http.StatusServiceUnavailable},
+		{"export bad matcher", ts.URL + "/export?match=1x=a", http.MethodGet, "", models.ErrCodeInvalidLabels, "", http.StatusBadRequest},
+		{"export bad format", ts.URL + "/export?format=xml", http.MethodGet, "", models.ErrCodeInvalidRequest, "", http.StatusBadRequest},
+		{"import bad chunk", ts.URL + "/import?chunk=0", http.MethodPost, "", models.ErrCodeInvalidRequest, "", http.StatusBadRequest},
+		{"remote write bad body", ts.URL + "/api/v1/write", http.MethodPost, "not snappy", models.ErrCodeInvalidRequest, "", http.StatusBadRequest},
+		{"influx bad line", ts.URL + "/write", http.MethodPost, "cpu", models.ErrCodeInvalidRequest, "", http.StatusBadRequest},
+		{"grafana bad body", ts.URL + "/grafana/query", http.MethodPost, "{", models.ErrCodeInvalidRequest, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, models.ProblemContentType, resp.Header.Get("Content-Type"))
+			var p models.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, tt.metric, p.Metric)
+			assert.Equal(t, tt.status, p.Status)
+			assert.NotEmpty(t, p.Detail)
+		})
+	}
+}
+
+// TestValidation тестирует проверку метрик на всех путях записи и список ошибок по полям
+func TestValidation(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, ""))
+	defer ts.Close()
+	long := strings.Repeat("a", models.MaxMetricNameLength+1)
+
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		code   models.ErrorCode
+		fields []string
+	}{
+		{"gauge without value", "/update/", `{"id":"Alloc","type":"gauge"}`, models.ErrCodeInvalidValue, []string{"value"}},
+		{"counter without delta", "/update/", `{"id":"PollCount","type":"counter","value":1}`, models.ErrCodeInvalidValue, []string{"delta"}},
+		{"histogram without data", "/update/", `{"id":"latency","type":"histogram"}`, models.ErrCodeInvalidValue, []string{"histogram"}},
+		{"empty id", "/update/", `{"id":"","type":"gauge","value":1}`, models.ErrCodeInvalidName, []string{"id"}},
+		{"all fields", "/update/", `{"id":"a b","type":"gauge","labels":{"1x":"a"}}`, models.ErrCodeInvalidName, []string{"id", "value", "labels"}},
+		{"long name", "/update/", `{"id":"` + long + `","type":"counter","delta":1}`, models.ErrCodeInvalidName, []string{"id"}},
+		{"batch item", "/updates/", `[{"id":"Alloc","type":"gauge","value":1},{"id":"Sys","type":"gauge"}]`, models.ErrCodeInvalidValue, []string{"value"}},
+		{"url NaN", "/update/gauge/Alloc/NaN", "", models.ErrCodeInvalidValue, []string{"value"}},
+		{"url Inf", "/update/gauge/Alloc/-Inf", "", models.ErrCodeInvalidValue, []string{"value"}},
+		{"url name", "/update/gauge/Al%7Bloc/1", "", models.ErrCodeInvalidName, []string{"id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ts.Client().Post(ts.URL+tt.url, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			var p models.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+			assert.Equal(t, tt.code, p.Code)
+			var fields []string
+			for _, f := range p.Errors {
+				fields = append(fields, f.Field)
+				assert.NotEmpty(t, f.Reason)
+			}
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+
+	all, err := s.GetAll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, all, "rejected metrics must not be stored")
+}
+
+// TestRateLimit тестирует ограничение частоты запросов клиента по HTTP и gRPC и счётчики на /admin/ratelimit
+func TestRateLimit(t *testing.T) {
+	rules := []ratelimit.Rule{{Prefix: "/update/", Rate: 0.001, Burst: 1}}
+	limiter := ratelimit.NewLimiter(rules, nil)
+	ts := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, "", WithRateLimiter(limiter)))
+	defer ts.Close()
+
+	post := func(ts *httptest.Server, headers map[string]string) *http.Response {
+		request, err := http.NewRequest(http.MethodPost, ts.URL+"/update/gauge/Alloc/1", nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(request)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, post(ts, nil).StatusCode)
+	resp := post(ts, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1000", resp.Header.Get("Retry-After"))
+	resp = post(ts, map[string]string{"X-Real-IP": "10.0.0.1"})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "X-Real-IP of untrusted peer doesn't choose bucket")
+	assert.Equal(t, http.StatusOK, post(ts, map[string]string{ratelimit.AgentIDHeader: "host-1"}).StatusCode, "agent is limited separately")
+	assert.Equal(t, http.StatusOK, post(ts, map[string]string{ratelimit.APIKeyHeader: "secret"}).StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, post(ts, map[string]string{ratelimit.APIKeyHeader: "secret", ratelimit.AgentIDHeader: "host-2"}).StatusCode)
+
+	resp, err := ts.Client().Get(ts.URL + "/admin/ratelimit")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var stats []ratelimit.RuleStats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(3), stats[0].Allowed)
+	assert.Equal(t, int64(3), stats[0].Throttled)
+	require.Len(t, stats[0].Clients, 2)
+	assert.Equal(t, "ip:127.0.0.1", stats[0].Clients[0].Client)
+	assert.True(t, strings.HasPrefix(stats[0].Clients[1].Client, "key:"))
+	assert.NotContains(t, stats[0].Clients[1].Client, "secret", "API key isn't exposed")
+
+	proxies, err := ratelimit.ParseProxies("127.0.0.0/8")
+	require.NoError(t, err)
+	proxied := httptest.NewServer(MetricsRouterWithServer(storage.NewMemStorage(), "", nil, "", WithRateLimiter(ratelimit.NewLimiter(rules, proxies))))
+	defer proxied.Close()
+	assert.Equal(t, http.StatusOK, post(proxied, map[string]string{"X-Real-IP": "10.0.0.1"}).StatusCode)
+	assert.Equal(t, http.StatusOK, post(proxied, map[string]string{"X-Real-IP": "10.0.0.2"}).StatusCode, "trusted proxy sets client")
+	assert.Equal(t, http.StatusTooManyRequests, post(proxied, map[string]string{"X-Real-IP": "10.0.0.1"}).StatusCode)
+
+	interceptor := WithRateLimitInterceptor(ratelimit.NewLimiter([]ratelimit.Rule{{Prefix: "/metrics.MetricsService/", Rate: 0.001, Burst: 1}}, nil))
+	info := &grpc.UnaryServerInfo{FullMethod: "/metrics.MetricsService/UpdateMetric"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 5000}})
+	next := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	_, err = interceptor(metadata.NewIncomingContext(ctx, metadata.Pairs("x-real-ip", "10.0.0.1")), nil, info, next)
+	require.NoError(t, err)
+	_, err = interceptor(metadata.NewIncomingContext(ctx, metadata.Pairs("x-agent-id", "host-2")), nil, info, next)
+	require.NoError(t, err, "agent is limited separately")
+	_, err = interceptor(metadata.NewIncomingContext(ctx, metadata.Pairs("x-real-ip", "10.0.0.2")), nil, info, next)
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 2)
+	retry, ok := st.Details()[1].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	assert.Greater(t, retry.RetryDelay.AsDuration(), time.Minute)
+}
+
+// TestBodyLimits тестирует ограничения размера тела запроса, распакованного тела и длины пакета
+func TestBodyLimits(t *testing.T) {
+	s := storage.NewMemStorage()
+	ts := httptest.NewServer(MetricsRouterWithServer(s, "", nil, "", WithBodyLimits(BodyLimits{MaxBodySize: 4096, MaxDecompressedSize: 1000, MaxBatchSize: 2})))
+	defer ts.Close()
+
+	gzipped := func(body string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(body))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+	metric := `{"id":"Alloc","type":"gauge","value":1}`
+	bomb := gzipped(metric + strings.Repeat(" ", 100000))
+	require.Less(t, len(bomb), 4096)
+
+	tests := []struct {
+		body     io.Reader
+		name     string
+		url      string
+		encoding string
+		code     models.ErrorCode
+		status   int
+	}{
+		{strings.NewReader(metric + strings.Repeat(" ", 5000)), "body", "/update/", "", models.ErrCodeTooLarge, http.StatusRequestEntityTooLarge},
+		{io.MultiReader(strings.NewReader(metric + strings.Repeat(" ", 5000))), "chunked body", "/update/", "", models.ErrCodeTooLarge, http.StatusRequestEntityTooLarge},
+		{bytes.NewReader(bomb), "gzip bomb", "/update/", "gzip", models.ErrCodeTooLarge, http.StatusRequestEntityTooLarge},
+		{strings.NewReader(metric), "corrupt gzip", "/update/", "gzip", models.ErrCodeInvalidRequest, http.StatusBadRequest},
+		{strings.NewReader("[" + strings.Repeat(metric+",", 2) + metric + "]"), "batch", "/updates/", "", models.ErrCodeTooLarge, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, ts.URL+tt.url, tt.body)
+			require.NoError(t, err)
+			request.Header.Set("Content-Encoding", tt.encoding)
+			resp, err := ts.Client().Do(request)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			var p models.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+			assert.Equal(t, tt.code, p.Code)
+		})
+	}
+
+	resp, err := ts.Client().Post(ts.URL+"/api/v1/write", "application/x-protobuf", bytes.NewReader(snappy.Encode(nil, make([]byte, 2000))))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, "snappy bomb")
+
+	request, err := http.NewRequest(http.MethodPost, ts.URL+"/updates/", bytes.NewReader(gzipped("["+metric+","+metric+"]")))
+	require.NoError(t, err)
+	request.Header.Set("Content-Encoding", "gzip")
+	resp, err = ts.Client().Do(request)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "batch within limits")
+
+	all, err := s.GetAll(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, all, 1, "only the last request is stored")
+}
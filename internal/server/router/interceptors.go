@@ -4,11 +4,16 @@ package router
 import (
 	"context"
 	"fmt"
+	"github.com/Nikolay961996/metsys/internal/server/ratelimit"
 	"github.com/Nikolay961996/metsys/models"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"time"
 )
 
 func WithTrustedSubnetInterceptor(trustedSubnet string) grpc.UnaryServerInterceptor {
@@ -30,6 +35,41 @@ func WithTrustedSubnetInterceptor(trustedSubnet string) grpc.UnaryServerIntercep
 	}
 }
 
+// WithRateLimitInterceptor rejects calls of throttled client with ResourceExhausted,
+// delay is sent as retry-after header and RetryInfo detail
+func WithRateLimitInterceptor(limiter RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		var peerAddr string
+		if p, ok := peer.FromContext(ctx); ok {
+			peerAddr = p.Addr.String()
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		client := limiter.Client(peerAddr, getClientIPFromContextGRPC(ctx), firstValue(md, ratelimit.APIKeyHeader), firstValue(md, ratelimit.AgentIDHeader))
+
+		ok, delay := limiter.Allow(client, info.FullMethod)
+		if ok {
+			return next(ctx, req)
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfterSeconds(delay)))
+		st := status.Newf(codes.ResourceExhausted, "rate limit of %s exceeded, retry in %v", client, delay.Round(time.Millisecond))
+		detailed, err := st.WithDetails(
+			&errdetails.ErrorInfo{Reason: string(models.ErrCodeRateLimited), Domain: "metsys"},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)},
+		)
+		if err == nil {
+			st = detailed
+		}
+		return nil, st.Err()
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
 func getClientIPFromContextGRPC(ctx context.Context) string {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -0,0 +1,67 @@
+// Package router consist request size limits
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// BodyLimits sizes of requests accepted by API, 0 is no limit
+type BodyLimits struct {
+	MaxBodySize         int64 // body as sent, possibly compressed or encrypted
+	MaxDecompressedSize int64 // gzip or snappy body after decompression, max gRPC message as well
+	MaxBatchSize        int   // metrics in one /updates/ or BatchUpdateMetrics request
+}
+
+// DefaultBodyLimits limits of router without WithBodyLimits, max body is the default max gRPC message
+var DefaultBodyLimits = BodyLimits{
+	MaxBodySize:         4 << 20,
+	MaxDecompressedSize: 32 << 20,
+	MaxBatchSize:        10000,
+}
+
+// WithBodyLimit rejects body larger than maxSize with 413, declared size is checked before reading
+func WithBodyLimit(maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxSize <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > maxSize {
+				writeProblem(w, models.NewAPIError(models.ErrCodeTooLarge, "", "request body of %d bytes is larger than %d bytes", r.ContentLength, maxSize), "")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CheckBatchSize error if batch of n metrics is longer than maxSize, no limit if maxSize is 0
+func CheckBatchSize(n int, maxSize int) error {
+	if maxSize > 0 && n > maxSize {
+		return models.NewAPIError(models.ErrCodeTooLarge, "", "batch of %d metrics is longer than %d", n, maxSize)
+	}
+	return nil
+}
+
+// bodyReadError error of reading request body, body over limit is reported as too large
+func bodyReadError(err error) *models.APIError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return models.NewAPIError(models.ErrCodeTooLarge, "", "request body is larger than %d bytes", tooLarge.Limit)
+	}
+	return models.NewAPIError(models.ErrCodeInvalidRequest, "", "read body: %w", err)
+}
+
+// bodyReadStatus status for error of reading or decoding request body, 413 for body over limit
+func bodyReadStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
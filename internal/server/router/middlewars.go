@@ -14,6 +14,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
 	"github.com/Nikolay961996/metsys/models"
 )
 
@@ -83,23 +84,39 @@ var gzipReaderPool = sync.Pool{
 	},
 }
 
+// WithDecompressionRequest decompresses gzip request body without size limit, see WithDecompressionLimit
 func WithDecompressionRequest(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Content-Encoding") == "gzip" {
+	return WithDecompressionLimit(0)(h)
+}
+
+// WithDecompressionLimit decompresses gzip request body, reading more than maxSize bytes of it fails
+// with *http.MaxBytesError (no limit if maxSize is 0). Request with corrupt gzip header is rejected with 400.
+func WithDecompressionLimit(maxSize int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Encoding") != "gzip" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
 			gz := gzipReaderPool.Get().(*gzip.Reader)
-			err := gz.Reset(r.Body)
-			if err != nil {
+			if err := gz.Reset(r.Body); err != nil {
+				gzipReaderPool.Put(gz)
 				models.Log.Error("error creating gzip reader", zap.Error(err))
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				writeProblem(w, bodyReadError(fmt.Errorf("invalid gzip header: %w", err)), "")
+				return
 			}
 			defer func() {
 				gz.Close()
 				gzipReaderPool.Put(gz)
 			}()
 			r.Body = gz
-		}
-		h.ServeHTTP(w, r)
-	})
+			if maxSize > 0 {
+				r.Body = http.MaxBytesReader(w, gz, maxSize)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
 }
 
 var gzipWriterPool = sync.Pool{
@@ -139,6 +156,7 @@ func checkTrustedSubnet(xRealIP string, trustedSubnet string) codes.Code {
 	_, subnet, err := net.ParseCIDR(trustedSubnet)
 	if err != nil {
 		models.Log.Error("Invalid trusted subnet configuration")
+		notifier.Emit(notifier.TrustedSubnetInvalid, "router", fmt.Sprintf("trusted subnet %q: %v", trustedSubnet, err))
 		return codes.Internal
 	}
 
@@ -149,6 +167,15 @@ func checkTrustedSubnet(xRealIP string, trustedSubnet string) codes.Code {
 	return codes.OK
 }
 
+// IsTrustedPeer checks socket peer address against trusted subnet, for listeners without X-Real-IP header
+func IsTrustedPeer(addr net.Addr, trustedSubnet string) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return checkTrustedSubnet(host, trustedSubnet) == codes.OK
+}
+
 func WithTrustedSubnetValidation(trustedSubnet string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -157,9 +184,9 @@ func WithTrustedSubnetValidation(trustedSubnet string) func(http.Handler) http.H
 
 			switch code {
 			case codes.PermissionDenied:
-				http.Error(w, "Forbidden: IP not in trusted subnet", http.StatusForbidden)
+				writeProblem(w, models.NewAPIError(models.ErrCodeForbidden, "", "IP %q not in trusted subnet", xRealIP), "")
 			case codes.Internal:
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				writeProblem(w, models.NewAPIError(models.ErrCodeInternal, "", "trusted subnet is misconfigured"), "")
 			case codes.OK:
 				next.ServeHTTP(w, r)
 			default:
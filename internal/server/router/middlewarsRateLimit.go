@@ -0,0 +1,43 @@
+// Package router consist rate limiting middleware
+package router
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/ratelimit"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// RateLimiter throttles clients per route, implemented by ratelimit.Limiter
+type RateLimiter interface {
+	Client(peer string, realIP string, apiKey string, agentID string) string
+	Allow(client string, route string) (bool, time.Duration)
+	Stats() []ratelimit.RuleStats
+}
+
+// retryAfterSeconds value of Retry-After header, delay rounded up to whole seconds
+func retryAfterSeconds(delay time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(delay.Seconds()))))
+}
+
+// WithRateLimit rejects requests of throttled client with 429 and Retry-After, no limits if limiter is nil
+func WithRateLimit(limiter RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := limiter.Client(r.RemoteAddr, r.Header.Get("X-Real-IP"), r.Header.Get(ratelimit.APIKeyHeader), r.Header.Get(ratelimit.AgentIDHeader))
+			if ok, delay := limiter.Allow(client, r.URL.Path); !ok {
+				w.Header().Set("Retry-After", retryAfterSeconds(delay))
+				writeProblem(w, models.NewAPIError(models.ErrCodeRateLimited, "", "rate limit of %s exceeded, retry in %v", client, delay.Round(time.Millisecond)), "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
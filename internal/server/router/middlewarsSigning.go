@@ -26,7 +26,7 @@ func WithSigningCheck(keyForSigning string) func(h http.Handler) http.Handler {
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
 				models.Log.Error("error read request body", zap.Error(err))
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				writeProblem(w, bodyReadError(err), "")
 				return
 			}
 			defer r.Body.Close()
@@ -36,7 +36,7 @@ func WithSigningCheck(keyForSigning string) func(h http.Handler) http.Handler {
 			h.Write(body)
 			expected := hex.EncodeToString(h.Sum(nil))
 			if !hmac.Equal([]byte(expected), []byte(sign)) {
-				http.Error(w, "sign not valid", http.StatusBadRequest)
+				writeProblem(w, models.NewAPIError(models.ErrCodeInvalidRequest, "", "sign not valid"), "")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -47,13 +47,18 @@ func WithSigningCheck(keyForSigning string) func(h http.Handler) http.Handler {
 func WithSigningResponse(keyForSigning string) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// body is kept only for signing, so streamed responses aren't buffered without key
+			if keyForSigning == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
 			recorder := responseRecorder{
 				ResponseWriter: w,
 				body:           []byte{},
 			}
 			next.ServeHTTP(&recorder, r)
 
-			if keyForSigning != "" && len(recorder.body) > 0 {
+			if len(recorder.body) > 0 {
 				h := hmac.New(sha256.New, []byte(keyForSigning))
 				h.Write(recorder.body)
 				signature := hex.EncodeToString(h.Sum(nil))
@@ -0,0 +1,115 @@
+// Package router consist API errors rendering
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// errorCodeStatus HTTP status of error code, internal error for unknown code
+var errorCodeStatus = map[models.ErrorCode]int{
+	models.ErrCodeNotFound:           http.StatusNotFound,
+	models.ErrCodeInvalidType:        http.StatusBadRequest,
+	models.ErrCodeInvalidValue:       http.StatusBadRequest,
+	models.ErrCodeInvalidName:        http.StatusBadRequest,
+	models.ErrCodeInvalidLabels:      http.StatusBadRequest,
+	models.ErrCodeInvalidRequest:     http.StatusBadRequest,
+	models.ErrCodeMethodNotAllowed:   http.StatusMethodNotAllowed,
+	models.ErrCodeForbidden:          http.StatusForbidden,
+	models.ErrCodeAborted:            http.StatusConflict,
+	models.ErrCodeRateLimited:        http.StatusTooManyRequests,
+	models.ErrCodeTooLarge:           http.StatusRequestEntityTooLarge,
+	models.ErrCodeStorageUnavailable: http.StatusServiceUnavailable,
+	models.ErrCodeInternal:           http.StatusInternalServerError,
+}
+
+// AsAPIError classifies error of storage or handler, errors of unknown kind are internal
+func AsAPIError(err error) *models.APIError {
+	var apiErr *models.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return &models.APIError{Code: validationErr.Code(), Metric: validationErr.Metric, Err: err}
+	}
+
+	code := models.ErrCodeInternal
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		code = models.ErrCodeTooLarge
+	case errors.Is(err, repositories.ErrNotFound), errors.Is(err, errMetricTypeNotFound):
+		code = models.ErrCodeNotFound
+	case errors.Is(err, models.ErrInvalidLabels):
+		code = models.ErrCodeInvalidLabels
+	case errors.Is(err, models.ErrHistogramBounds):
+		code = models.ErrCodeInvalidValue
+	case errors.Is(err, repositories.ErrUnavailable), errors.Is(err, context.DeadlineExceeded):
+		code = models.ErrCodeStorageUnavailable
+	}
+	return &models.APIError{Code: code, Err: err}
+}
+
+// errorStatus HTTP status for error returned by storage or handler
+func errorStatus(err error) int {
+	if status, ok := errorCodeStatus[AsAPIError(err).Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// writeProblem writes err as problem document, detail is the whole error message.
+// Metric named by caller is used if error isn't about particular metric.
+func writeProblem(w http.ResponseWriter, err error, metric string) {
+	writeProblemDocument(w, newProblem(err, metric))
+}
+
+// newProblem problem document of err, server side errors are logged
+func newProblem(err error, metric string) models.Problem {
+	apiErr := AsAPIError(err)
+	status := errorStatus(apiErr)
+	if status == http.StatusInternalServerError || status == http.StatusServiceUnavailable {
+		models.Log.Error(err.Error())
+	}
+	if apiErr.Metric != "" {
+		metric = apiErr.Metric
+	}
+	var fields []models.FieldError
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		fields = validationErr.Fields
+	}
+
+	return models.Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   apiErr.Code,
+		Metric: metric,
+		Errors: fields,
+	}
+}
+
+func writeProblemDocument(w http.ResponseWriter, p models.Problem) {
+	resp, err := json.Marshal(p)
+	if err != nil {
+		models.Log.Error(fmt.Sprintf("Error marshalling body: %v", err))
+		http.Error(w, p.Detail, p.Status)
+		return
+	}
+
+	w.Header().Set("content-type", models.ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if _, err = w.Write(resp); err != nil {
+		models.Log.Error(fmt.Sprintf("Error writing response: %v", err))
+	}
+}
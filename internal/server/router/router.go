@@ -3,41 +3,146 @@ package router
 
 import (
 	"crypto/rsa"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/Nikolay961996/metsys/internal/server/influx"
+	"github.com/Nikolay961996/metsys/internal/server/otlp"
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/internal/server/storage"
 )
 
 func MetricsRouterTest() *chi.Mux {
-	s := storage.NewFileStorage("/local.db", 5*time.Second, false)
+	s := storage.NewMemStorage()
 
 	return MetricsRouterWithServer(s, "", nil, "")
 }
 
-func MetricsRouterWithServer(s repositories.Storage, keyForSigning string, privateKey *rsa.PrivateKey, trustedSubnet string) *chi.Mux {
+// Option optional dependency of router
+type Option func(*options)
+
+type options struct {
+	alerts         AlertSource
+	deliveries     DeliverySource
+	samples        SampleSource
+	limiter        RateLimiter
+	limits         *BodyLimits
+	influxTemplate *influx.Template
+	influxCounters *influx.Counters
+}
+
+// WithAlerts serves alerts of source on /alerts and dashboard
+func WithAlerts(alerts AlertSource) Option {
+	return func(o *options) {
+		o.alerts = alerts
+	}
+}
+
+// WithNotifications serves webhook delivery status of source on /notifications
+func WithNotifications(deliveries DeliverySource) Option {
+	return func(o *options) {
+		o.deliveries = deliveries
+	}
+}
+
+// WithSamples serves recent samples of source on /grafana/query
+func WithSamples(samples SampleSource) Option {
+	return func(o *options) {
+		o.samples = samples
+	}
+}
+
+// WithRateLimiter throttles clients by limiter and serves its counters on /admin/ratelimit
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(o *options) {
+		o.limiter = limiter
+	}
+}
+
+// WithBodyLimits limits sizes of requests, DefaultBodyLimits if not set
+func WithBodyLimits(limits BodyLimits) Option {
+	return func(o *options) {
+		o.limits = &limits
+	}
+}
+
+// WithInfluxTemplate names metrics written by InfluxDB line protocol, influx.DefaultTemplate if not set
+func WithInfluxTemplate(template influx.Template) Option {
+	return func(o *options) {
+		o.influxTemplate = &template
+	}
+}
+
+// WithInfluxCounters integer fields of InfluxDB line protocol stored as counters, influx.DefaultCounters if not set
+func WithInfluxCounters(counters influx.Counters) Option {
+	return func(o *options) {
+		o.influxCounters = &counters
+	}
+}
+
+func MetricsRouterWithServer(s repositories.Storage, keyForSigning string, privateKey *rsa.PrivateKey, trustedSubnet string, opts ...Option) *chi.Mux {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.influxTemplate == nil {
+		template, _ := influx.NewTemplate(influx.DefaultTemplate)
+		o.influxTemplate = &template
+	}
+	if o.influxCounters == nil {
+		counters, _ := influx.NewCounters(influx.DefaultCounters)
+		o.influxCounters = &counters
+	}
+	if o.limits == nil {
+		o.limits = &DefaultBodyLimits
+	}
+
 	r := chi.NewRouter()
 	r.Use(
-		WithDecompressionRequest,
+		WithBodyLimit(o.limits.MaxBodySize),
+		WithDecompressionLimit(o.limits.MaxDecompressedSize),
 		WithLogger,
+		WithRateLimit(o.limiter),
 		WithDecrypt(privateKey),
 		WithSigningCheck(keyForSigning),
 		WithSigningResponse(keyForSigning),
 		WithTrustedSubnetValidation(trustedSubnet),
 	)
 
-	r.Get("/", WithCompressionResponse(getDashboardHandler(s)))
+	r.Get("/", WithCompressionResponse(getDashboardHandler(s, o.alerts)))
+	r.Get("/alerts", WithCompressionResponse(getAlertsHandler(o.alerts)))
+	r.Get("/notifications", WithCompressionResponse(getNotificationsHandler(o.deliveries)))
 	r.Get("/ping", pingDatabase(s))
+	r.Get("/admin/ratelimit", getRateLimitHandler(o.limiter))
+	r.Get("/metrics", WithCompressionResponse(getPrometheusMetricsHandler(s)))
 
 	r.Get("/value/{metricType}/{metricName}", getMetricValueHandler(s))
 	r.Post("/update/{metricType}/{metricName}/{metricValue}", updateMetricHandler(s))
 
+	r.Delete("/value/{metricType}/{metricName}", deleteMetricHandler(s))
+	r.Get("/values/", WithCompressionResponse(getMetricsListHandler(s)))
+	r.Get("/export", WithCompressionResponse(getExportHandler(s)))
+	r.Post("/import", WithCompressionResponse(importHandler(s)))
+	r.Delete("/values/", deleteMetricsHandler(s))
+	r.Post("/reset/{metricName}", resetCounterHandler(s))
+
+	r.Get("/history/{metricType}/{metricName}", WithCompressionResponse(getMetricHistoryHandler(s)))
+
 	r.Post("/value/", WithCompressionResponse(getMetricValueJSONHandler(s)))
 	r.Post("/update/", WithCompressionResponse(updateMetricJSONHandler(s)))
 
-	r.Post("/updates/", WithCompressionResponse(updatesMetricJSONHandler(s)))
+	r.Post("/updates/", WithCompressionResponse(updatesMetricJSONHandler(s, o.limits.MaxBatchSize)))
+
+	r.Post("/api/v1/write", remoteWriteHandler(s, o.limits.MaxDecompressedSize))
+	r.Post("/write", influxWriteHandler(s, *o.influxTemplate, *o.influxCounters))
+	r.Post("/query", influxQueryHandler())
+	r.Post("/v1/metrics", otlpMetricsHandler(otlp.NewReceiver(s)))
+
+	// Grafana JSON datasource, under prefix as /query is taken by InfluxDB API
+	r.Get("/grafana/", grafanaTestHandler())
+	r.Post("/grafana/search", WithCompressionResponse(grafanaSearchHandler(s)))
+	r.Post("/grafana/query", WithCompressionResponse(grafanaQueryHandler(o.samples)))
+	r.Post("/grafana/annotations", WithCompressionResponse(grafanaAnnotationsHandler(o.alerts)))
 
 	r.Post("/update/*", updateErrorPathHandler())
 
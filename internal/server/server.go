@@ -5,29 +5,60 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Nikolay961996/metsys/internal/crypto"
+	"github.com/Nikolay961996/metsys/internal/server/alerting"
+	"github.com/Nikolay961996/metsys/internal/server/grafana"
+	"github.com/Nikolay961996/metsys/internal/server/graphite"
+	"github.com/Nikolay961996/metsys/internal/server/influx"
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
+	"github.com/Nikolay961996/metsys/internal/server/otlp"
+	"github.com/Nikolay961996/metsys/internal/server/ratelimit"
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/internal/server/router"
+	"github.com/Nikolay961996/metsys/internal/server/statsd"
 	"github.com/Nikolay961996/metsys/internal/server/storage"
 	"github.com/Nikolay961996/metsys/models"
 	"github.com/Nikolay961996/metsys/proto"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
 )
 
+// historyPruneInterval period of removing history older than retention
+const historyPruneInterval = time.Minute
+
 type MetricServer struct {
-	Storage repositories.Storage
-	srv     *http.Server
-	grpcSrv *grpc.Server
+	Storage      repositories.Storage
+	srv          *http.Server
+	grpcSrv      *grpc.Server
+	statsd       *statsd.Server
+	graphite     *graphite.Server
+	alerts       *alerting.Engine
+	notifier     *notifier.Notifier
+	samples      *grafana.Recorder
+	limiter      *ratelimit.Limiter
+	stopAlerts   context.CancelFunc
+	stopSamples  context.CancelFunc
+	stopPruning  context.CancelFunc
+	stopNotifier context.CancelFunc
 }
 
 func InitServer(c *Config) MetricServer {
 	a := MetricServer{}
 
-	if c.DatabaseDSN != "" {
+	// before storage, so failures on start are reported too
+	if c.NotifyURLs != "" {
+		a.RunNotifier(strings.Split(c.NotifyURLs, ","), c.KeyForSigning)
+	}
+
+	if strings.HasPrefix(c.DatabaseDSN, storage.SQLiteScheme) {
+		a.Storage = storage.NewSQLiteStorage(strings.TrimPrefix(c.DatabaseDSN, storage.SQLiteScheme))
+	} else if c.DatabaseDSN != "" {
 		a.Storage = storage.NewDBStorage(c.DatabaseDSN)
 	} else if c.FileStoragePath != "" {
 		a.Storage = storage.NewFileStorage(c.FileStoragePath, c.StoreInterval, c.Restore)
@@ -43,8 +74,36 @@ func (s *MetricServer) Run(c *Config) {
 		panic("No port specified for either HTTP or gRPC server")
 	}
 
+	if c.RateLimits != "" {
+		rules, err := ratelimit.ParseRules(c.RateLimits)
+		if err != nil {
+			panic(err)
+		}
+		proxies, err := ratelimit.ParseProxies(c.RateLimitProxies)
+		if err != nil {
+			panic(err)
+		}
+		s.limiter = ratelimit.NewLimiter(rules, proxies)
+	}
+
+	if c.HistoryRetention > 0 {
+		s.RunRetention(c.HistoryRetention)
+	}
+
+	if c.AlertRulesFile != "" {
+		s.RunAlerting(c.AlertRulesFile, c.AlertInterval)
+	}
+
 	if c.GRPCPort != "" {
-		s.RunGRPC(c.GRPCPort, c.TrustedSubnet)
+		s.RunGRPC(c.GRPCPort, c.TrustedSubnet, c.BodyLimits())
+	}
+
+	if c.StatsDPort != "" {
+		s.RunStatsD(c.StatsDPort, c.StatsDAggregationInterval, c.StatsDFlushInterval)
+	}
+
+	if c.GraphitePort != "" {
+		s.RunGraphite(c.GraphitePort, c.TrustedSubnet)
 	}
 
 	if c.RunOnServerAddress != "" {
@@ -53,7 +112,38 @@ func (s *MetricServer) Run(c *Config) {
 			panic(fmt.Errorf("error parsing private key: %v", err))
 		}
 
-		handler := router.MetricsRouterWithServer(s.Storage, c.KeyForSigning, privateKey, c.TrustedSubnet)
+		if c.GrafanaSamples > 0 {
+			s.RunSamples(c.GrafanaSamples, c.GrafanaInterval)
+		}
+
+		opts := []router.Option{router.WithBodyLimits(c.BodyLimits())}
+		if s.alerts != nil {
+			opts = append(opts, router.WithAlerts(s.alerts))
+		}
+		if s.notifier != nil {
+			opts = append(opts, router.WithNotifications(s.notifier))
+		}
+		if s.samples != nil {
+			opts = append(opts, router.WithSamples(s.samples))
+		}
+		if s.limiter != nil {
+			opts = append(opts, router.WithRateLimiter(s.limiter))
+		}
+		if c.InfluxTemplate != "" {
+			template, err := influx.NewTemplate(c.InfluxTemplate)
+			if err != nil {
+				panic(err)
+			}
+			opts = append(opts, router.WithInfluxTemplate(template))
+		}
+		if c.InfluxCounters != "" {
+			counters, err := influx.NewCounters(c.InfluxCounters)
+			if err != nil {
+				panic(err)
+			}
+			opts = append(opts, router.WithInfluxCounters(counters))
+		}
+		handler := router.MetricsRouterWithServer(s.Storage, c.KeyForSigning, privateKey, c.TrustedSubnet, opts...)
 		s.srv = &http.Server{
 			Addr:    c.RunOnServerAddress,
 			Handler: handler,
@@ -63,17 +153,29 @@ func (s *MetricServer) Run(c *Config) {
 	}
 }
 
-func (s *MetricServer) RunGRPC(grpcPort string, trustedSubnet string) {
+// RunGRPC serves metrics and OTLP services on port, messages over max decompressed size and longer batches are rejected
+func (s *MetricServer) RunGRPC(grpcPort string, trustedSubnet string, limits router.BodyLimits) {
 	listener, err := net.Listen("tcp", grpcPort)
 	if err != nil {
 		panic(fmt.Errorf("failed to listen on gRPC port %s: %v", grpcPort, err))
 	}
 
+	var interceptors []grpc.UnaryServerInterceptor
+	if s.limiter != nil {
+		interceptors = append(interceptors, router.WithRateLimitInterceptor(s.limiter))
+	}
+	interceptors = append(interceptors, router.WithTrustedSubnetInterceptor(trustedSubnet))
+	maxMessageSize := math.MaxInt32
+	if limits.MaxDecompressedSize > 0 && limits.MaxDecompressedSize < math.MaxInt32 {
+		maxMessageSize = int(limits.MaxDecompressedSize)
+	}
 	s.grpcSrv = grpc.NewServer(
-		grpc.UnaryInterceptor(router.WithTrustedSubnetInterceptor(trustedSubnet)),
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.MaxRecvMsgSize(maxMessageSize),
 	)
 
-	proto.RegisterMetricsServiceServer(s.grpcSrv, &MetricsServiceServer{Storage: s.Storage})
+	proto.RegisterMetricsServiceServer(s.grpcSrv, &MetricsServiceServer{Storage: s.Storage, MaxBatchSize: limits.MaxBatchSize})
+	colmetricspb.RegisterMetricsServiceServer(s.grpcSrv, &OTLPMetricsServer{Receiver: otlp.NewReceiver(s.Storage)})
 
 	go func() {
 		if err := s.grpcSrv.Serve(listener); err != nil {
@@ -82,17 +184,107 @@ func (s *MetricServer) RunGRPC(grpcPort string, trustedSubnet string) {
 	}()
 }
 
+// RunStatsD receives StatsD samples on UDP and TCP port and writes aggregates to storage till Stop
+func (s *MetricServer) RunStatsD(port string, aggregationInterval time.Duration, flushInterval time.Duration) {
+	srv, err := statsd.Listen(port, statsd.NewAggregator(s.Storage))
+	if err != nil {
+		panic(fmt.Errorf("failed to listen on StatsD port %s: %v", port, err))
+	}
+	s.statsd = srv
+	srv.Run(aggregationInterval, flushInterval)
+}
+
+// RunGraphite receives Graphite plaintext lines on TCP port till Stop, peers outside trusted subnet are rejected
+func (s *MetricServer) RunGraphite(port string, trustedSubnet string) {
+	srv, err := graphite.Listen(port, s.Storage, func(addr net.Addr) bool {
+		return router.IsTrustedPeer(addr, trustedSubnet)
+	})
+	if err != nil {
+		panic(fmt.Errorf("failed to listen on Graphite port %s: %v", port, err))
+	}
+	s.graphite = srv
+	srv.Run()
+}
+
+// RunNotifier delivers operational events to webhooks till Stop
+func (s *MetricServer) RunNotifier(urls []string, keyForSigning string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.notifier = notifier.New(urls, keyForSigning)
+	s.stopNotifier = cancel
+	notifier.SetDefault(s.notifier)
+	go s.notifier.Run(ctx)
+}
+
+// RunAlerting loads alert rules and evaluates them in background till Stop
+func (s *MetricServer) RunAlerting(rulesFile string, interval time.Duration) {
+	rules, err := alerting.LoadRules(rulesFile)
+	if err != nil {
+		panic(err)
+	}
+	models.Log.Info(fmt.Sprintf("Loaded %d alert rules", len(rules)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.alerts = alerting.NewEngine(s.Storage, rules)
+	s.stopAlerts = cancel
+	go s.alerts.Run(ctx, interval)
+}
+
+// RunSamples records size recent samples per metric for Grafana every interval till Stop
+func (s *MetricServer) RunSamples(size int, interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.samples = grafana.NewRecorder(s.Storage, size)
+	s.stopSamples = cancel
+	go s.samples.Run(ctx, interval)
+}
+
+// RunRetention prunes history older than retention every minute till Stop, if storage supports it
+func (s *MetricServer) RunRetention(retention time.Duration) {
+	pruner, ok := s.Storage.(repositories.HistoryPruner)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopPruning = cancel
+	go storage.RunRetention(ctx, pruner, retention, historyPruneInterval)
+}
+
 // Stop gracefully shuts down the HTTP server and closes storage
 func (s *MetricServer) Stop(timeout time.Duration) {
 	models.Log.Warn("Server shutting down")
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	if s.stopAlerts != nil {
+		s.stopAlerts()
+	}
+	if s.stopSamples != nil {
+		s.stopSamples()
+	}
+	if s.stopPruning != nil {
+		s.stopPruning()
+	}
 	if s.srv != nil {
 		if err := s.srv.Shutdown(ctx); err != nil {
 			models.Log.Error("server shutdown error: " + err.Error())
 		}
 	}
-	s.Storage.Close()
+	if s.statsd != nil {
+		if err := s.statsd.Close(); err != nil {
+			models.Log.Error("StatsD listener close error: " + err.Error())
+		}
+	}
+	if s.graphite != nil {
+		if err := s.graphite.Close(); err != nil {
+			models.Log.Error("Graphite listener close error: " + err.Error())
+		}
+	}
+	if err := s.Storage.Close(); err != nil {
+		models.Log.Error("storage close error: " + err.Error())
+	}
+	if s.stopNotifier != nil {
+		s.notifier.Flush(timeout)
+		notifier.SetDefault(nil)
+		s.stopNotifier()
+	}
 }
 
 func runBackground(s *MetricServer) {
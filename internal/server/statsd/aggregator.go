@@ -0,0 +1,333 @@
+// Package statsd samples aggregation between flushes
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// TimerBounds histogram bucket bounds (milliseconds) timers are stored with
+var TimerBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+const (
+	finalFlushTimeout = 5 * time.Second
+	maxSealedWindows  = 1000 // windows kept while storage is unavailable, the oldest are dropped beyond it
+)
+
+type gaugeState struct {
+	value float64
+	delta float64 // relative changes after value
+	set   bool    // absolute value was received in window
+}
+
+// window samples aggregated over one aggregation interval
+type window struct {
+	counters map[string]float64
+	gauges   map[string]*gaugeState
+	timers   map[string]*models.HistogramData
+}
+
+func newWindow() *window {
+	return &window{
+		counters: map[string]float64{},
+		gauges:   map[string]*gaugeState{},
+		timers:   map[string]*models.HistogramData{},
+	}
+}
+
+// Aggregator collects samples into windows of aggregation interval
+// and writes sealed windows to storage on flush.
+// Counters are summed (scaled by sample rate), gauges keep last value with relative changes applied,
+// timers become histograms with TimerBounds.
+type Aggregator struct {
+	storage repositories.Storage
+	current *window
+	carry   map[string]float64 // fractional counter parts not written yet
+	sealed  []*window
+	mu      sync.Mutex
+	flushMu sync.Mutex
+}
+
+// NewAggregator aggregator writing into storage
+func NewAggregator(storage repositories.Storage) *Aggregator {
+	return &Aggregator{
+		storage: storage,
+		current: newWindow(),
+		carry:   map[string]float64{},
+	}
+}
+
+// Add puts sample into current window
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w := a.current
+	switch s.Type {
+	case TypeCounter:
+		w.counters[s.Name] += s.Value / s.Rate
+	case TypeGauge:
+		g, ok := w.gauges[s.Name]
+		if !ok {
+			g = &gaugeState{}
+			w.gauges[s.Name] = g
+		}
+		if s.Relative {
+			g.delta += s.Value
+		} else {
+			g.value, g.delta, g.set = s.Value, 0, true
+		}
+	case TypeTimer:
+		h, ok := w.timers[s.Name]
+		if !ok {
+			nh := models.NewHistogram(TimerBounds)
+			h = &nh
+			w.timers[s.Name] = h
+		}
+		h.ObserveN(s.Value, uint64(max(1, math.Round(1/s.Rate))))
+	}
+}
+
+// Seal closes current window, it is written on next Flush
+func (a *Aggregator) Seal() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w := a.current
+	if len(w.counters) == 0 && len(w.gauges) == 0 && len(w.timers) == 0 {
+		return
+	}
+	a.sealed = append(a.sealed, w)
+	a.current = newWindow()
+	a.dropOldest()
+}
+
+// dropOldest keeps at most maxSealedWindows sealed windows, must be called with mu held
+func (a *Aggregator) dropOldest() {
+	if n := len(a.sealed) - maxSealedWindows; n > 0 {
+		models.Log.Warn(fmt.Sprintf("StatsD: %d oldest windows dropped, storage is unavailable too long", n))
+		a.sealed = slices.Delete(a.sealed, 0, n)
+	}
+}
+
+// metricError write of one aggregated metric failed
+type metricError struct {
+	err   error
+	mtype string
+	name  string
+}
+
+func (e *metricError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.mtype, e.name, e.err)
+}
+
+func (e *metricError) Unwrap() error {
+	return e.err
+}
+
+// permanent metric is rejected and would be rejected again on retry
+func permanent(err error) bool {
+	var ve *models.ValidationError
+	return errors.As(err, &ve) || errors.Is(err, models.ErrHistogramBounds)
+}
+
+// Flush writes sealed windows in one transaction. Metrics rejected by validation or histogram bounds
+// are logged and dropped, the rest are written. Windows are kept for next Flush only if storage is unavailable.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	a.mu.Lock()
+	windows := a.sealed
+	a.sealed = nil
+	a.mu.Unlock()
+	if len(windows) == 0 {
+		return nil
+	}
+
+	b, err := a.aggregate(ctx, windows)
+	for err == nil {
+		var carry map[string]float64
+		if carry, err = a.write(ctx, b); err == nil {
+			a.carry = carry
+			return nil
+		}
+		var me *metricError
+		if !errors.As(err, &me) || !permanent(me.err) {
+			break
+		}
+		models.Log.Warn(fmt.Sprintf("StatsD metric dropped: %v", me))
+		b.drop(me)
+		err = nil
+	}
+	if errors.Is(err, repositories.ErrUnavailable) {
+		a.mu.Lock()
+		a.sealed = append(windows, a.sealed...)
+		a.dropOldest()
+		a.mu.Unlock()
+	}
+	return err
+}
+
+// batch aggregates of sealed windows to write
+type batch struct {
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string]*models.HistogramData
+}
+
+// drop removes metric of failed write from batch, fractional part of dropped counter is lost too
+func (b *batch) drop(e *metricError) {
+	switch e.mtype {
+	case models.Counter:
+		delete(b.counters, e.name)
+	case models.Gauge:
+		delete(b.gauges, e.name)
+	case models.Histogram:
+		delete(b.timers, e.name)
+	}
+}
+
+func (a *Aggregator) aggregate(ctx context.Context, windows []*window) (*batch, error) {
+	counters := map[string]float64{}
+	for name, v := range a.carry {
+		counters[name] = v
+	}
+	gauges := map[string]float64{}
+	timers := map[string]*models.HistogramData{}
+
+	for _, w := range windows {
+		for name, v := range w.counters {
+			counters[name] += v
+		}
+		for name, g := range w.gauges {
+			cur, ok := gauges[name]
+			switch {
+			case g.set:
+				cur = g.value
+			case !ok:
+				stored, err := a.storage.GetGauge(ctx, name)
+				if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+					return nil, fmt.Errorf("gauge %s: %w", name, err)
+				}
+				cur = stored
+			}
+			gauges[name] = cur + g.delta
+		}
+		for name, h := range w.timers {
+			if t, ok := timers[name]; ok {
+				if err := t.Merge(*h); err != nil {
+					models.Log.Warn(fmt.Sprintf("StatsD timer %s dropped: %v", name, err))
+				}
+			} else {
+				c := h.Clone()
+				timers[name] = &c
+			}
+		}
+	}
+
+	return &batch{counters: counters, gauges: gauges, timers: timers}, nil
+}
+
+// write validates and writes batch in one transaction, failure of one metric is returned as *metricError
+func (a *Aggregator) write(ctx context.Context, b *batch) (map[string]float64, error) {
+	tx, err := a.storage.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	carry := map[string]float64{}
+	for name, v := range b.counters {
+		whole := math.Trunc(v)
+		if frac := v - whole; frac != 0 {
+			carry[name] = frac
+		}
+		if whole == 0 {
+			continue
+		}
+		delta := int64(whole)
+		m := models.Metrics{ID: name, MType: models.Counter, Delta: &delta}
+		if err = m.Validate(); err == nil {
+			err = tx.AddCounter(ctx, name, delta)
+		}
+		if err != nil {
+			return nil, &metricError{mtype: models.Counter, name: name, err: err}
+		}
+	}
+	for name, v := range b.gauges {
+		m := models.Metrics{ID: name, MType: models.Gauge, Value: &v}
+		if err = m.Validate(); err == nil {
+			err = tx.SetGauge(ctx, name, v)
+		}
+		if err != nil {
+			return nil, &metricError{mtype: models.Gauge, name: name, err: err}
+		}
+	}
+	for name, h := range b.timers {
+		m := models.Metrics{ID: name, MType: models.Histogram, Histogram: h}
+		if err = m.Validate(); err == nil {
+			err = a.checkBounds(ctx, name, *h)
+		}
+		if err == nil {
+			err = tx.AddHistogram(ctx, name, *h)
+		}
+		if err != nil {
+			return nil, &metricError{mtype: models.Histogram, name: name, err: err}
+		}
+	}
+	return carry, tx.Commit()
+}
+
+// checkBounds fails with models.ErrHistogramBounds before write if stored histogram has other bounds,
+// storage may report it only on commit without telling which metric it is
+func (a *Aggregator) checkBounds(ctx context.Context, name string, h models.HistogramData) error {
+	stored, err := a.storage.GetHistogram(ctx, name)
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	case !slices.Equal(stored.Bounds, h.Bounds):
+		return fmt.Errorf("%w: bounds %v differ from stored %v", models.ErrHistogramBounds, h.Bounds, stored.Bounds)
+	}
+	return nil
+}
+
+// Run seals window every aggregationInterval and flushes every flushInterval until ctx is done,
+// then flushes what is left
+func (a *Aggregator) Run(ctx context.Context, aggregationInterval time.Duration, flushInterval time.Duration) {
+	aggregate := time.NewTicker(aggregationInterval)
+	defer aggregate.Stop()
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.Seal()
+			fctx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			if err := a.Flush(fctx); err != nil {
+				models.Log.Error(fmt.Sprintf("StatsD final flush error: %v", err))
+			}
+			cancel()
+			return
+		case <-aggregate.C:
+			a.Seal()
+		case <-flush.C:
+			if err := a.Flush(ctx); err != nil {
+				models.Log.Error(fmt.Sprintf("StatsD flush error: %v", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// TestAggregator тестирует агрегацию сэмплов и запись в хранилище
+func TestAggregator(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	require.NoError(t, s.SetGauge(ctx, "queue", 10))
+	a := NewAggregator(s)
+
+	for _, line := range []string{"hits:1|c", "hits:1|c|@0.5", "hits:0.5|c", "queue:+5|g", "queue:-2|g", "load:1|g", "load:3|g", "db:7|ms", "db:300|ms|@0.5", "rare:2|ms|@0.000001"} {
+		sample, err := ParseLine(line)
+		require.NoError(t, err)
+		a.Add(sample)
+	}
+
+	require.NoError(t, a.Flush(ctx))
+	_, err := s.GetCounter(ctx, "hits")
+	assert.Error(t, err, "nothing is written before window is sealed")
+
+	a.Seal()
+	require.NoError(t, a.Flush(ctx))
+
+	hits, err := s.GetCounter(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), hits, "fraction is carried to next flush")
+	queue, err := s.GetGauge(ctx, "queue")
+	require.NoError(t, err)
+	assert.InDelta(t, 13, queue, 1e-9)
+	load, err := s.GetGauge(ctx, "load")
+	require.NoError(t, err)
+	assert.InDelta(t, 3, load, 1e-9)
+	db, err := s.GetHistogram(ctx, "db")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), db.Count)
+	assert.InDelta(t, 607, db.Sum, 1e-9)
+	rare, err := s.GetHistogram(ctx, "rare")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000000), rare.Count, "one observation weighted by sample rate")
+	assert.InDelta(t, 2000000, rare.Sum, 1e-6)
+
+	for _, line := range []string{"hits:0.5|c", "queue:+1|g"} {
+		sample, err := ParseLine(line)
+		require.NoError(t, err)
+		a.Add(sample)
+	}
+	a.Seal()
+	require.NoError(t, a.Flush(ctx))
+	hits, err = s.GetCounter(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), hits)
+	queue, err = s.GetGauge(ctx, "queue")
+	require.NoError(t, err)
+	assert.InDelta(t, 14, queue, 1e-9)
+}
+
+// TestAggregator_RunFinalFlush тестирует запись остатков при остановке
+func TestAggregator_RunFinalFlush(t *testing.T) {
+	s := storage.NewMemStorage()
+	a := NewAggregator(s)
+	a.Add(Sample{Name: "hits", Type: TypeCounter, Value: 2, Rate: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx, time.Hour, time.Hour)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	hits, err := s.GetCounter(context.Background(), "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), hits)
+}
+
+type flakyStorage struct {
+	*storage.MemStorage
+	down bool
+}
+
+func (f *flakyStorage) Begin(ctx context.Context) (repositories.Tx, error) {
+	if f.down {
+		return nil, fmt.Errorf("%w: connection refused", repositories.ErrUnavailable)
+	}
+	return f.MemStorage.Begin(ctx)
+}
+
+// TestAggregator_FlushErrors тестирует отбрасывание отклонённых метрик и повтор только при недоступном хранилище
+func TestAggregator_FlushErrors(t *testing.T) {
+	ctx := context.Background()
+	s := &flakyStorage{MemStorage: storage.NewMemStorage()}
+	require.NoError(t, s.AddHistogram(ctx, "db", models.NewHistogram([]float64{1, 2})))
+	a := NewAggregator(s)
+
+	a.Add(Sample{Name: "hits", Type: TypeCounter, Value: 2, Rate: 1})
+	a.Add(Sample{Name: "bad name", Type: TypeCounter, Value: 1, Rate: 1})
+	a.Add(Sample{Name: "huge", Type: TypeGauge, Value: math.MaxFloat64, Relative: true, Rate: 1})
+	a.Add(Sample{Name: "huge", Type: TypeGauge, Value: math.MaxFloat64, Relative: true, Rate: 1})
+	a.Add(Sample{Name: "db", Type: TypeTimer, Value: 7, Rate: 1})
+	a.Add(Sample{Name: "load", Type: TypeGauge, Value: 3, Rate: 1})
+	a.Seal()
+
+	s.down = true
+	err := a.Flush(ctx)
+	assert.ErrorIs(t, err, repositories.ErrUnavailable)
+	assert.Len(t, a.sealed, 1, "windows are kept while storage is unavailable")
+
+	s.down = false
+	require.NoError(t, a.Flush(ctx), "rejected metrics don't block the rest")
+	assert.Empty(t, a.sealed)
+	hits, err := s.GetCounter(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), hits)
+	load, err := s.GetGauge(ctx, "load")
+	require.NoError(t, err)
+	assert.InDelta(t, 3, load, 1e-9)
+	_, err = s.GetCounter(ctx, "bad name")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	_, err = s.GetGauge(ctx, "huge")
+	assert.ErrorIs(t, err, repositories.ErrNotFound, "infinite gauge is rejected")
+	db, err := s.GetHistogram(ctx, "db")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), db.Count, "timer with other bounds is rejected")
+
+	s.down = true
+	for range maxSealedWindows + 5 {
+		a.Add(Sample{Name: "hits", Type: TypeCounter, Value: 1, Rate: 1})
+		a.Seal()
+	}
+	assert.Len(t, a.sealed, maxSealedWindows, "queue is bounded")
+	assert.Error(t, a.Flush(ctx))
+	assert.Len(t, a.sealed, maxSealedWindows)
+}
@@ -0,0 +1,90 @@
+// Package statsd StatsD protocol listener aggregating samples into storage
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLine StatsD line can't be parsed
+var ErrInvalidLine = errors.New("invalid statsd line")
+
+// Sample types of StatsD protocol
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+)
+
+// MinSampleRate lowest accepted sample rate, one sample stands for at most 1/MinSampleRate observations
+const MinSampleRate = 1e-6
+
+// Sample one parsed StatsD line: name:value|type[|@rate]
+type Sample struct {
+	Name     string
+	Type     string
+	Value    float64
+	Rate     float64 // sample rate in [MinSampleRate, 1], 1 if absent
+	Relative bool    // gauge value is change of current one (+N or -N)
+}
+
+// ParseLine parses single StatsD line, "h" type is treated as timer
+func ParseLine(line string) (Sample, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return Sample{}, fmt.Errorf("%w %q: no type", ErrInvalidLine, line)
+	}
+
+	i := strings.LastIndexByte(parts[0], ':')
+	if i <= 0 {
+		return Sample{}, fmt.Errorf("%w %q: no name or value", ErrInvalidLine, line)
+	}
+	s := Sample{Name: parts[0][:i], Type: parts[1], Rate: 1}
+	value := parts[0][i+1:]
+
+	var err error
+	s.Value, err = strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+		return Sample{}, fmt.Errorf("%w %q: bad value", ErrInvalidLine, line)
+	}
+
+	switch s.Type {
+	case TypeCounter:
+	case TypeGauge:
+		s.Relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case TypeTimer, "h":
+		s.Type = TypeTimer
+	default:
+		return Sample{}, fmt.Errorf("%w %q: unsupported type %q", ErrInvalidLine, line, s.Type)
+	}
+
+	for _, p := range parts[2:] {
+		if rate, ok := strings.CutPrefix(p, "@"); ok {
+			s.Rate, err = strconv.ParseFloat(rate, 64)
+			if err != nil || s.Rate < MinSampleRate || s.Rate > 1 {
+				return Sample{}, fmt.Errorf("%w %q: bad sample rate", ErrInvalidLine, line)
+			}
+		}
+	}
+	return s, nil
+}
+
+// ParsePacket parses newline separated lines, malformed lines are reported in errs
+func ParsePacket(packet string) (samples []Sample, errs []error) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		s, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples, errs
+}
@@ -0,0 +1,51 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseLine тестирует разбор строк протокола StatsD
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{"counter", "app.hits:3|c", Sample{Name: "app.hits", Type: TypeCounter, Value: 3, Rate: 1}, false},
+		{"sampled counter", "app.hits:1|c|@0.1", Sample{Name: "app.hits", Type: TypeCounter, Value: 1, Rate: 0.1}, false},
+		{"gauge", "queue:42.5|g", Sample{Name: "queue", Type: TypeGauge, Value: 42.5, Rate: 1}, false},
+		{"gauge increment", "queue:+3|g", Sample{Name: "queue", Type: TypeGauge, Value: 3, Rate: 1, Relative: true}, false},
+		{"gauge decrement", "queue:-2|g", Sample{Name: "queue", Type: TypeGauge, Value: -2, Rate: 1, Relative: true}, false},
+		{"timer", "db.query:12|ms|@0.5", Sample{Name: "db.query", Type: TypeTimer, Value: 12, Rate: 0.5}, false},
+		{"histogram alias", "db.query:7|h", Sample{Name: "db.query", Type: TypeTimer, Value: 7, Rate: 1}, false},
+		{"no type", "app.hits:3", Sample{}, true},
+		{"no name", ":3|c", Sample{}, true},
+		{"bad value", "app.hits:x|c", Sample{}, true},
+		{"set", "users:42|s", Sample{}, true},
+		{"bad rate", "app.hits:1|c|@2", Sample{}, true},
+		{"tiny rate", "t:1|ms|@0.0000000001", Sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestParsePacket тестирует разбор пакета из нескольких строк
+func TestParsePacket(t *testing.T) {
+	samples, errs := ParsePacket("a:1|c\n\nbroken\nb:2|g\n")
+	assert.Len(t, samples, 2)
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,152 @@
+// Package statsd UDP and TCP listeners
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+const maxPacketSize = 65535
+
+// Server receives StatsD lines over UDP packets and TCP streams on the same address
+type Server struct {
+	agg     *Aggregator
+	udp     net.PacketConn
+	tcp     net.Listener
+	conns   map[net.Conn]struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+	readers sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// Listen opens UDP and TCP listeners on addr, nothing is read until Run
+func Listen(addr string, agg *Aggregator) (*Server, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = udp.Close()
+		return nil, err
+	}
+	return &Server{
+		agg:   agg,
+		udp:   udp,
+		tcp:   tcp,
+		conns: map[net.Conn]struct{}{},
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// UDPAddr address of UDP listener
+func (s *Server) UDPAddr() net.Addr {
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr address of TCP listener
+func (s *Server) TCPAddr() net.Addr {
+	return s.tcp.Addr()
+}
+
+// Run starts reading and aggregation in background till Close
+func (s *Server) Run(aggregationInterval time.Duration, flushInterval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.readers.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	go func() {
+		s.agg.Run(ctx, aggregationInterval, flushInterval)
+		close(s.done)
+	}()
+}
+
+// Close stops listeners and writes samples received so far to storage
+func (s *Server) Close() error {
+	err := errors.Join(s.udp.Close(), s.tcp.Close())
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.readers.Wait()
+
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.readers.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				models.Log.Error(fmt.Sprintf("StatsD UDP read error: %v", err))
+			}
+			return
+		}
+		s.handle(string(buf[:n]))
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.readers.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				models.Log.Error(fmt.Sprintf("StatsD TCP accept error: %v", err))
+			}
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.readers.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.readers.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxPacketSize)
+	for scanner.Scan() {
+		s.handle(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		models.Log.Error(fmt.Sprintf("StatsD TCP read error: %v", err))
+	}
+}
+
+func (s *Server) handle(packet string) {
+	samples, errs := ParsePacket(packet)
+	for _, err := range errs {
+		models.Log.Warn(err.Error())
+	}
+	for _, sample := range samples {
+		s.agg.Add(sample)
+	}
+}
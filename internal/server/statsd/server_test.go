@@ -0,0 +1,53 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+)
+
+// TestServer тестирует приём метрик по UDP и TCP
+func TestServer(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv, err := Listen("127.0.0.1:0", NewAggregator(s))
+	require.NoError(t, err)
+	srv.Run(time.Hour, time.Hour)
+
+	udp, err := net.Dial("udp", srv.UDPAddr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(udp, "udp.hits:2|c\nqueue:5|g")
+	require.NoError(t, err)
+	udp.Close()
+
+	tcp, err := net.Dial("tcp", srv.TCPAddr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(tcp, "tcp.hits:3|c\nbroken\n")
+	require.NoError(t, err)
+	tcp.Close()
+
+	ctx := context.Background()
+	require.Eventually(t, func() bool {
+		srv.agg.mu.Lock()
+		defer srv.agg.mu.Unlock()
+		return len(srv.agg.current.counters) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, srv.Close())
+
+	hits, err := s.GetCounter(ctx, "udp.hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), hits)
+	hits, err = s.GetCounter(ctx, "tcp.hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), hits)
+	queue, err := s.GetGauge(ctx, "queue")
+	require.NoError(t, err)
+	assert.InDelta(t, 5, queue, 1e-9)
+}
@@ -0,0 +1,32 @@
+// Package storage history retention
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// RunRetention prunes history older than retention at start and then every interval until ctx is done
+func RunRetention(ctx context.Context, pruner repositories.HistoryPruner, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := pruner.PruneHistory(ctx, time.Now().Add(-retention))
+		if err != nil {
+			models.Log.Error(fmt.Sprintf("History pruning error: %v", err))
+		} else if pruned > 0 {
+			models.Log.Info(fmt.Sprintf("Pruned %d history points older than %v", pruned, retention))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -4,174 +4,599 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"path"
 	"strconv"
+	"time"
 
 	"github.com/Nikolay961996/metsys/utils"
 	"github.com/golang-migrate/migrate"
+	"github.com/golang-migrate/migrate/database"
 	"github.com/golang-migrate/migrate/database/postgres"
 	_ "github.com/golang-migrate/migrate/source/file"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/models"
 )
 
+// metricsPageSize metrics read from DB at once by EachMetric
+const metricsPageSize = 1000
+
 type DBStorage struct {
 	db                       *sql.DB
-	tx                       *sql.Tx
 	sqlInsertOrUpdateGauge   *sql.Stmt
 	sqlInsertOrUpdateCounter *sql.Stmt
+	sqlSetCounter            *sql.Stmt
+	sqlAddGauge              *sql.Stmt
 	sqlGetGauge              *sql.Stmt
 	sqlGetCounter            *sql.Stmt
 	sqlGetAll                *sql.Stmt
+	sqlGetMetricsPage        *sql.Stmt
+	sqlInsertHistory         *sql.Stmt
+	sqlGetHistory            *sql.Stmt
+	sqlDeleteMetric          *sql.Stmt
+	sqlDeleteHistory         *sql.Stmt
+	sqlResetCounter          *sql.Stmt
+	sqlInsertHistogram       *sql.Stmt
+	sqlGetHistogram          *sql.Stmt
+	sqlLockHistogram         *sql.Stmt
+	sqlUpdateHistogram       *sql.Stmt
+	sqlCountHistoryAfter     *sql.Stmt
+	sqlCounterTotalAt        *sql.Stmt
+	sqlShiftCounterHistory   *sql.Stmt
+	sqlPruneHistory          *sql.Stmt
 	databaseDSN              string
+	rowLock                  string // clause locking selected rows till end of transaction, empty if DB locks whole file
 }
 
 func NewDBStorage(databaseDSN string) *DBStorage {
-	s := DBStorage{}
-	s.open(databaseDSN)
-	s.migrate()
+	s := DBStorage{rowLock: " FOR UPDATE"}
+	s.open("pgx", databaseDSN)
+	s.migrate(func() (database.Driver, error) {
+		return postgres.WithInstance(s.db, &postgres.Config{})
+	})
 	s.prepareSQL()
 
 	return &s
 }
 
-func (m *DBStorage) SetGauge(metricName string, value float64) {
-	ctx := context.Background()
-	err := utils.RetryerCon(func() error {
-		_, err := m.sqlInsertOrUpdateGauge.ExecContext(ctx, metricName, value)
-		return err
-	}, shouldRetryDBError)
+func (m *DBStorage) SetGauge(ctx context.Context, metricName string, value float64) error {
+	err := m.retry(ctx, func() error {
+		return m.inTx(ctx, func(tx *dbTx) error {
+			return tx.SetGauge(ctx, metricName, value)
+		})
+	})
 	if err != nil {
 		models.Log.Error(fmt.Sprintf("Failed to set for metric %s: %s", metricName, err.Error()))
 	}
+	return err
 }
 
-func (m *DBStorage) GetGauge(metricName string) (float64, error) {
-	ctx := context.Background()
+func (m *DBStorage) GetGauge(ctx context.Context, metricName string) (float64, error) {
 	var value float64
-	err := utils.RetryerCon(func() error {
-		return m.sqlGetGauge.QueryRowContext(ctx, metricName).Scan(&value)
-	}, shouldRetryDBError)
-	return value, err
+	err := m.retry(ctx, func() error {
+		id, labels := seriesID(metricName)
+		return m.sqlGetGauge.QueryRowContext(ctx, id, labels).Scan(&value)
+	})
+	return value, notFoundOnNoRows(err)
 }
 
-func (m *DBStorage) AddCounter(metricName string, value int64) {
-	ctx := context.Background()
-	err := utils.RetryerCon(func() error {
-		_, err := m.sqlInsertOrUpdateCounter.ExecContext(ctx, metricName, value)
-		return err
-	}, shouldRetryDBError)
+func (m *DBStorage) AddCounter(ctx context.Context, metricName string, value int64) error {
+	err := m.retry(ctx, func() error {
+		return m.inTx(ctx, func(tx *dbTx) error {
+			return tx.AddCounter(ctx, metricName, value)
+		})
+	})
 	if err != nil {
 		models.Log.Error(fmt.Sprintf("failed to set for metric %s: %s", metricName, err.Error()))
 	}
+	return err
 }
 
-func (m *DBStorage) GetCounter(metricName string) (int64, error) {
-	ctx := context.Background()
+func (m *DBStorage) GetCounter(ctx context.Context, metricName string) (int64, error) {
 	var delta int64
-	err := utils.RetryerCon(func() error {
-		return m.sqlGetCounter.QueryRowContext(ctx, metricName).Scan(&delta)
-	}, shouldRetryDBError)
-	return delta, err
+	err := m.retry(ctx, func() error {
+		id, labels := seriesID(metricName)
+		return m.sqlGetCounter.QueryRowContext(ctx, id, labels).Scan(&delta)
+	})
+	return delta, notFoundOnNoRows(err)
+}
+
+func (m *DBStorage) AddHistogram(ctx context.Context, metricName string, value models.HistogramData) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	err := m.retry(ctx, func() error {
+		return m.inTx(ctx, func(tx *dbTx) error {
+			return tx.AddHistogram(ctx, metricName, value)
+		})
+	})
+	if err != nil {
+		models.Log.Error(fmt.Sprintf("Failed to merge histogram %s: %s", metricName, err.Error()))
+	}
+	return err
 }
 
-func (m *DBStorage) GetAll() []repositories.MetricDto {
+func (m *DBStorage) GetHistogram(ctx context.Context, metricName string) (models.HistogramData, error) {
+	var value models.HistogramData
+	var raw string
+	err := m.retry(ctx, func() error {
+		id, labels := seriesID(metricName)
+		return m.sqlGetHistogram.QueryRowContext(ctx, id, labels).Scan(&raw)
+	})
+	if err != nil {
+		return value, notFoundOnNoRows(err)
+	}
+	err = json.Unmarshal([]byte(raw), &value)
+	return value, err
+}
+
+func (m *DBStorage) GetAll(ctx context.Context) ([]repositories.MetricDto, error) {
 	var r []repositories.MetricDto
-	ctx := context.Background()
-	var rows *sql.Rows
+	err := m.EachMetric(ctx, func(dto repositories.MetricDto) error {
+		r = append(r, dto)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-	err := utils.RetryerCon(func() error {
-		rs, err := m.sqlGetAll.QueryContext(ctx)
-		if err != nil && rs.Err() != nil {
-			rows = rs
+// EachMetric reads metrics in pages of metricsPageSize in key order, page is read completely
+// before fn is called, so slow fn (e.g. export to slow client) doesn't hold DB connection
+func (m *DBStorage) EachMetric(ctx context.Context, fn func(repositories.MetricDto) error) error {
+	var lastID, lastLabels, lastType string
+	for {
+		var page []repositories.MetricDto
+		err := m.retry(ctx, func() error {
+			var err error
+			page, err = m.metricsPage(ctx, lastID, lastLabels, lastType)
+			return err
+		})
+		if err != nil {
+			models.Log.Error(err.Error())
+			return err
 		}
-		return err
-	}, shouldRetryDBError)
 
+		for _, dto := range page {
+			if err = fn(dto); err != nil {
+				return err
+			}
+		}
+		if len(page) < metricsPageSize {
+			return nil
+		}
+		last := page[len(page)-1]
+		lastID, lastLabels, lastType = last.Name, last.Labels.String(), last.Type
+	}
+}
+
+// metricsPage up to metricsPageSize metrics following key (id, labels, type)
+func (m *DBStorage) metricsPage(ctx context.Context, id string, labels string, metricType string) ([]repositories.MetricDto, error) {
+	rows, err := m.sqlGetMetricsPage.QueryContext(ctx, id, labels, metricType, metricsPageSize)
 	if err != nil {
-		models.Log.Error(err.Error())
-		return r
+		return nil, err
 	}
 	defer rows.Close()
 
+	page := make([]repositories.MetricDto, 0, metricsPageSize)
 	for rows.Next() {
 		var m repositories.MetricDto
+		var labels string
 		var valueNull sql.NullFloat64
 		var deltaNull sql.NullInt64
+		var histogramNull sql.NullString
 
-		err = rows.Scan(&m.Name, &m.Type, &valueNull, &deltaNull)
+		err = rows.Scan(&m.Name, &labels, &m.Type, &valueNull, &deltaNull, &histogramNull)
 		if err != nil {
-			models.Log.Error(err.Error())
-			return r
+			return nil, err
+		}
+		m.Labels, err = models.ParseLabels(labels)
+		if err != nil {
+			return nil, err
 		}
 		if valueNull.Valid {
 			m.Value = strconv.FormatFloat(valueNull.Float64, 'f', -1, 64)
 		} else if deltaNull.Valid {
 			m.Value = strconv.FormatInt(deltaNull.Int64, 10)
+		} else if histogramNull.Valid {
+			m.Histogram, err = parseHistogram(histogramNull)
+			if err != nil {
+				return nil, err
+			}
+			m.Value = m.Histogram.String()
 		}
+		page = append(page, m)
+	}
+	return page, rows.Err()
+}
 
-		r = append(r, m)
+func (m *DBStorage) GetHistory(ctx context.Context, metricType string, metricName string, from time.Time, to time.Time) ([]repositories.HistoryPoint, error) {
+	if metricType != models.Gauge && metricType != models.Counter && metricType != models.Histogram {
+		return nil, errors.New("metric type not found")
 	}
 
-	err = rows.Err()
+	id, labels := seriesID(metricName)
+	var rows *sql.Rows
+	err := m.retry(ctx, func() error {
+		rs, err := m.sqlGetHistory.QueryContext(ctx, id, labels, metricType, from.UTC(), to.UTC())
+		if err == nil {
+			rows = rs
+		}
+		return err
+	})
 	if err != nil {
-		models.Log.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := []repositories.HistoryPoint{}
+	for rows.Next() {
+		var p repositories.HistoryPoint
+		var valueNull sql.NullFloat64
+		var deltaNull sql.NullInt64
+		var histogramNull sql.NullString
+
+		err = rows.Scan(&valueNull, &deltaNull, &histogramNull, &p.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if valueNull.Valid {
+			p.Value = &valueNull.Float64
+		}
+		if deltaNull.Valid {
+			p.Delta = &deltaNull.Int64
+		}
+		if histogramNull.Valid {
+			p.Histogram, err = parseHistogram(histogramNull)
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.Timestamp = p.Timestamp.UTC()
+
+		r = append(r, p)
+	}
+
+	return r, rows.Err()
+}
+
+func (m *DBStorage) DeleteMetric(ctx context.Context, metricType string, metricName string) error {
+	return m.retry(ctx, func() error {
+		return m.inTx(ctx, func(tx *dbTx) error {
+			id, labels := seriesID(metricName)
+			return tx.deleteMetric(ctx, metricType, id, labels)
+		})
+	})
+}
+
+func (m *DBStorage) DeleteMetrics(ctx context.Context, pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
 	}
 
-	return r
+	var count int
+	err := m.retry(ctx, func() error {
+		count = 0
+		return m.inTx(ctx, func(tx *dbTx) error {
+			matched, err := tx.matchMetrics(ctx, pattern)
+			if err != nil {
+				return err
+			}
+			for _, mr := range matched {
+				if err = tx.deleteMetric(ctx, mr.MType, mr.ID, mr.Labels.String()); err != nil {
+					return err
+				}
+			}
+			count = len(matched)
+			return nil
+		})
+	})
+	return count, err
+}
+
+// PruneHistory deletes history rows older than before
+func (m *DBStorage) PruneHistory(ctx context.Context, before time.Time) (int, error) {
+	var pruned int64
+	err := m.retry(ctx, func() error {
+		res, err := m.sqlPruneHistory.ExecContext(ctx, before.UTC())
+		if err != nil {
+			return err
+		}
+		pruned, err = res.RowsAffected()
+		return err
+	})
+	return int(pruned), err
+}
+
+func (m *DBStorage) ResetCounter(ctx context.Context, metricName string) error {
+	return m.retry(ctx, func() error {
+		return m.inTx(ctx, func(tx *dbTx) error {
+			id, labels := seriesID(metricName)
+			res, err := tx.tx.StmtContext(ctx, m.sqlResetCounter).ExecContext(ctx, id, labels)
+			if err = notFoundOnNoAffected(res, err); err != nil {
+				return err
+			}
+			return tx.insertHistory(ctx, models.Counter, metricName, nil, int64(0), nil)
+		})
+	})
 }
 
-func (m *DBStorage) Close() {
-	defer m.db.Close()
+func (m *DBStorage) Close() error {
+	return m.db.Close()
 }
 
 func (m *DBStorage) PingContext(ctx context.Context) error {
 	return m.db.PingContext(ctx)
 }
 
-func (m *DBStorage) StartTransaction(ctx context.Context) error {
-	if m.tx != nil {
-		return errors.New("transaction already started")
+func (m *DBStorage) Begin(ctx context.Context) (repositories.Tx, error) {
+	var tx *dbTx
+	err := m.retry(ctx, func() error {
+		t, err := m.begin(ctx)
+		if err == nil {
+			tx = t
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return tx, nil
+}
 
+// begin starts transaction without retries, callers already run inside retry
+func (m *DBStorage) begin(ctx context.Context) (*dbTx, error) {
 	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{tx: tx, storage: m}, nil
+}
+
+// retry runs f with back-off on transient errors, outage left after retries is reported to notifier
+func (m *DBStorage) retry(ctx context.Context, f func() error) error {
+	err := utils.RetryerConContext(ctx, f, shouldRetryDBError)
+	if isUnavailableDBError(err) {
+		notifier.Emit(notifier.StorageUnavailable, "db", err.Error())
+		return fmt.Errorf("%w: %w", repositories.ErrUnavailable, err)
+	}
+	return err
+}
+
+// inTx runs f in own transaction, so metric and its history are written together.
+// It doesn't retry by itself, call it inside retry
+func (m *DBStorage) inTx(ctx context.Context, f func(tx *dbTx) error) error {
+	tx, err := m.begin(ctx)
 	if err != nil {
 		return err
 	}
-	m.tx = tx
+	if err = f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	return nil
+// dbTx runs prepared statements of DBStorage inside one sql transaction
+type dbTx struct {
+	tx      *sql.Tx
+	storage *DBStorage
+}
+
+func (t *dbTx) SetGauge(ctx context.Context, metricName string, value float64) error {
+	id, labels := seriesID(metricName)
+	_, err := t.tx.StmtContext(ctx, t.storage.sqlInsertOrUpdateGauge).ExecContext(ctx, id, labels, value)
+	if err != nil {
+		return err
+	}
+	return t.insertHistory(ctx, models.Gauge, metricName, value, nil, nil)
 }
 
-func (m *DBStorage) CommitTransaction() error {
-	if m.tx != nil {
-		return m.tx.Commit()
+func (t *dbTx) AddCounter(ctx context.Context, metricName string, value int64) error {
+	var total int64
+	id, labels := seriesID(metricName)
+	err := t.tx.StmtContext(ctx, t.storage.sqlInsertOrUpdateCounter).QueryRowContext(ctx, id, labels, value).Scan(&total)
+	if err != nil {
+		return err
 	}
-	return nil
+	return t.insertHistory(ctx, models.Counter, metricName, nil, total, nil)
+}
+
+func (t *dbTx) AddGauge(ctx context.Context, metricName string, delta float64) error {
+	var value float64
+	id, labels := seriesID(metricName)
+	err := t.tx.StmtContext(ctx, t.storage.sqlAddGauge).QueryRowContext(ctx, id, labels, delta).Scan(&value)
+	if err != nil {
+		return err
+	}
+	return t.insertHistory(ctx, models.Gauge, metricName, value, nil, nil)
+}
+
+func (t *dbTx) SetCounter(ctx context.Context, metricName string, value int64) error {
+	id, labels := seriesID(metricName)
+	_, err := t.tx.StmtContext(ctx, t.storage.sqlSetCounter).ExecContext(ctx, id, labels, value)
+	if err != nil {
+		return err
+	}
+	return t.insertHistory(ctx, models.Counter, metricName, nil, value, nil)
+}
+
+// SetGaugeAt inserts history point at ts, current value is updated only if there are no later points
+func (t *dbTx) SetGaugeAt(ctx context.Context, metricName string, value float64, ts time.Time) error {
+	id, labels := seriesID(metricName)
+	var later int
+	err := t.tx.StmtContext(ctx, t.storage.sqlCountHistoryAfter).QueryRowContext(ctx, id, labels, models.Gauge, ts.UTC()).Scan(&later)
+	if err != nil {
+		return err
+	}
+	if later == 0 {
+		_, err = t.tx.StmtContext(ctx, t.storage.sqlInsertOrUpdateGauge).ExecContext(ctx, id, labels, value)
+		if err != nil {
+			return err
+		}
+	}
+	return t.insertHistoryAt(ctx, models.Gauge, metricName, value, nil, nil, ts)
+}
+
+// AddCounterAt inserts running total at ts and shifts totals of later points by value
+func (t *dbTx) AddCounterAt(ctx context.Context, metricName string, value int64, ts time.Time) error {
+	id, labels := seriesID(metricName)
+	var total int64
+	err := t.tx.StmtContext(ctx, t.storage.sqlCounterTotalAt).QueryRowContext(ctx, id, labels, ts.UTC()).Scan(&total)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	_, err = t.tx.StmtContext(ctx, t.storage.sqlShiftCounterHistory).ExecContext(ctx, value, id, labels, ts.UTC())
+	if err != nil {
+		return err
+	}
+	var current int64
+	err = t.tx.StmtContext(ctx, t.storage.sqlInsertOrUpdateCounter).QueryRowContext(ctx, id, labels, value).Scan(&current)
+	if err != nil {
+		return err
+	}
+	return t.insertHistoryAt(ctx, models.Counter, metricName, nil, total+value, nil, ts)
+}
+
+func (t *dbTx) AddHistogram(ctx context.Context, metricName string, value models.HistogramData) error {
+	return t.mergeHistogram(ctx, metricName, value, false)
+}
+
+func (t *dbTx) AddCumulativeHistogram(ctx context.Context, metricName string, value models.HistogramData) error {
+	return t.mergeHistogram(ctx, metricName, value, true)
+}
+
+// mergeHistogram merges under row lock: row is created empty first, so concurrent first writes also merge.
+// For cumulative value only its growth since locked one is merged.
+func (t *dbTx) mergeHistogram(ctx context.Context, metricName string, value models.HistogramData, cumulative bool) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	empty, err := json.Marshal(models.NewHistogram(value.Bounds))
+	if err != nil {
+		return err
+	}
+	id, labels := seriesID(metricName)
+	_, err = t.tx.StmtContext(ctx, t.storage.sqlInsertHistogram).ExecContext(ctx, id, labels, string(empty))
+	if err != nil {
+		return err
+	}
+
+	var raw string
+	err = t.tx.StmtContext(ctx, t.storage.sqlLockHistogram).QueryRowContext(ctx, id, labels).Scan(&raw)
+	if err != nil {
+		return err
+	}
+	var merged models.HistogramData
+	if err = json.Unmarshal([]byte(raw), &merged); err != nil {
+		return err
+	}
+	if cumulative {
+		value = value.GrowthSince(merged)
+	}
+	if err = merged.Merge(value); err != nil {
+		return err
+	}
+
+	d, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.StmtContext(ctx, t.storage.sqlUpdateHistogram).ExecContext(ctx, string(d), id, labels)
+	if err != nil {
+		return err
+	}
+	return t.insertHistory(ctx, models.Histogram, metricName, nil, nil, string(d))
+}
+
+func (t *dbTx) deleteMetric(ctx context.Context, metricType string, id string, labels string) error {
+	res, err := t.tx.StmtContext(ctx, t.storage.sqlDeleteMetric).ExecContext(ctx, id, labels, metricType)
+	if err = notFoundOnNoAffected(res, err); err != nil {
+		return err
+	}
+	_, err = t.tx.StmtContext(ctx, t.storage.sqlDeleteHistory).ExecContext(ctx, id, labels, metricType)
+	return err
+}
+
+// matchMetrics metrics which names match pattern (labels aside), rows are read out before further statements run
+func (t *dbTx) matchMetrics(ctx context.Context, pattern string) ([]models.Metrics, error) {
+	rows, err := t.tx.StmtContext(ctx, t.storage.sqlGetAll).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []models.Metrics
+	for rows.Next() {
+		var mr models.Metrics
+		var labels string
+		var valueNull sql.NullFloat64
+		var deltaNull sql.NullInt64
+		var histogramNull sql.NullString
+		if err = rows.Scan(&mr.ID, &labels, &mr.MType, &valueNull, &deltaNull, &histogramNull); err != nil {
+			return nil, err
+		}
+		if mr.Labels, err = models.ParseLabels(labels); err != nil {
+			return nil, err
+		}
+		if ok, _ := path.Match(pattern, mr.ID); ok {
+			r = append(r, mr)
+		}
+	}
+	return r, rows.Err()
+}
+
+func (t *dbTx) Commit() error {
+	return txDone(t.tx.Commit())
+}
+
+func (t *dbTx) Rollback() error {
+	return txDone(t.tx.Rollback())
+}
+
+func (t *dbTx) insertHistory(ctx context.Context, metricType string, metricName string, value any, delta any, histogram any) error {
+	return t.insertHistoryAt(ctx, metricType, metricName, value, delta, histogram, time.Now())
 }
 
-func (m *DBStorage) migrate() {
+func (t *dbTx) insertHistoryAt(ctx context.Context, metricType string, metricName string, value any, delta any, histogram any, ts time.Time) error {
+	id, labels := seriesID(metricName)
+	_, err := t.tx.StmtContext(ctx, t.storage.sqlInsertHistory).ExecContext(ctx, id, labels, metricType, value, delta, histogram, ts.UTC())
+	return err
+}
+
+func txDone(err error) error {
+	if errors.Is(err, sql.ErrTxDone) {
+		return repositories.ErrTxDone
+	}
+	return err
+}
+
+func (m *DBStorage) migrate(newDriver func() (database.Driver, error)) {
 	migrateFunc := func() error {
-		driver, err := postgres.WithInstance(m.db, &postgres.Config{})
+		driver, err := newDriver()
 		if err != nil {
-			models.Log.Fatal(fmt.Sprintf("migration driver creation error: %s", err.Error()))
+			migrationFatal(fmt.Sprintf("migration driver creation error: %s", err.Error()))
 			return err
 		}
 
 		instance, err := migrate.NewWithDatabaseInstance("file://internal/server/migrations", m.databaseDSN, driver)
 		if err != nil {
-			models.Log.Fatal(fmt.Sprintf("migration instance creation error: %s", err.Error()))
+			migrationFatal(fmt.Sprintf("migration instance creation error: %s", err.Error()))
 			return err
 		}
 
 		if err := instance.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-			models.Log.Fatal(fmt.Sprintf("migration instance up error: %s", err.Error()))
+			migrationFatal(fmt.Sprintf("migration instance up error: %s", err.Error()))
 			return err
 		}
 		return nil
@@ -183,10 +608,10 @@ func (m *DBStorage) migrate() {
 	}
 }
 
-func (m *DBStorage) open(databaseDSN string) {
+func (m *DBStorage) open(driverName string, databaseDSN string) {
 	err := utils.RetryerCon(
 		func() error {
-			db, err := sql.Open("pgx", databaseDSN)
+			db, err := sql.Open(driverName, databaseDSN)
 			if err == nil {
 				m.db = db
 			}
@@ -202,9 +627,9 @@ func (m *DBStorage) open(databaseDSN string) {
 func (m *DBStorage) prepareSQL() {
 	sqlInsertOrUpdateGauge, err := m.db.Prepare(
 		`
-		INSERT INTO metrics (id, type, value)
-		VALUES ($1, 'gauge', $2)
-		ON CONFLICT (id, type) DO UPDATE 
+		INSERT INTO metrics (id, labels, type, value)
+		VALUES ($1, $2, 'gauge', $3)
+		ON CONFLICT (id, labels, type) DO UPDATE 
 		SET value = EXCLUDED.value;`)
 	if err != nil {
 		panic(err)
@@ -212,34 +637,223 @@ func (m *DBStorage) prepareSQL() {
 
 	sqlInsertOrUpdateCounter, err := m.db.Prepare(
 		`
-		INSERT INTO metrics (id, type, delta)
-		VALUES ($1, 'counter', $2)
-		ON CONFLICT (id, type) DO UPDATE 
-		SET delta = EXCLUDED.delta + metrics.delta;`)
+		INSERT INTO metrics (id, labels, type, delta)
+		VALUES ($1, $2, 'counter', $3)
+		ON CONFLICT (id, labels, type) DO UPDATE 
+		SET delta = EXCLUDED.delta + metrics.delta
+		RETURNING delta;`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlSetCounter, err := m.db.Prepare(
+		`
+		INSERT INTO metrics (id, labels, type, delta)
+		VALUES ($1, $2, 'counter', $3)
+		ON CONFLICT (id, labels, type) DO UPDATE 
+		SET delta = EXCLUDED.delta;`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlAddGauge, err := m.db.Prepare(
+		`
+		INSERT INTO metrics (id, labels, type, value)
+		VALUES ($1, $2, 'gauge', $3)
+		ON CONFLICT (id, labels, type) DO UPDATE 
+		SET value = EXCLUDED.value + metrics.value
+		RETURNING value;`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlGetGauge, err := m.db.Prepare(`SELECT value FROM metrics WHERE id = $1 AND labels = $2 AND type = 'gauge'`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlGetCounter, err := m.db.Prepare(`SELECT delta FROM metrics WHERE id = $1 AND labels = $2 AND type = 'counter'`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlGetAll, err := m.db.Prepare(`SELECT id, labels, type, value, delta, histogram FROM metrics`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlGetMetricsPage, err := m.db.Prepare(
+		`
+		SELECT id, labels, type, value, delta, histogram FROM metrics
+		WHERE (id, labels, type) > ($1, $2, $3)
+		ORDER BY id, labels, type
+		LIMIT $4;`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlInsertHistory, err := m.db.Prepare(
+		`
+		INSERT INTO metrics_history (id, labels, type, value, delta, histogram, ts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlGetHistory, err := m.db.Prepare(
+		`
+		SELECT value, delta, histogram, ts FROM metrics_history
+		WHERE id = $1 AND labels = $2 AND type = $3 AND ts >= $4 AND ts <= $5
+		ORDER BY ts;`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlDeleteMetric, err := m.db.Prepare(`DELETE FROM metrics WHERE id = $1 AND labels = $2 AND type = $3`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlDeleteHistory, err := m.db.Prepare(`DELETE FROM metrics_history WHERE id = $1 AND labels = $2 AND type = $3`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlResetCounter, err := m.db.Prepare(`UPDATE metrics SET delta = 0 WHERE id = $1 AND labels = $2 AND type = 'counter'`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlInsertHistogram, err := m.db.Prepare(
+		`
+		INSERT INTO metrics (id, labels, type, histogram)
+		VALUES ($1, $2, 'histogram', $3)
+		ON CONFLICT (id, labels, type) DO NOTHING;`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlGetHistogram, err := m.db.Prepare(`SELECT histogram FROM metrics WHERE id = $1 AND labels = $2 AND type = 'histogram'`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlLockHistogram, err := m.db.Prepare(`SELECT histogram FROM metrics WHERE id = $1 AND labels = $2 AND type = 'histogram'` + m.rowLock)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlUpdateHistogram, err := m.db.Prepare(`UPDATE metrics SET histogram = $1 WHERE id = $2 AND labels = $3 AND type = 'histogram'`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlCountHistoryAfter, err := m.db.Prepare(`SELECT COUNT(*) FROM metrics_history WHERE id = $1 AND labels = $2 AND type = $3 AND ts > $4`)
 	if err != nil {
 		panic(err)
 	}
 
-	sqlGetGauge, err := m.db.Prepare(`SELECT value FROM metrics WHERE id = $1 AND type = 'gauge'`)
+	sqlCounterTotalAt, err := m.db.Prepare(
+		`
+		SELECT delta FROM metrics_history
+		WHERE id = $1 AND labels = $2 AND type = 'counter' AND ts <= $3
+		ORDER BY ts DESC LIMIT 1;`)
 	if err != nil {
 		panic(err)
 	}
 
-	sqlGetCounter, err := m.db.Prepare(`SELECT delta FROM metrics WHERE id = $1 AND type = 'counter'`)
+	sqlShiftCounterHistory, err := m.db.Prepare(`UPDATE metrics_history SET delta = delta + $1 WHERE id = $2 AND labels = $3 AND type = 'counter' AND ts > $4`)
 	if err != nil {
 		panic(err)
 	}
 
-	sqlGetAll, err := m.db.Prepare(`SELECT id, type, value, delta FROM metrics`)
+	sqlPruneHistory, err := m.db.Prepare(`DELETE FROM metrics_history WHERE ts < $1`)
 	if err != nil {
 		panic(err)
 	}
 
 	m.sqlInsertOrUpdateGauge = sqlInsertOrUpdateGauge
 	m.sqlInsertOrUpdateCounter = sqlInsertOrUpdateCounter
+	m.sqlSetCounter = sqlSetCounter
+	m.sqlAddGauge = sqlAddGauge
 	m.sqlGetGauge = sqlGetGauge
 	m.sqlGetCounter = sqlGetCounter
 	m.sqlGetAll = sqlGetAll
+	m.sqlGetMetricsPage = sqlGetMetricsPage
+	m.sqlInsertHistory = sqlInsertHistory
+	m.sqlGetHistory = sqlGetHistory
+	m.sqlDeleteMetric = sqlDeleteMetric
+	m.sqlDeleteHistory = sqlDeleteHistory
+	m.sqlResetCounter = sqlResetCounter
+	m.sqlInsertHistogram = sqlInsertHistogram
+	m.sqlGetHistogram = sqlGetHistogram
+	m.sqlLockHistogram = sqlLockHistogram
+	m.sqlUpdateHistogram = sqlUpdateHistogram
+	m.sqlCountHistoryAfter = sqlCountHistoryAfter
+	m.sqlCounterTotalAt = sqlCounterTotalAt
+	m.sqlShiftCounterHistory = sqlShiftCounterHistory
+	m.sqlPruneHistory = sqlPruneHistory
+}
+
+// seriesID splits series key into id and labels columns
+func seriesID(metricName string) (string, string) {
+	name, labels := models.SplitSeriesKey(metricName)
+	return name, labels.String()
+}
+
+func notFoundOnNoRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return repositories.ErrNotFound
+	}
+	return err
+}
+
+func parseHistogram(raw sql.NullString) (*models.HistogramData, error) {
+	var h models.HistogramData
+	if err := json.Unmarshal([]byte(raw.String), &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func notFoundOnNoAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+// migrationFatal reports migration failure and stops server
+func migrationFatal(msg string) {
+	notifier.EmitSync(notifier.MigrationFailed, "db", msg, 10*time.Second)
+	models.Log.Fatal(msg)
+}
+
+// isUnavailableDBError connection level failure, DB can't serve any request
+func isUnavailableDBError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) ||
+			pgErr.Code == pgerrcode.AdminShutdown ||
+			pgErr.Code == pgerrcode.CannotConnectNow ||
+			pgErr.Code == pgerrcode.TooManyConnections
+	}
+	return false
 }
 
 func shouldRetryDBError(err error) bool {
@@ -260,5 +874,5 @@ func shouldRetryDBError(err error) bool {
 		}
 	}
 
-	return false
+	return sqliteRetryable(err)
 }
@@ -1,10 +1,21 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 )
@@ -94,3 +105,62 @@ func TestShouldRetryDBError(t *testing.T) {
 		})
 	}
 }
+
+// downConnector отдает соединения, на которых нельзя начать транзакцию
+type downConnector struct {
+	begins *atomic.Int32
+}
+
+func (c downConnector) Connect(context.Context) (driver.Conn, error) { return downConn(c), nil }
+func (c downConnector) Driver() driver.Driver                        { return nil }
+
+type downConn struct {
+	begins *atomic.Int32
+}
+
+func (c downConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c downConn) Close() error                        { return nil }
+func (c downConn) Begin() (driver.Tx, error) {
+	c.begins.Add(1)
+	return nil, &net.OpError{Op: "write", Net: "tcp", Err: errors.New("connection reset by peer")}
+}
+
+// TestDBStorage_RetryOnce тестирует, что запись повторяется на одном уровне и сбой сообщается один раз
+func TestDBStorage_RetryOnce(t *testing.T) {
+	var mu sync.Mutex
+	var kinds []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notifier.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		kinds = append(kinds, string(e.Kind))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := notifier.New([]string{ts.URL}, "")
+	go n.Run(ctx)
+	notifier.SetDefault(n)
+	defer notifier.SetDefault(nil)
+
+	var begins atomic.Int32
+	s := &DBStorage{db: sql.OpenDB(downConnector{begins: &begins})}
+	defer s.Close()
+
+	err := s.AddCounter(ctx, "test", 1)
+	if !errors.Is(err, repositories.ErrUnavailable) {
+		t.Fatalf("Expected ErrUnavailable, got %v", err)
+	}
+	if got := begins.Load(); got != 1 {
+		t.Errorf("Expected one begin attempt, got %d", got)
+	}
+	n.Flush(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(kinds) != 1 || kinds[0] != string(notifier.StorageUnavailable) {
+		t.Errorf("Expected one storage_unavailable event, got %v", kinds)
+	}
+}
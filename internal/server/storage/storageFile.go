@@ -4,19 +4,35 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/models"
 	"github.com/Nikolay961996/metsys/utils"
 )
 
+// walCompactRecords journal length that triggers snapshot in sync mode
+const walCompactRecords = 1000
+
+// FileStorage in memory storage persisted as JSON snapshot plus write-ahead journal.
+// Every write is appended to journal before it is applied, snapshot is rewritten
+// atomically by timer (or when journal grows in sync mode) and journal is reset after it.
+// Files are left as they are till storage owns them: after restore or on first write.
 type FileStorage struct {
 	*MemStorage
 	saveTimer     *time.Ticker
 	savesFilePath string
+	journal       walJournal
+	saveMu        sync.RWMutex
+	journalMu     sync.Mutex
+	ownOnce       sync.Once
+	owned         atomic.Bool
 	isSyncSave    bool
 }
 
@@ -24,60 +40,185 @@ func NewFileStorage(savesFile string, savePeriod time.Duration, restore bool) *F
 	s := FileStorage{
 		MemStorage:    NewMemStorage(),
 		savesFilePath: savesFile,
+		journal:       walJournal{path: savesFile + walSuffix},
 		isSyncSave:    savePeriod == 0,
 	}
 
+	if restore && s.restore() == nil {
+		// fold restored journal into fresh snapshot
+		s.own()
+	}
+
 	if !s.isSyncSave {
 		s.saveTimer = time.NewTicker(savePeriod)
 		go s.backgroundSaver()
 	}
 
-	if restore {
-		d, err := os.ReadFile(savesFile)
-		if err != nil {
-			models.Log.Error(err.Error())
-			return &s
-		}
-		err = json.Unmarshal(d, &s)
+	return &s
+}
+
+func (m *FileStorage) restore() error {
+	var snapshot memSnapshot
+	d, err := os.ReadFile(m.savesFilePath)
+	if err == nil {
+		err = json.Unmarshal(d, &snapshot)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		models.Log.Error(err.Error())
+		return err
+	}
+	m.MemStorage.load(snapshot)
+
+	err = m.journal.replay(snapshot.WalSeq, func(r walRecord) error {
+		ops, err := r.ops()
 		if err != nil {
-			models.Log.Error(err.Error())
-			return &s
+			return err
 		}
+		return m.MemStorage.apply(ops, r.Timestamp)
+	})
+	if err != nil {
+		models.Log.Error(err.Error())
 	}
+	return err
+}
 
-	return &s
+// own replaces files of previous run with current state, once
+func (m *FileStorage) own() {
+	m.ownOnce.Do(func() {
+		m.owned.Store(true)
+		_ = m.tryFlushToFile()
+	})
 }
 
-func (m *FileStorage) SetGauge(metricName string, value float64) {
-	m.MemStorage.SetGauge(metricName, value)
-	if m.isSyncSave {
-		m.tryFlushToFile()
+func (m *FileStorage) SetGauge(_ context.Context, metricName string, value float64) error {
+	return m.write([]memOp{{name: metricName, metricType: models.Gauge, value: value}})
+}
+
+func (m *FileStorage) AddCounter(_ context.Context, metricName string, value int64) error {
+	return m.write([]memOp{{name: metricName, metricType: models.Counter, delta: value}})
+}
+
+func (m *FileStorage) AddHistogram(_ context.Context, metricName string, value models.HistogramData) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	return m.write([]memOp{{name: metricName, metricType: models.Histogram, histogram: value.Clone()}})
+}
+
+// PruneHistory removes points older than before, in sync mode snapshot is rewritten at once
+func (m *FileStorage) PruneHistory(ctx context.Context, before time.Time) (int, error) {
+	pruned, err := m.MemStorage.PruneHistory(ctx, before)
+	if err == nil && pruned > 0 && m.isSyncSave {
+		err = m.tryFlushToFile()
 	}
+	return pruned, err
+}
+
+func (m *FileStorage) DeleteMetric(_ context.Context, metricType string, metricName string) error {
+	_, err := m.writeBuilt(func() ([]memOp, error) {
+		if !m.MemStorage.has(metricType, metricName) {
+			return nil, repositories.ErrNotFound
+		}
+		return []memOp{{name: metricName, metricType: metricType, kind: opDelete}}, nil
+	})
+	return err
+}
+
+func (m *FileStorage) DeleteMetrics(_ context.Context, pattern string) (int, error) {
+	return m.writeBuilt(func() ([]memOp, error) {
+		return m.MemStorage.matchDeletes(pattern)
+	})
+}
+
+func (m *FileStorage) ResetCounter(_ context.Context, metricName string) error {
+	_, err := m.writeBuilt(func() ([]memOp, error) {
+		if !m.MemStorage.has(models.Counter, metricName) {
+			return nil, repositories.ErrNotFound
+		}
+		return []memOp{{name: metricName, metricType: models.Counter, kind: opReset}}, nil
+	})
+	return err
+}
+
+// write journals ops and applies them to memory.
+// Batch that can't be applied is rejected before journaling,
+// memory is updated even if journal failed, the error is reported to caller.
+func (m *FileStorage) write(ops []memOp) error {
+	_, err := m.writeBuilt(func() ([]memOp, error) {
+		return ops, nil
+	})
+	return err
 }
 
-func (m *FileStorage) AddCounter(metricName string, value int64) {
-	m.MemStorage.AddCounter(metricName, value)
-	if m.isSyncSave {
-		m.tryFlushToFile()
+// writeBuilt same as write, ops are built under journal lock so checks made by build stay valid
+func (m *FileStorage) writeBuilt(build func() ([]memOp, error)) (int, error) {
+	m.own()
+	m.saveMu.RLock()
+	m.journalMu.Lock()
+
+	ops, err := build()
+	if err == nil {
+		err = m.MemStorage.check(ops)
+	}
+	if err != nil || len(ops) == 0 {
+		m.journalMu.Unlock()
+		m.saveMu.RUnlock()
+		return 0, err
+	}
+
+	ts := time.Now().UTC()
+	err = m.journal.append(newWalRecord(ops, ts), m.isSyncSave)
+	// can't fail: all writers are serialized by journalMu and ops are checked above
+	_ = m.MemStorage.apply(ops, ts)
+	compact := m.isSyncSave && m.journal.records >= walCompactRecords
+
+	m.journalMu.Unlock()
+	m.saveMu.RUnlock()
+
+	if err != nil {
+		models.Log.Error("Failed to journal metrics: " + err.Error())
+		notifier.Emit(notifier.FlushFailed, "file", "journal: "+err.Error())
+		return len(ops), err
+	}
+	if compact {
+		return len(ops), m.tryFlushToFile()
 	}
+	return len(ops), nil
+}
+
+func (m *FileStorage) GetCounter(ctx context.Context, metricName string) (int64, error) {
+	return m.MemStorage.GetCounter(ctx, metricName)
+}
+
+func (m *FileStorage) GetGauge(ctx context.Context, metricName string) (float64, error) {
+	return m.MemStorage.GetGauge(ctx, metricName)
+}
+
+func (m *FileStorage) GetHistogram(ctx context.Context, metricName string) (models.HistogramData, error) {
+	return m.MemStorage.GetHistogram(ctx, metricName)
 }
 
-func (m *FileStorage) GetCounter(metricName string) (int64, error) {
-	return m.MemStorage.GetCounter(metricName)
+func (m *FileStorage) GetAll(ctx context.Context) ([]repositories.MetricDto, error) {
+	return m.MemStorage.GetAll(ctx)
 }
 
-func (m *FileStorage) GetGauge(metricName string) (float64, error) {
-	return m.MemStorage.GetGauge(metricName)
+func (m *FileStorage) EachMetric(ctx context.Context, fn func(repositories.MetricDto) error) error {
+	return m.MemStorage.EachMetric(ctx, fn)
 }
 
-func (m *FileStorage) GetAll() []repositories.MetricDto {
-	return m.MemStorage.GetAll()
+func (m *FileStorage) GetHistory(ctx context.Context, metricType string, metricName string, from time.Time, to time.Time) ([]repositories.HistoryPoint, error) {
+	return m.MemStorage.GetHistory(ctx, metricType, metricName, from, to)
 }
 
-func (m *FileStorage) Close() {
+func (m *FileStorage) Close() error {
 	if !m.isSyncSave && m.saveTimer != nil {
 		m.saveTimer.Stop()
 	}
+	err := m.tryFlushToFile()
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	return errors.Join(err, m.journal.close())
 }
 
 func (m *FileStorage) PingContext(_ context.Context) error {
@@ -86,32 +227,52 @@ func (m *FileStorage) PingContext(_ context.Context) error {
 
 func (m *FileStorage) backgroundSaver() {
 	for range m.saveTimer.C {
-		m.tryFlushToFile()
+		_ = m.tryFlushToFile()
 	}
 }
 
-func (m *FileStorage) StartTransaction(_ context.Context) error {
-	return nil
+func (m *FileStorage) Begin(_ context.Context) (repositories.Tx, error) {
+	return &fileTx{memTx: m.MemStorage.begin(), storage: m}, nil
 }
 
-func (m *FileStorage) CommitTransaction() error {
-	return nil
+// fileTx journals and applies batch at Commit as a single record
+type fileTx struct {
+	*memTx
+	storage *FileStorage
+}
+
+func (t *fileTx) Commit() error {
+	if t.done {
+		return repositories.ErrTxDone
+	}
+	t.done = true
+	return t.storage.write(t.ops)
 }
 
-func (m *FileStorage) tryFlushToFile() {
+// tryFlushToFile writes compacted snapshot and resets journal.
+// Snapshot keeps seq of the last journaled record, so a crash before reset doesn't apply journal twice.
+func (m *FileStorage) tryFlushToFile() error {
+	if !m.owned.Load() {
+		return nil
+	}
 	models.Log.Info("Metrics try save")
 
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
 	flushFunc := func() error {
-		d, err := json.MarshalIndent(m, "", "  ")
+		snapshot := m.MemStorage.snapshot()
+		snapshot.WalSeq = m.journal.seq
+		d, err := json.MarshalIndent(snapshot, "", "  ")
 		if err != nil {
 			return fmt.Errorf("json marshal error: %w", err)
 		}
 
-		err = os.WriteFile(m.savesFilePath, d, 0666)
+		err = writeFileAtomic(m.savesFilePath, d)
 		if err != nil {
 			return fmt.Errorf("write file error: %w", err)
 		}
-		return nil
+		return m.journal.reset()
 	}
 
 	err := utils.Retryer(
@@ -120,7 +281,9 @@ func (m *FileStorage) tryFlushToFile() {
 	)
 	if err != nil {
 		models.Log.Error("Failed to save metrics after retries: " + err.Error())
-	} else {
-		models.Log.Info("Save success")
+		notifier.Emit(notifier.FlushFailed, "file", err.Error())
+		return err
 	}
+	models.Log.Info("Save success")
+	return nil
 }
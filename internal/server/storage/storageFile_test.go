@@ -1,16 +1,25 @@
 package storage_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Nikolay961996/metsys/internal/server/notifier"
 	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
 )
 
 // TestFileStorage_BasicOperations тестирует базовые операции FileStorage
 func TestFileStorage_BasicOperations(t *testing.T) {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "test_storage_*.tmp")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
@@ -21,8 +30,8 @@ func TestFileStorage_BasicOperations(t *testing.T) {
 	s := storage.NewFileStorage(tmpFile.Name(), 0, false) // sync mode
 	defer s.Close()
 
-	s.SetGauge("temperature", 23.5)
-	value, err := s.GetGauge("temperature")
+	s.SetGauge(ctx, "temperature", 23.5)
+	value, err := s.GetGauge(ctx, "temperature")
 	if err != nil {
 		t.Errorf("GetGauge failed: %v", err)
 	}
@@ -30,9 +39,9 @@ func TestFileStorage_BasicOperations(t *testing.T) {
 		t.Errorf("Expected 23.5, got %f", value)
 	}
 
-	s.AddCounter("requests", 10)
-	s.AddCounter("requests", 5)
-	valueInt, err := s.GetCounter("requests")
+	s.AddCounter(ctx, "requests", 10)
+	s.AddCounter(ctx, "requests", 5)
+	valueInt, err := s.GetCounter(ctx, "requests")
 	if err != nil {
 		t.Errorf("GetCounter failed: %v", err)
 	}
@@ -43,6 +52,7 @@ func TestFileStorage_BasicOperations(t *testing.T) {
 
 // TestFileStorage_Persistence тестирует сохранение и восстановление данных
 func TestFileStorage_Persistence(t *testing.T) {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "test_persistence_*.tmp")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
@@ -51,14 +61,14 @@ func TestFileStorage_Persistence(t *testing.T) {
 	defer os.Remove(tmpFile.Name())
 
 	s1 := storage.NewFileStorage(tmpFile.Name(), 0, false)
-	s1.SetGauge("cpu_usage", 75.5)
-	s1.AddCounter("requests", 100)
+	s1.SetGauge(ctx, "cpu_usage", 75.5)
+	s1.AddCounter(ctx, "requests", 100)
 	s1.Close()
 
 	s2 := storage.NewFileStorage(tmpFile.Name(), 0, true)
 	defer s2.Close()
 
-	value, err := s2.GetGauge("cpu_usage")
+	value, err := s2.GetGauge(ctx, "cpu_usage")
 	if err != nil {
 		t.Errorf("Failed to restore gauge: %v", err)
 	}
@@ -66,7 +76,7 @@ func TestFileStorage_Persistence(t *testing.T) {
 		t.Errorf("Expected gauge value 75.5, got %f", value)
 	}
 
-	valueInt, err := s2.GetCounter("requests")
+	valueInt, err := s2.GetCounter(ctx, "requests")
 	if err != nil {
 		t.Errorf("Failed to restore counter: %v", err)
 	}
@@ -77,6 +87,7 @@ func TestFileStorage_Persistence(t *testing.T) {
 
 // TestFileStorage_AsyncSave тестирует асинхронное сохранение
 func TestFileStorage_AsyncSave(t *testing.T) {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "test_async_*.tmp")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
@@ -88,8 +99,8 @@ func TestFileStorage_AsyncSave(t *testing.T) {
 	s := storage.NewFileStorage(tmpFile.Name(), savePeriod, false)
 	defer s.Close()
 
-	s.SetGauge("async_metric", 99.9)
-	s.AddCounter("async_counter", 42)
+	s.SetGauge(ctx, "async_metric", 99.9)
+	s.AddCounter(ctx, "async_counter", 42)
 
 	time.Sleep(2 * savePeriod)
 
@@ -104,6 +115,7 @@ func TestFileStorage_AsyncSave(t *testing.T) {
 
 // TestFileStorage_GetAll тестирует получение всех метрик
 func TestFileStorage_GetAll(t *testing.T) {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "test_getall_*.tmp")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
@@ -114,25 +126,349 @@ func TestFileStorage_GetAll(t *testing.T) {
 	s := storage.NewFileStorage(tmpFile.Name(), 0, false)
 	defer s.Close()
 
-	s.SetGauge("metric1", 1.0)
-	s.SetGauge("metric2", 2.0)
-	s.AddCounter("counter1", 10)
-	s.AddCounter("counter2", 20)
+	s.SetGauge(ctx, "metric1", 1.0)
+	s.SetGauge(ctx, "metric2", 2.0)
+	s.AddCounter(ctx, "counter1", 10)
+	s.AddCounter(ctx, "counter2", 20)
 
-	metrics := s.GetAll()
+	metrics, _ := s.GetAll(ctx)
 	if len(metrics) != 4 {
 		t.Errorf("Expected 4 metrics, got %d", len(metrics))
 	}
 }
 
+// TestFileStorage_Transaction тестирует сохранение транзакции в файл одним сбросом
+func TestFileStorage_Transaction(t *testing.T) {
+	ctx := context.Background()
+	tmpFile, err := os.CreateTemp("", "test_tx_*.tmp")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	s1 := storage.NewFileStorage(tmpFile.Name(), 0, false)
+	tx, err := s1.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	tx.SetGauge(ctx, "committed", 1.0)
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	tx, _ = s1.Begin(ctx)
+	tx.SetGauge(ctx, "rolled_back", 2.0)
+	tx.Rollback()
+	s1.Close()
+
+	s2 := storage.NewFileStorage(tmpFile.Name(), 0, true)
+	defer s2.Close()
+	if _, err = s2.GetGauge(ctx, "committed"); err != nil {
+		t.Errorf("Committed gauge not restored: %v", err)
+	}
+	if _, err = s2.GetGauge(ctx, "rolled_back"); err == nil {
+		t.Error("Rolled back gauge must not be saved")
+	}
+}
+
+// TestFileStorage_JournalReplay тестирует восстановление из журнала без сохранённого снимка
+func TestFileStorage_JournalReplay(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	// снимок по таймеру не успевает сохраниться, данные есть только в журнале
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	s1.SetGauge(ctx, "gauge", 1.5)
+	s1.AddCounter(ctx, "counter", 3)
+	s1.AddCounter(ctx, "counter", 4)
+	tx, _ := s1.Begin(ctx)
+	tx.SetGauge(ctx, "gauge", 2.5)
+	tx.AddCounter(ctx, "counter", 5)
+	tx.Commit()
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+
+	value, err := s2.GetGauge(ctx, "gauge")
+	if err != nil || value != 2.5 {
+		t.Errorf("Expected gauge 2.5, got %f (%v)", value, err)
+	}
+	counter, err := s2.GetCounter(ctx, "counter")
+	if err != nil || counter != 12 {
+		t.Errorf("Expected counter 12, got %d (%v)", counter, err)
+	}
+	history, _ := s2.GetHistory(ctx, "counter", "counter", time.Time{}, time.Now().Add(time.Minute))
+	if len(history) != 3 {
+		t.Errorf("Expected 3 history points, got %d", len(history))
+	}
+}
+
+// TestFileStorage_TornJournalTail тестирует восстановление при оборванной последней записи журнала
+func TestFileStorage_TornJournalTail(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	s1.AddCounter(ctx, "counter", 10)
+
+	journal, err := os.OpenFile(file+".wal", os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	journal.WriteString(`{"ts":"2024-01-01T00:00:00Z","metrics":[{"id":"counter","type":"coun`)
+	journal.Close()
+
+	s2 := storage.NewFileStorage(file, time.Hour, true)
+	counter, err := s2.GetCounter(ctx, "counter")
+	if err != nil || counter != 10 {
+		t.Errorf("Expected counter 10, got %d (%v)", counter, err)
+	}
+	s2.AddCounter(ctx, "counter", 1)
+
+	s3 := storage.NewFileStorage(file, time.Hour, true)
+	defer s3.Close()
+	counter, err = s3.GetCounter(ctx, "counter")
+	if err != nil || counter != 11 {
+		t.Errorf("Expected counter 11 after second restore, got %d (%v)", counter, err)
+	}
+}
+
+// TestFileStorage_SnapshotResetsJournal тестирует сброс журнала после сохранения снимка
+func TestFileStorage_SnapshotResetsJournal(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	s1.AddCounter(ctx, "counter", 7)
+	if err := s1.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	info, err := os.Stat(file + ".wal")
+	if err != nil {
+		t.Fatalf("Failed to stat journal: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Journal must be empty after snapshot, got %d bytes", info.Size())
+	}
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+	counter, _ := s2.GetCounter(ctx, "counter")
+	if counter != 7 {
+		t.Errorf("Expected counter 7, got %d", counter)
+	}
+}
+
+// TestFileStorage_CrashBeforeJournalReset тестирует восстановление после сбоя между записью снимка и сбросом журнала
+func TestFileStorage_CrashBeforeJournalReset(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	s1.AddCounter(ctx, "counter", 3)
+	s1.AddHistogram(ctx, "latency", models.HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5})
+	journal, err := os.ReadFile(file + ".wal")
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if err = s1.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	// снимок уже записан, а журнал ещё не сброшен
+	if err = os.WriteFile(file+".wal", journal, 0666); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+
+	s2 := storage.NewFileStorage(file, time.Hour, true)
+	counter, err := s2.GetCounter(ctx, "counter")
+	if err != nil || counter != 3 {
+		t.Errorf("Expected counter 3, got %d (%v)", counter, err)
+	}
+	h, err := s2.GetHistogram(ctx, "latency")
+	if err != nil || h.Count != 1 {
+		t.Errorf("Expected histogram count 1, got %d (%v)", h.Count, err)
+	}
+	s2.AddCounter(ctx, "counter", 1)
+
+	// новые записи журнала после восстановления не пропускаются
+	s3 := storage.NewFileStorage(file, 0, true)
+	defer s3.Close()
+	counter, err = s3.GetCounter(ctx, "counter")
+	if err != nil || counter != 4 {
+		t.Errorf("Expected counter 4, got %d (%v)", counter, err)
+	}
+}
+
+// TestFileStorage_NoRestoreKeepsFiles тестирует, что хранилище без восстановления не трогает файлы до первой записи
+func TestFileStorage_NoRestoreKeepsFiles(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, 0, false)
+	s1.AddCounter(ctx, "counter", 7)
+	s1.Close()
+
+	s2 := storage.NewFileStorage(file, 0, false)
+	s2.Close()
+	s3 := storage.NewFileStorage(file, 0, true)
+	counter, err := s3.GetCounter(ctx, "counter")
+	if err != nil || counter != 7 {
+		t.Errorf("Expected counter 7 kept by storage without writes, got %d (%v)", counter, err)
+	}
+	s3.Close()
+
+	s4 := storage.NewFileStorage(file, 0, false)
+	s4.SetGauge(ctx, "gauge", 1)
+	s4.Close()
+	s5 := storage.NewFileStorage(file, 0, true)
+	defer s5.Close()
+	if _, err = s5.GetCounter(ctx, "counter"); err == nil {
+		t.Error("Expected counter of previous run to be dropped after first write")
+	}
+}
+
+// TestFileStorage_JournalDelete тестирует восстановление удалений и сбросов из журнала
+func TestFileStorage_JournalDelete(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	s1.SetGauge(ctx, "host-1", 1)
+	s1.SetGauge(ctx, "host-2", 2)
+	s1.SetGauge(ctx, "kept", 3)
+	s1.AddCounter(ctx, "requests", 10)
+	s1.DeleteMetrics(ctx, "host-*")
+	s1.ResetCounter(ctx, "requests")
+	s1.AddCounter(ctx, "requests", 1)
+	if err := s1.DeleteMetric(ctx, "gauge", "missing"); err == nil {
+		t.Error("Expected error on deletion of missing metric")
+	}
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+
+	all, _ := s2.GetAll(ctx)
+	if len(all) != 2 {
+		t.Errorf("Expected 2 metrics after replay, got %v", all)
+	}
+	counter, _ := s2.GetCounter(ctx, "requests")
+	if counter != 1 {
+		t.Errorf("Expected counter 1 after replay, got %d", counter)
+	}
+}
+
+// TestFileStorage_JournalHistogram тестирует восстановление гистограмм из журнала
+func TestFileStorage_JournalHistogram(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	h := models.NewHistogram([]float64{10, 100})
+	h.Observe(5)
+	h.Observe(50)
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	s1.AddHistogram(ctx, "latency", h)
+	s1.AddHistogram(ctx, "latency", h)
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+
+	got, err := s2.GetHistogram(ctx, "latency")
+	if err != nil {
+		t.Fatalf("GetHistogram failed: %v", err)
+	}
+	if got.Count != 4 || got.Sum != 110 {
+		t.Errorf("Expected count=4 sum=110 after replay, got %s", got.String())
+	}
+}
+
+// TestFileStorage_JournalBackfill тестирует восстановление записей задним числом из журнала
+func TestFileStorage_JournalBackfill(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	checkBackfill(t, s1)
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+	history, err := s2.GetHistory(ctx, models.Counter, "backfill_counter", time.Time{}, time.Now().Add(time.Minute))
+	if err != nil || len(history) != 3 {
+		t.Fatalf("Expected 3 history points, got %d (%v)", len(history), err)
+	}
+	if *history[0].Delta != 2 || *history[2].Delta != 10 {
+		t.Errorf("Expected totals 2..10, got %d..%d", *history[0].Delta, *history[2].Delta)
+	}
+	value, err := s2.GetGauge(ctx, "backfill_gauge")
+	if err != nil || value != 10 {
+		t.Errorf("Expected gauge 10, got %f (%v)", value, err)
+	}
+}
+
+// TestFileStorage_JournalSetCounter тестирует восстановление абсолютного значения счётчика из журнала
+func TestFileStorage_JournalSetCounter(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	checkSetCounter(t, s1)
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+	counter, err := s2.GetCounter(ctx, "set_counter")
+	if err != nil || counter != 3 {
+		t.Errorf("Expected counter 3, got %d (%v)", counter, err)
+	}
+}
+
+// TestFileStorage_JournalCumulative тестирует восстановление прибавлений к датчику и накопительных гистограмм из журнала
+func TestFileStorage_JournalCumulative(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, time.Hour, false)
+	checkCumulative(t, s1)
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+	gauge, err := s2.GetGauge(ctx, "add_gauge")
+	if err != nil || gauge != 7.5 {
+		t.Errorf("Expected gauge 7.5, got %f (%v)", gauge, err)
+	}
+	h, err := s2.GetHistogram(ctx, "cumulative")
+	if err != nil || h.Count != 7 {
+		t.Errorf("Expected histogram count 7, got %d (%v)", h.Count, err)
+	}
+}
+
+// TestFileStorage_PruneHistory тестирует удаление устаревшей истории из снимка
+func TestFileStorage_PruneHistory(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	s1 := storage.NewFileStorage(file, 0, false)
+	checkPruneHistory(t, s1)
+	s1.Close()
+
+	s2 := storage.NewFileStorage(file, 0, true)
+	defer s2.Close()
+	history, err := s2.GetHistory(ctx, models.Gauge, "prune_gauge", time.Time{}, time.Now().Add(time.Minute))
+	if err != nil || len(history) != 1 {
+		t.Errorf("Expected 1 restored history point, got %d (%v)", len(history), err)
+	}
+}
+
 // TestFileStorage_ErrorHandling тестирует обработку ошибок
 func TestFileStorage_ErrorHandling(t *testing.T) {
+	ctx := context.Background()
 	invalidPath := "/invalid/path/storage.tmp"
 	s := storage.NewFileStorage(invalidPath, 0, false)
 	defer s.Close()
 
-	s.SetGauge("test", 123.45)
-	value, err := s.GetGauge("test")
+	s.SetGauge(ctx, "test", 123.45)
+	value, err := s.GetGauge(ctx, "test")
 	if err != nil {
 		t.Errorf("Operations should work even with invalid file path: %v", err)
 	}
@@ -141,12 +477,44 @@ func TestFileStorage_ErrorHandling(t *testing.T) {
 	}
 }
 
+// TestFileStorage_FlushFailureNotified тестирует оповещение о сбое сохранения
+func TestFileStorage_FlushFailureNotified(t *testing.T) {
+	var mu sync.Mutex
+	var kinds []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notifier.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		kinds = append(kinds, string(e.Kind))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := notifier.New([]string{ts.URL}, "")
+	go n.Run(ctx)
+	notifier.SetDefault(n)
+	defer notifier.SetDefault(nil)
+
+	s := storage.NewFileStorage("/invalid/path/storage.tmp", 0, true)
+	defer s.Close()
+	n.Flush(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(kinds) != 1 || kinds[0] != string(notifier.FlushFailed) {
+		t.Errorf("Expected one flush_failed event, got %v", kinds)
+	}
+}
+
 // TestFileStorage_RestoreNonExistentFile тестирует восстановление из несуществующего файла
 func TestFileStorage_RestoreNonExistentFile(t *testing.T) {
+	ctx := context.Background()
 	s := storage.NewFileStorage("/nonexistent/file.tmp", 0, true)
 	defer s.Close()
 
-	metrics := s.GetAll()
+	metrics, _ := s.GetAll(ctx)
 	if len(metrics) != 0 {
 		t.Errorf("Expected empty storage, got %d metrics", len(metrics))
 	}
@@ -181,6 +549,7 @@ func TestFileStorage_CloseSafety(t *testing.T) {
 
 // ExampleFileStorage демонстрирует базовое использование FileStorage
 func ExampleFileStorage() {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "example_*.tmp")
 	if err != nil {
 		fmt.Printf("Error creating temp file: %v\n", err)
@@ -192,11 +561,11 @@ func ExampleFileStorage() {
 	storage := storage.NewFileStorage(tmpFile.Name(), 0, false)
 	defer storage.Close()
 
-	storage.SetGauge("temperature", 23.5)
-	storage.AddCounter("requests", 100)
+	storage.SetGauge(ctx, "temperature", 23.5)
+	storage.AddCounter(ctx, "requests", 100)
 
-	value, _ := storage.GetGauge("temperature")
-	count, _ := storage.GetCounter("requests")
+	value, _ := storage.GetGauge(ctx, "temperature")
+	count, _ := storage.GetCounter(ctx, "requests")
 
 	fmt.Printf("Temperature: %.1f, Requests: %d\n", value, count)
 
@@ -206,6 +575,7 @@ func ExampleFileStorage() {
 
 // ExampleFileStorage_persistence демонстрирует сохранение и восстановление
 func ExampleFileStorage_persistence() {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "persistence_*.tmp")
 	if err != nil {
 		fmt.Printf("Error creating temp file: %v\n", err)
@@ -215,15 +585,15 @@ func ExampleFileStorage_persistence() {
 	defer os.Remove(tmpFile.Name())
 
 	storage1 := storage.NewFileStorage(tmpFile.Name(), 0, false)
-	storage1.SetGauge("cpu", 75.5)
-	storage1.AddCounter("hits", 42)
+	storage1.SetGauge(ctx, "cpu", 75.5)
+	storage1.AddCounter(ctx, "hits", 42)
 	storage1.Close()
 
 	storage2 := storage.NewFileStorage(tmpFile.Name(), 0, true)
 	defer storage2.Close()
 
-	cpu, _ := storage2.GetGauge("cpu")
-	hits, _ := storage2.GetCounter("hits")
+	cpu, _ := storage2.GetGauge(ctx, "cpu")
+	hits, _ := storage2.GetCounter(ctx, "hits")
 
 	fmt.Printf("CPU: %.1f%%, Hits: %d\n", cpu, hits)
 
@@ -233,6 +603,7 @@ func ExampleFileStorage_persistence() {
 
 // ExampleFileStorage_async демонстрирует асинхронное сохранение
 func ExampleFileStorage_async() {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "async_*.tmp")
 	if err != nil {
 		fmt.Printf("Error creating temp file: %v\n", err)
@@ -244,8 +615,8 @@ func ExampleFileStorage_async() {
 	storage := storage.NewFileStorage(tmpFile.Name(), 100*time.Millisecond, false)
 	defer storage.Close()
 
-	storage.SetGauge("memory", 65.2)
-	storage.AddCounter("visitors", 1000)
+	storage.SetGauge(ctx, "memory", 65.2)
+	storage.AddCounter(ctx, "visitors", 1000)
 
 	// Даем время для автосохранения
 	time.Sleep(150 * time.Millisecond)
@@ -258,6 +629,7 @@ func ExampleFileStorage_async() {
 
 // BenchmarkFileStorage_SetGauge бенчмарк для SetGauge в FileStorage
 func BenchmarkFileStorage_SetGauge(b *testing.B) {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "benchmark_*.tmp")
 	if err != nil {
 		b.Fatalf("Failed to create temp file: %v", err)
@@ -270,12 +642,13 @@ func BenchmarkFileStorage_SetGauge(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		s.SetGauge("benchmark_metric", float64(i))
+		s.SetGauge(ctx, "benchmark_metric", float64(i))
 	}
 }
 
 // BenchmarkFileStorage_AddCounter бенчмарк для AddCounter в FileStorage
 func BenchmarkFileStorage_AddCounter(b *testing.B) {
+	ctx := context.Background()
 	tmpFile, err := os.CreateTemp("", "benchmark_*.tmp")
 	if err != nil {
 		b.Fatalf("Failed to create temp file: %v", err)
@@ -288,6 +661,6 @@ func BenchmarkFileStorage_AddCounter(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		s.AddCounter("benchmark_counter", 1)
+		s.AddCounter(ctx, "benchmark_counter", 1)
 	}
 }
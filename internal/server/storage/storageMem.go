@@ -3,79 +3,795 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"hash/maphash"
+	"path"
+	"slices"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/models"
 )
 
+// memShardCount number of independently locked parts of MemStorage
+const memShardCount = 64
+
+type memShard struct {
+	gauges           map[string]float64
+	counters         map[string]int64
+	histograms       map[string]models.HistogramData
+	gaugeHistory     map[string][]repositories.HistoryPoint
+	counterHistory   map[string][]repositories.HistoryPoint
+	histogramHistory map[string][]repositories.HistoryPoint
+	mu               sync.RWMutex
+}
+
+// MemStorage concurrency-safe in memory storage.
+// Metrics are spread over shards by name, so writers of different metrics don't block each other.
 type MemStorage struct {
-	GaugeMetrics   map[string]float64
-	CounterMetrics map[string]int64
+	shards [memShardCount]*memShard
+	seed   maphash.Seed
+}
+
+// memSnapshot serializable state of MemStorage
+type memSnapshot struct {
+	GaugeMetrics     map[string]float64
+	CounterMetrics   map[string]int64
+	HistogramMetrics map[string]models.HistogramData `json:",omitempty"`
+	GaugeHistory     map[string][]repositories.HistoryPoint
+	CounterHistory   map[string][]repositories.HistoryPoint
+	HistogramHistory map[string][]repositories.HistoryPoint `json:",omitempty"`
+	WalSeq           uint64                                 `json:",omitempty"` // last journal record covered, set by FileStorage
 }
 
 func NewMemStorage() *MemStorage {
-	s := MemStorage{
-		GaugeMetrics:   make(map[string]float64),
-		CounterMetrics: make(map[string]int64),
-	}
+	s := MemStorage{}
+	s.init()
 
 	return &s
 }
 
-func (m *MemStorage) SetGauge(metricName string, value float64) {
-	m.GaugeMetrics[metricName] = value
+func (m *MemStorage) init() {
+	m.seed = maphash.MakeSeed()
+	for i := range m.shards {
+		m.shards[i] = &memShard{
+			gauges:           make(map[string]float64),
+			counters:         make(map[string]int64),
+			histograms:       make(map[string]models.HistogramData),
+			gaugeHistory:     make(map[string][]repositories.HistoryPoint),
+			counterHistory:   make(map[string][]repositories.HistoryPoint),
+			histogramHistory: make(map[string][]repositories.HistoryPoint),
+		}
+	}
+}
+
+func (m *MemStorage) shardIndex(metricName string) int {
+	return int(maphash.String(m.seed, metricName) % memShardCount)
+}
+
+func (m *MemStorage) shard(metricName string) *memShard {
+	return m.shards[m.shardIndex(metricName)]
+}
+
+// historyIndex position of point at ts in history: after all points not later than ts
+func historyIndex(history []repositories.HistoryPoint, ts time.Time) int {
+	if n := len(history); n == 0 || !history[n-1].Timestamp.After(ts) {
+		return n
+	}
+	return sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp.After(ts)
+	})
+}
+
+// setGaugeLocked appends point, backfilled point (older than the latest one) is inserted into new slice
+// and leaves current value as is
+func (sh *memShard) setGaugeLocked(metricName string, value float64, ts time.Time) {
+	history := sh.gaugeHistory[metricName]
+	point := repositories.HistoryPoint{Timestamp: ts, Value: &value}
+	i := historyIndex(history, ts)
+	if i == len(history) {
+		sh.gauges[metricName] = value
+		sh.gaugeHistory[metricName] = append(history, point)
+		return
+	}
+	sh.gaugeHistory[metricName] = slices.Concat(history[:i], []repositories.HistoryPoint{point}, history[i:])
+}
+
+// addCounterLocked appends running total, backfilled delta is also added to totals of later points in new slice
+func (sh *memShard) addCounterLocked(metricName string, value int64, ts time.Time) {
+	sh.counters[metricName] += value
+	history := sh.counterHistory[metricName]
+	i := historyIndex(history, ts)
+	if i == len(history) {
+		total := sh.counters[metricName]
+		sh.counterHistory[metricName] = append(history, repositories.HistoryPoint{
+			Timestamp: ts,
+			Delta:     &total,
+		})
+		return
+	}
+
+	var total int64
+	if i > 0 {
+		total = *history[i-1].Delta
+	}
+	total += value
+	r := make([]repositories.HistoryPoint, 0, len(history)+1)
+	r = append(r, history[:i]...)
+	r = append(r, repositories.HistoryPoint{Timestamp: ts, Delta: &total})
+	for _, p := range history[i:] {
+		shifted := *p.Delta + value
+		r = append(r, repositories.HistoryPoint{Timestamp: p.Timestamp, Delta: &shifted})
+	}
+	sh.counterHistory[metricName] = r
+}
+
+// mergeHistogramLocked returns stored histogram merged with value, stored one is left intact
+func (sh *memShard) mergeHistogramLocked(metricName string, value models.HistogramData) (models.HistogramData, error) {
+	stored, ok := sh.histograms[metricName]
+	if !ok {
+		return value.Clone(), nil
+	}
+	merged := stored.Clone()
+	err := merged.Merge(value)
+	return merged, err
+}
+
+func (sh *memShard) addHistogramLocked(metricName string, value models.HistogramData, ts time.Time) error {
+	merged, err := sh.mergeHistogramLocked(metricName, value)
+	if err != nil {
+		return err
+	}
+	sh.histograms[metricName] = merged
+	// stored histogram is replaced (never changed in place) on every merge, so history may share it
+	sh.histogramHistory[metricName] = append(sh.histogramHistory[metricName], repositories.HistoryPoint{
+		Timestamp: ts,
+		Histogram: &merged,
+	})
+	return nil
+}
+
+// deleteLocked removes metric with history, false if there was nothing to remove
+func (sh *memShard) deleteLocked(metricName string, metricType string) bool {
+	switch metricType {
+	case models.Gauge:
+		if _, ok := sh.gauges[metricName]; !ok {
+			return false
+		}
+		delete(sh.gauges, metricName)
+		delete(sh.gaugeHistory, metricName)
+	case models.Counter:
+		if _, ok := sh.counters[metricName]; !ok {
+			return false
+		}
+		delete(sh.counters, metricName)
+		delete(sh.counterHistory, metricName)
+	case models.Histogram:
+		if _, ok := sh.histograms[metricName]; !ok {
+			return false
+		}
+		delete(sh.histograms, metricName)
+		delete(sh.histogramHistory, metricName)
+	default:
+		return false
+	}
+	return true
+}
+
+// resetCounterLocked zeroes existing counter, reset is visible in history as zero total
+func (sh *memShard) resetCounterLocked(metricName string, ts time.Time) bool {
+	if _, ok := sh.counters[metricName]; !ok {
+		return false
+	}
+	sh.counters[metricName] = 0
+	var zero int64
+	sh.counterHistory[metricName] = append(sh.counterHistory[metricName], repositories.HistoryPoint{
+		Timestamp: ts,
+		Delta:     &zero,
+	})
+	return true
+}
+
+// setCounterLocked sets counter to absolute value, it is the running total of new history point
+func (sh *memShard) setCounterLocked(metricName string, value int64, ts time.Time) {
+	sh.counters[metricName] = value
+	sh.counterHistory[metricName] = append(sh.counterHistory[metricName], repositories.HistoryPoint{
+		Timestamp: ts,
+		Delta:     &value,
+	})
+}
+
+func (m *MemStorage) SetGauge(_ context.Context, metricName string, value float64) error {
+	sh := m.shard(metricName)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.setGaugeLocked(metricName, value, time.Now().UTC())
+	return nil
 }
 
-func (m *MemStorage) GetGauge(metricName string) (float64, error) {
-	value, ok := m.GaugeMetrics[metricName]
+func (m *MemStorage) GetGauge(_ context.Context, metricName string) (float64, error) {
+	sh := m.shard(metricName)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	value, ok := sh.gauges[metricName]
 	if !ok {
-		return 0, errors.New("not Found")
+		return 0, repositories.ErrNotFound
 	}
 	return value, nil
 }
 
-func (m *MemStorage) AddCounter(metricName string, value int64) {
-	m.CounterMetrics[metricName] += value
+func (m *MemStorage) AddCounter(_ context.Context, metricName string, value int64) error {
+	sh := m.shard(metricName)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.addCounterLocked(metricName, value, time.Now().UTC())
+	return nil
 }
 
-func (m *MemStorage) GetCounter(metricName string) (int64, error) {
-	value, ok := m.CounterMetrics[metricName]
+func (m *MemStorage) GetCounter(_ context.Context, metricName string) (int64, error) {
+	sh := m.shard(metricName)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	value, ok := sh.counters[metricName]
 	if !ok {
-		return 0, errors.New("not Found")
+		return 0, repositories.ErrNotFound
 	}
 	return value, nil
 }
 
-func (m *MemStorage) GetAll() []repositories.MetricDto {
+func (m *MemStorage) AddHistogram(_ context.Context, metricName string, value models.HistogramData) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+
+	sh := m.shard(metricName)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.addHistogramLocked(metricName, value, time.Now().UTC())
+}
+
+func (m *MemStorage) GetHistogram(_ context.Context, metricName string) (models.HistogramData, error) {
+	sh := m.shard(metricName)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	value, ok := sh.histograms[metricName]
+	if !ok {
+		return models.HistogramData{}, repositories.ErrNotFound
+	}
+	return value.Clone(), nil
+}
+
+func (m *MemStorage) GetAll(ctx context.Context) ([]repositories.MetricDto, error) {
 	var r []repositories.MetricDto
-	for k, v := range m.GaugeMetrics {
+	err := m.EachMetric(ctx, func(dto repositories.MetricDto) error {
+		r = append(r, dto)
+		return nil
+	})
+	return r, err
+}
+
+// EachMetric copies one shard at a time, so fn doesn't hold locks and memory is bounded by shard size
+func (m *MemStorage) EachMetric(ctx context.Context, fn func(repositories.MetricDto) error) error {
+	for _, sh := range m.shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, dto := range sh.metrics() {
+			if err := fn(dto); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sh *memShard) metrics() []repositories.MetricDto {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	r := make([]repositories.MetricDto, 0, len(sh.gauges)+len(sh.counters)+len(sh.histograms))
+	for k, v := range sh.gauges {
+		name, labels := models.SplitSeriesKey(k)
+		r = append(r, repositories.MetricDto{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Gauge,
+			Value:  strconv.FormatFloat(v, 'f', -1, 64),
+		})
+	}
+	for k, v := range sh.counters {
+		name, labels := models.SplitSeriesKey(k)
 		r = append(r, repositories.MetricDto{
-			Name:  k,
-			Type:  models.Gauge,
-			Value: strconv.FormatFloat(v, 'f', -1, 64),
+			Name:   name,
+			Labels: labels,
+			Type:   models.Counter,
+			Value:  strconv.FormatInt(v, 10),
 		})
 	}
-	for k, v := range m.CounterMetrics {
+	for k, v := range sh.histograms {
+		h := v.Clone()
+		name, labels := models.SplitSeriesKey(k)
 		r = append(r, repositories.MetricDto{
-			Name:  k,
-			Type:  models.Counter,
-			Value: strconv.FormatInt(v, 10),
+			Name:      name,
+			Labels:    labels,
+			Type:      models.Histogram,
+			Value:     h.String(),
+			Histogram: &h,
 		})
 	}
 	return r
 }
 
-func (m *MemStorage) Close() {}
+func (m *MemStorage) GetHistory(_ context.Context, metricType string, metricName string, from time.Time, to time.Time) ([]repositories.HistoryPoint, error) {
+	sh := m.shard(metricName)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	var points []repositories.HistoryPoint
+	switch metricType {
+	case models.Gauge:
+		points = sh.gaugeHistory[metricName]
+	case models.Counter:
+		points = sh.counterHistory[metricName]
+	case models.Histogram:
+		points = sh.histogramHistory[metricName]
+	default:
+		return nil, errors.New("metric type not found")
+	}
+
+	r := []repositories.HistoryPoint{}
+	for _, p := range points {
+		if p.Timestamp.Before(from) || p.Timestamp.After(to) {
+			continue
+		}
+		r = append(r, p)
+	}
+	return r, nil
+}
+
+// PruneHistory removes points older than before, emptied history of series is forgotten
+func (m *MemStorage) PruneHistory(_ context.Context, before time.Time) (int, error) {
+	var pruned int
+	for _, sh := range m.shards {
+		sh.mu.Lock()
+		for _, history := range []map[string][]repositories.HistoryPoint{sh.gaugeHistory, sh.counterHistory, sh.histogramHistory} {
+			pruned += pruneHistoryLocked(history, before)
+		}
+		sh.mu.Unlock()
+	}
+	return pruned, nil
+}
+
+// pruneHistoryLocked drops points older than before from every series of history.
+// Kept points are copied to new slice, so old array is freed and snapshots taken before stay valid.
+func pruneHistoryLocked(history map[string][]repositories.HistoryPoint, before time.Time) int {
+	var pruned int
+	for name, points := range history {
+		i := sort.Search(len(points), func(i int) bool {
+			return !points[i].Timestamp.Before(before)
+		})
+		switch {
+		case i == 0:
+			continue
+		case i == len(points):
+			delete(history, name)
+		default:
+			history[name] = slices.Clone(points[i:])
+		}
+		pruned += i
+	}
+	return pruned
+}
+
+func (m *MemStorage) DeleteMetric(_ context.Context, metricType string, metricName string) error {
+	sh := m.shard(metricName)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if !sh.deleteLocked(metricName, metricType) {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MemStorage) DeleteMetrics(_ context.Context, pattern string) (int, error) {
+	ops, err := m.matchDeletes(pattern)
+	if err != nil {
+		return 0, err
+	}
+	if err = m.apply(ops, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
+}
+
+func (m *MemStorage) ResetCounter(_ context.Context, metricName string) error {
+	sh := m.shard(metricName)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if !sh.resetCounterLocked(metricName, time.Now().UTC()) {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+// matchDeletes delete ops for every metric which name matches pattern, labels are not matched
+func (m *MemStorage) matchDeletes(pattern string) ([]memOp, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var ops []memOp
+	match := func(metricName string, metricType string) {
+		name, _ := models.SplitSeriesKey(metricName)
+		if ok, _ := path.Match(pattern, name); ok {
+			ops = append(ops, memOp{name: metricName, metricType: metricType, kind: opDelete})
+		}
+	}
+	for _, sh := range m.shards {
+		sh.mu.RLock()
+		for k := range sh.gauges {
+			match(k, models.Gauge)
+		}
+		for k := range sh.counters {
+			match(k, models.Counter)
+		}
+		for k := range sh.histograms {
+			match(k, models.Histogram)
+		}
+		sh.mu.RUnlock()
+	}
+	return ops, nil
+}
+
+// has reports whether metric exists, unknown type is never present
+func (m *MemStorage) has(metricType string, metricName string) bool {
+	sh := m.shard(metricName)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	var ok bool
+	switch metricType {
+	case models.Gauge:
+		_, ok = sh.gauges[metricName]
+	case models.Counter:
+		_, ok = sh.counters[metricName]
+	case models.Histogram:
+		_, ok = sh.histograms[metricName]
+	}
+	return ok
+}
+
+func (m *MemStorage) Close() error {
+	return nil
+}
 
 func (m *MemStorage) PingContext(_ context.Context) error {
 	return nil
 }
 
-func (m *MemStorage) StartTransaction(_ context.Context) error {
+func (m *MemStorage) Begin(_ context.Context) (repositories.Tx, error) {
+	return m.begin(), nil
+}
+
+func (m *MemStorage) begin() *memTx {
+	return &memTx{storage: m}
+}
+
+// lock locks every shard touched by ops in index order and returns unlock
+func (m *MemStorage) lock(ops []memOp, write bool) func() {
+	var indexes []int
+	for _, op := range ops {
+		indexes = append(indexes, m.shardIndex(op.name))
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	for _, i := range indexes {
+		if write {
+			m.shards[i].mu.Lock()
+		} else {
+			m.shards[i].mu.RLock()
+		}
+	}
+	return func() {
+		for _, i := range indexes {
+			if write {
+				m.shards[i].mu.Unlock()
+			} else {
+				m.shards[i].mu.RUnlock()
+			}
+		}
+	}
+}
+
+// checkLocked verifies that histograms of batch merge with stored ones and with each other
+func (m *MemStorage) checkLocked(ops []memOp) error {
+	// nil value: histogram is deleted earlier in the batch
+	pending := make(map[string]*models.HistogramData)
+	for _, op := range ops {
+		if op.metricType != models.Histogram {
+			continue
+		}
+		if op.kind == opDelete {
+			pending[op.name] = nil
+			continue
+		}
+
+		if err := op.histogram.Validate(); err != nil {
+			return err
+		}
+		var merged models.HistogramData
+		var err error
+		current, seen := pending[op.name]
+		switch {
+		case !seen:
+			sh := m.shard(op.name)
+			merged, err = sh.mergeHistogramLocked(op.name, op.histogramGrowth(sh.histograms[op.name]))
+		case current == nil:
+			merged = op.histogram.Clone()
+		default:
+			merged = *current
+			err = merged.Merge(op.histogramGrowth(*current))
+		}
+		if err != nil {
+			return err
+		}
+		pending[op.name] = &merged
+	}
+	return nil
+}
+
+// check verifies that ops can be applied to current state
+func (m *MemStorage) check(ops []memOp) error {
+	unlock := m.lock(ops, false)
+	defer unlock()
+
+	return m.checkLocked(ops)
+}
+
+// apply writes all ops at once with the same timestamp: every touched shard is locked (in index order) for the whole batch.
+// Nothing is written if any histogram of the batch can't be merged.
+func (m *MemStorage) apply(ops []memOp, ts time.Time) error {
+	unlock := m.lock(ops, true)
+	defer unlock()
+
+	if err := m.checkLocked(ops); err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		sh := m.shard(op.name)
+		switch {
+		case op.kind == opDelete:
+			sh.deleteLocked(op.name, op.metricType)
+		case op.kind == opReset:
+			sh.resetCounterLocked(op.name, ts)
+		case op.kind == opSet:
+			sh.setCounterLocked(op.name, op.delta, ts)
+		case op.kind == opAdd:
+			sh.setGaugeLocked(op.name, sh.gauges[op.name]+op.value, ts)
+		case op.metricType == models.Gauge:
+			sh.setGaugeLocked(op.name, op.value, op.timestamp(ts))
+		case op.metricType == models.Counter:
+			sh.addCounterLocked(op.name, op.delta, op.timestamp(ts))
+		case op.metricType == models.Histogram:
+			// merge is verified by checkLocked
+			_ = sh.addHistogramLocked(op.name, op.histogramGrowth(sh.histograms[op.name]), ts)
+		}
+	}
+	return nil
+}
+
+type memOpKind uint8
+
+const (
+	opWrite      memOpKind = iota // set gauge, add counter or merge histogram
+	opDelete                      // remove metric with history
+	opReset                       // zero counter
+	opSet                         // set counter to absolute value in delta
+	opAdd                         // add value to gauge
+	opCumulative                  // merge growth of cumulative histogram since stored one
+)
+
+type memOp struct {
+	ts         time.Time // sample time of backfill, zero for write at commit time
+	name       string
+	metricType string
+	histogram  models.HistogramData
+	value      float64
+	delta      int64
+	kind       memOpKind
+}
+
+// histogramGrowth histogram to merge into current one, growth since it for cumulative op
+func (op memOp) histogramGrowth(current models.HistogramData) models.HistogramData {
+	if op.kind != opCumulative || current.Counts == nil {
+		return op.histogram
+	}
+	return op.histogram.GrowthSince(current)
+}
+
+// timestamp time of op in history, commit time if op isn't backfill
+func (op memOp) timestamp(commit time.Time) time.Time {
+	if op.ts.IsZero() {
+		return commit
+	}
+	return op.ts
+}
+
+// memTx buffers writes until Commit
+type memTx struct {
+	storage *MemStorage
+	ops     []memOp
+	done    bool
+}
+
+func (t *memTx) SetGauge(_ context.Context, metricName string, value float64) error {
+	return t.add(memOp{name: metricName, metricType: models.Gauge, value: value})
+}
+
+func (t *memTx) AddCounter(_ context.Context, metricName string, value int64) error {
+	return t.add(memOp{name: metricName, metricType: models.Counter, delta: value})
+}
+
+func (t *memTx) SetCounter(_ context.Context, metricName string, value int64) error {
+	return t.add(memOp{name: metricName, metricType: models.Counter, delta: value, kind: opSet})
+}
+
+func (t *memTx) AddGauge(_ context.Context, metricName string, delta float64) error {
+	return t.add(memOp{name: metricName, metricType: models.Gauge, value: delta, kind: opAdd})
+}
+
+func (t *memTx) AddCumulativeHistogram(_ context.Context, metricName string, value models.HistogramData) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	return t.add(memOp{name: metricName, metricType: models.Histogram, histogram: value.Clone(), kind: opCumulative})
+}
+
+func (t *memTx) SetGaugeAt(_ context.Context, metricName string, value float64, ts time.Time) error {
+	return t.add(memOp{name: metricName, metricType: models.Gauge, value: value, ts: ts.UTC()})
+}
+
+func (t *memTx) AddCounterAt(_ context.Context, metricName string, value int64, ts time.Time) error {
+	return t.add(memOp{name: metricName, metricType: models.Counter, delta: value, ts: ts.UTC()})
+}
+
+func (t *memTx) AddHistogram(_ context.Context, metricName string, value models.HistogramData) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	return t.add(memOp{name: metricName, metricType: models.Histogram, histogram: value.Clone()})
+}
+
+func (t *memTx) add(op memOp) error {
+	if t.done {
+		return repositories.ErrTxDone
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+func (t *memTx) Commit() error {
+	if t.done {
+		return repositories.ErrTxDone
+	}
+	t.done = true
+	return t.storage.apply(t.ops, time.Now().UTC())
+}
+
+func (t *memTx) Rollback() error {
+	if t.done {
+		return repositories.ErrTxDone
+	}
+	t.done = true
+	t.ops = nil
 	return nil
 }
-func (m *MemStorage) CommitTransaction() error {
+
+// MarshalJSON saves all shards in flat format
+func (m *MemStorage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.snapshot())
+}
+
+// snapshot copy of all shards in flat format
+func (m *MemStorage) snapshot() memSnapshot {
+	snapshot := memSnapshot{
+		GaugeMetrics:     make(map[string]float64),
+		CounterMetrics:   make(map[string]int64),
+		HistogramMetrics: make(map[string]models.HistogramData),
+		GaugeHistory:     make(map[string][]repositories.HistoryPoint),
+		CounterHistory:   make(map[string][]repositories.HistoryPoint),
+		HistogramHistory: make(map[string][]repositories.HistoryPoint),
+	}
+	for _, sh := range m.shards {
+		sh.mu.RLock()
+		for k, v := range sh.gauges {
+			snapshot.GaugeMetrics[k] = v
+		}
+		for k, v := range sh.counters {
+			snapshot.CounterMetrics[k] = v
+		}
+		for k, v := range sh.histograms {
+			snapshot.HistogramMetrics[k] = v
+		}
+		// history is only appended in place (backfill builds new slice), so capped slices stay valid after unlock
+		for k, v := range sh.gaugeHistory {
+			snapshot.GaugeHistory[k] = v[:len(v):len(v)]
+		}
+		for k, v := range sh.counterHistory {
+			snapshot.CounterHistory[k] = v[:len(v):len(v)]
+		}
+		for k, v := range sh.histogramHistory {
+			snapshot.HistogramHistory[k] = v[:len(v):len(v)]
+		}
+		sh.mu.RUnlock()
+	}
+	return snapshot
+}
+
+// UnmarshalJSON restores metrics saved by MarshalJSON
+func (m *MemStorage) UnmarshalJSON(d []byte) error {
+	var snapshot memSnapshot
+	if err := json.Unmarshal(d, &snapshot); err != nil {
+		return err
+	}
+	m.load(snapshot)
 	return nil
 }
+
+// load puts metrics of snapshot into shards
+func (m *MemStorage) load(snapshot memSnapshot) {
+	if m.shards[0] == nil {
+		m.init()
+	}
+
+	for k, v := range snapshot.GaugeMetrics {
+		sh := m.shard(k)
+		sh.mu.Lock()
+		sh.gauges[k] = v
+		sh.mu.Unlock()
+	}
+	for k, v := range snapshot.CounterMetrics {
+		sh := m.shard(k)
+		sh.mu.Lock()
+		sh.counters[k] = v
+		sh.mu.Unlock()
+	}
+	for k, v := range snapshot.HistogramMetrics {
+		sh := m.shard(k)
+		sh.mu.Lock()
+		sh.histograms[k] = v
+		sh.mu.Unlock()
+	}
+	for k, v := range snapshot.GaugeHistory {
+		sh := m.shard(k)
+		sh.mu.Lock()
+		sh.gaugeHistory[k] = v
+		sh.mu.Unlock()
+	}
+	for k, v := range snapshot.CounterHistory {
+		sh := m.shard(k)
+		sh.mu.Lock()
+		sh.counterHistory[k] = v
+		sh.mu.Unlock()
+	}
+	for k, v := range snapshot.HistogramHistory {
+		sh := m.shard(k)
+		sh.mu.Lock()
+		sh.histogramHistory[k] = v
+		sh.mu.Unlock()
+	}
+}
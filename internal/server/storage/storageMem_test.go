@@ -2,18 +2,29 @@ package storage_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
 	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
 )
 
 // TestMemStorage_GaugeOperations тестирует операции с gauge метриками
 func TestMemStorage_GaugeOperations(t *testing.T) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
 
-	s.SetGauge("temperature", 23.5)
-	value, err := s.GetGauge("temperature")
+	s.SetGauge(ctx, "temperature", 23.5)
+	value, err := s.GetGauge(ctx, "temperature")
 	if err != nil {
 		t.Errorf("GetGauge failed: %v", err)
 	}
@@ -21,8 +32,8 @@ func TestMemStorage_GaugeOperations(t *testing.T) {
 		t.Errorf("Expected 23.5, got %f", value)
 	}
 
-	s.SetGauge("temperature", 25.0)
-	value, err = s.GetGauge("temperature")
+	s.SetGauge(ctx, "temperature", 25.0)
+	value, err = s.GetGauge(ctx, "temperature")
 	if err != nil {
 		t.Errorf("GetGauge after overwrite failed: %v", err)
 	}
@@ -30,7 +41,7 @@ func TestMemStorage_GaugeOperations(t *testing.T) {
 		t.Errorf("Expected 25.0 after overwrite, got %f", value)
 	}
 
-	_, err = s.GetGauge("nonexistent")
+	_, err = s.GetGauge(ctx, "nonexistent")
 	if err == nil {
 		t.Error("Expected error for non-existent metric")
 	}
@@ -38,10 +49,11 @@ func TestMemStorage_GaugeOperations(t *testing.T) {
 
 // TestMemStorage_CounterOperations тестирует операции с counter метриками
 func TestMemStorage_CounterOperations(t *testing.T) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
 
-	s.AddCounter("requests", 10)
-	value, err := s.GetCounter("requests")
+	s.AddCounter(ctx, "requests", 10)
+	value, err := s.GetCounter(ctx, "requests")
 	if err != nil {
 		t.Errorf("GetCounter failed: %v", err)
 	}
@@ -49,8 +61,8 @@ func TestMemStorage_CounterOperations(t *testing.T) {
 		t.Errorf("Expected 10, got %d", value)
 	}
 
-	s.AddCounter("requests", 5)
-	value, err = s.GetCounter("requests")
+	s.AddCounter(ctx, "requests", 5)
+	value, err = s.GetCounter(ctx, "requests")
 	if err != nil {
 		t.Errorf("GetCounter after increment failed: %v", err)
 	}
@@ -58,7 +70,7 @@ func TestMemStorage_CounterOperations(t *testing.T) {
 		t.Errorf("Expected 15 after increment, got %d", value)
 	}
 
-	_, err = s.GetCounter("nonexistent")
+	_, err = s.GetCounter(ctx, "nonexistent")
 	if err == nil {
 		t.Error("Expected error for non-existent metric")
 	}
@@ -66,14 +78,15 @@ func TestMemStorage_CounterOperations(t *testing.T) {
 
 // TestMemStorage_GetAll тестирует получение всех метрик
 func TestMemStorage_GetAll(t *testing.T) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
 
-	s.SetGauge("cpu_usage", 75.5)
-	s.SetGauge("memory_usage", 45.2)
-	s.AddCounter("requests", 100)
-	s.AddCounter("errors", 5)
+	s.SetGauge(ctx, "cpu_usage", 75.5)
+	s.SetGauge(ctx, "memory_usage", 45.2)
+	s.AddCounter(ctx, "requests", 100)
+	s.AddCounter(ctx, "errors", 5)
 
-	metrics := s.GetAll()
+	metrics, _ := s.GetAll(ctx)
 	if len(metrics) != 4 {
 		t.Errorf("Expected 4 metrics, got %d", len(metrics))
 	}
@@ -96,6 +109,88 @@ func TestMemStorage_GetAll(t *testing.T) {
 	}
 }
 
+// TestMemStorage_EachMetric тестирует обход метрик и остановку по ошибке
+func TestMemStorage_EachMetric(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	for i := 0; i < 100; i++ {
+		s.SetGauge(ctx, fmt.Sprintf("gauge_%d", i), float64(i))
+	}
+
+	var count int
+	err := s.EachMetric(ctx, func(repositories.MetricDto) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachMetric failed: %v", err)
+	}
+	if count != 100 {
+		t.Errorf("Expected 100 metrics, got %d", count)
+	}
+
+	errStop := errors.New("stop")
+	count = 0
+	err = s.EachMetric(ctx, func(repositories.MetricDto) error {
+		count++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || count != 1 {
+		t.Errorf("Expected stop after first metric, got %d calls and error %v", count, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = s.EachMetric(canceled, func(repositories.MetricDto) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// checkBackfill записывает метрики задним числом поверх текущих и проверяет значения и историю
+func checkBackfill(t *testing.T, s repositories.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	require.NoError(t, s.SetGauge(ctx, "backfill_gauge", 10))
+	require.NoError(t, s.AddCounter(ctx, "backfill_counter", 5))
+
+	tx, err := s.Begin(ctx)
+	require.NoError(t, err)
+	backfill, ok := tx.(repositories.Backfiller)
+	require.True(t, ok, "transaction must support backfill")
+	require.NoError(t, backfill.SetGaugeAt(ctx, "backfill_gauge", 1, now.Add(-2*time.Hour)))
+	require.NoError(t, backfill.AddCounterAt(ctx, "backfill_counter", 3, now.Add(-time.Hour)))
+	require.NoError(t, backfill.AddCounterAt(ctx, "backfill_counter", 2, now.Add(-2*time.Hour)))
+	require.NoError(t, backfill.AddCounterAt(ctx, "backfill_new", 7, now.Add(-time.Hour)))
+	require.NoError(t, tx.Commit())
+
+	gauge, err := s.GetGauge(ctx, "backfill_gauge")
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, gauge, "older sample must not replace current value")
+	history, err := s.GetHistory(ctx, models.Gauge, "backfill_gauge", time.Time{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 1.0, *history[0].Value)
+	assert.Equal(t, 10.0, *history[1].Value)
+
+	counter, err := s.GetCounter(ctx, "backfill_counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), counter)
+	history, err = s.GetHistory(ctx, models.Counter, "backfill_counter", time.Time{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []int64{2, 5, 10}, []int64{*history[0].Delta, *history[1].Delta, *history[2].Delta})
+
+	counter, err = s.GetCounter(ctx, "backfill_new")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+}
+
+// TestMemStorage_Backfill тестирует запись метрик задним числом
+func TestMemStorage_Backfill(t *testing.T) {
+	checkBackfill(t, storage.NewMemStorage())
+}
+
 // TestMemStorage_Ping тестирует проверку соединения
 func TestMemStorage_Ping(t *testing.T) {
 	s := storage.NewMemStorage()
@@ -109,13 +204,14 @@ func TestMemStorage_Ping(t *testing.T) {
 
 // TestMemStorage_ConcurrentAccess тестирует конкурентный доступ
 func TestMemStorage_ConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
 	done := make(chan bool)
 
 	for i := 0; i < 10; i++ {
 		go func(index int) {
-			s.SetGauge("concurrent_metric", float64(index))
-			s.AddCounter("concurrent_counter", int64(index))
+			s.SetGauge(ctx, "concurrent_metric", float64(index))
+			s.AddCounter(ctx, "concurrent_counter", int64(index))
 			done <- true
 		}(i)
 	}
@@ -124,28 +220,442 @@ func TestMemStorage_ConcurrentAccess(t *testing.T) {
 		<-done
 	}
 
-	_, err := s.GetGauge("concurrent_metric")
+	_, err := s.GetGauge(ctx, "concurrent_metric")
 	if err != nil {
 		t.Errorf("GetGauge after concurrent access failed: %v", err)
 	}
 
-	_, err = s.GetCounter("concurrent_counter")
+	_, err = s.GetCounter(ctx, "concurrent_counter")
 	if err != nil {
 		t.Errorf("GetCounter after concurrent access failed: %v", err)
 	}
 }
 
+// TestMemStorage_ParallelStress тестирует хранилище под параллельной нагрузкой (запускать с -race)
+func TestMemStorage_ParallelStress(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+
+	const workers = 16
+	const iterations = 300
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				name := fmt.Sprintf("metric_%d", i%50)
+				s.SetGauge(ctx, name, float64(id))
+				s.AddCounter(ctx, "shared_counter", 1)
+				s.AddCounter(ctx, name, 1)
+				s.GetGauge(ctx, name)
+				s.GetCounter(ctx, name)
+				if i%100 == 0 {
+					s.GetAll(ctx)
+					s.GetHistory(ctx, "gauge", name, time.Time{}, time.Now())
+					if _, err := json.Marshal(s); err != nil {
+						t.Errorf("Marshal failed: %v", err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total, err := s.GetCounter(ctx, "shared_counter")
+	if err != nil {
+		t.Fatalf("GetCounter failed: %v", err)
+	}
+	if total != workers*iterations {
+		t.Errorf("Expected %d, got %d", workers*iterations, total)
+	}
+
+	metrics, _ := s.GetAll(ctx)
+	if len(metrics) != 101 {
+		t.Errorf("Expected 101 metrics, got %d", len(metrics))
+	}
+}
+
+// TestMemStorage_Transaction тестирует фиксацию и откат транзакций
+func TestMemStorage_Transaction(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	tx.SetGauge(ctx, "tx_gauge", 1.5)
+	tx.AddCounter(ctx, "tx_counter", 3)
+	tx.AddCounter(ctx, "tx_counter", 4)
+
+	if _, err = s.GetGauge(ctx, "tx_gauge"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Uncommitted gauge must be invisible, got %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err = tx.Rollback(); !errors.Is(err, repositories.ErrTxDone) {
+		t.Errorf("Expected ErrTxDone on rollback after commit, got %v", err)
+	}
+
+	counter, err := s.GetCounter(ctx, "tx_counter")
+	if err != nil || counter != 7 {
+		t.Errorf("Expected committed counter 7, got %d (%v)", counter, err)
+	}
+
+	tx, _ = s.Begin(ctx)
+	tx.SetGauge(ctx, "tx_gauge", 100)
+	tx.SetGauge(ctx, "rolled_back", 1)
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	value, _ := s.GetGauge(ctx, "tx_gauge")
+	if value != 1.5 {
+		t.Errorf("Expected 1.5 after rollback, got %f", value)
+	}
+	if _, err = s.GetGauge(ctx, "rolled_back"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Rolled back gauge must be absent, got %v", err)
+	}
+}
+
+// TestMemStorage_ConcurrentTransactions тестирует параллельные независимые транзакции
+func TestMemStorage_ConcurrentTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tx, err := s.Begin(ctx)
+				if err != nil {
+					t.Errorf("Begin failed: %v", err)
+					return
+				}
+				tx.AddCounter(ctx, "a", 1)
+				tx.AddCounter(ctx, "b", 1)
+				if i%2 == 0 {
+					tx.Commit()
+				} else {
+					tx.Rollback()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	a, _ := s.GetCounter(ctx, "a")
+	b, _ := s.GetCounter(ctx, "b")
+	if a != 400 || b != 400 {
+		t.Errorf("Expected 400/400, got %d/%d", a, b)
+	}
+}
+
+// TestMemStorage_Delete тестирует удаление и сброс метрик
+func TestMemStorage_Delete(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	s.SetGauge(ctx, "host-1", 1)
+	s.SetGauge(ctx, "host-2", 2)
+	s.AddCounter(ctx, "host-3", 3)
+	s.AddCounter(ctx, "requests", 10)
+
+	if err := s.DeleteMetric(ctx, "counter", "host-1"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for wrong type, got %v", err)
+	}
+	if err := s.DeleteMetric(ctx, "gauge", "host-1"); err != nil {
+		t.Errorf("DeleteMetric failed: %v", err)
+	}
+	if _, err := s.GetGauge(ctx, "host-1"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Deleted gauge must be absent, got %v", err)
+	}
+
+	if _, err := s.DeleteMetrics(ctx, "host-["); err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+	deleted, err := s.DeleteMetrics(ctx, "host-*")
+	if err != nil || deleted != 2 {
+		t.Errorf("Expected 2 deleted, got %d (%v)", deleted, err)
+	}
+
+	if err = s.ResetCounter(ctx, "missing"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on reset of missing counter, got %v", err)
+	}
+	if err = s.ResetCounter(ctx, "requests"); err != nil {
+		t.Errorf("ResetCounter failed: %v", err)
+	}
+	s.AddCounter(ctx, "requests", 5)
+	counter, _ := s.GetCounter(ctx, "requests")
+	if counter != 5 {
+		t.Errorf("Expected 5 after reset, got %d", counter)
+	}
+
+	all, _ := s.GetAll(ctx)
+	if len(all) != 1 {
+		t.Errorf("Expected 1 metric left, got %d", len(all))
+	}
+}
+
+// TestMemStorage_Histogram тестирует слияние гистограмм
+func TestMemStorage_Histogram(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+
+	h := models.NewHistogram([]float64{0.1, 0.5, 1})
+	h.Observe(0.05)
+	h.Observe(0.7)
+	if err := s.AddHistogram(ctx, "latency", h); err != nil {
+		t.Fatalf("AddHistogram failed: %v", err)
+	}
+	h2 := models.NewHistogram([]float64{0.1, 0.5, 1})
+	h2.Observe(3)
+	if err := s.AddHistogram(ctx, "latency", h2); err != nil {
+		t.Fatalf("AddHistogram failed: %v", err)
+	}
+
+	got, err := s.GetHistogram(ctx, "latency")
+	if err != nil {
+		t.Fatalf("GetHistogram failed: %v", err)
+	}
+	if got.Count != 3 || !reflect.DeepEqual(got.Counts, []uint64{1, 0, 1, 1}) {
+		t.Errorf("Unexpected merged histogram: %+v", got)
+	}
+
+	other := models.NewHistogram([]float64{1, 2})
+	if err = s.AddHistogram(ctx, "latency", other); !errors.Is(err, models.ErrHistogramBounds) {
+		t.Errorf("Expected ErrHistogramBounds, got %v", err)
+	}
+
+	tx, _ := s.Begin(ctx)
+	tx.SetGauge(ctx, "in_batch", 1)
+	tx.AddHistogram(ctx, "latency", other)
+	if err = tx.Commit(); !errors.Is(err, models.ErrHistogramBounds) {
+		t.Errorf("Expected batch to fail with ErrHistogramBounds, got %v", err)
+	}
+	if _, err = s.GetGauge(ctx, "in_batch"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Failed batch must not be applied, got %v", err)
+	}
+
+	history, _ := s.GetHistory(ctx, models.Histogram, "latency", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	if len(history) != 2 || history[1].Histogram.Count != 3 {
+		t.Errorf("Unexpected histogram history: %+v", history)
+	}
+}
+
+// TestMemStorage_Labels тестирует хранение метрик с одинаковым именем и разными метками
+func TestMemStorage_Labels(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	hostA := models.SeriesKey("Alloc", models.Labels{"host": "a"})
+	hostB := models.SeriesKey("Alloc", models.Labels{"host": "b"})
+
+	s.SetGauge(ctx, hostA, 1)
+	s.SetGauge(ctx, hostB, 2)
+	s.SetGauge(ctx, "Alloc", 3)
+
+	if v, _ := s.GetGauge(ctx, hostA); v != 1 {
+		t.Errorf("Expected 1 for host a, got %v", v)
+	}
+	if v, _ := s.GetGauge(ctx, hostB); v != 2 {
+		t.Errorf("Expected 2 for host b, got %v", v)
+	}
+
+	all, _ := s.GetAll(ctx)
+	labeled := 0
+	for _, m := range all {
+		if m.Name != "Alloc" {
+			t.Errorf("Expected name without labels, got %q", m.Name)
+		}
+		if m.Labels["host"] != "" {
+			labeled++
+		}
+	}
+	if len(all) != 3 || labeled != 2 {
+		t.Errorf("Expected 3 series with 2 labeled, got %+v", all)
+	}
+
+	deleted, err := s.DeleteMetrics(ctx, "All*")
+	if err != nil || deleted != 3 {
+		t.Errorf("Expected 3 deleted by name pattern, got %d (%v)", deleted, err)
+	}
+}
+
+// TestMemStorage_History тестирует сохранение истории значений
+func TestMemStorage_History(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	from := time.Now().Add(-time.Second)
+
+	s.SetGauge(ctx, "temperature", 23.5)
+	s.SetGauge(ctx, "temperature", 25.0)
+	s.AddCounter(ctx, "requests", 10)
+	s.AddCounter(ctx, "requests", 5)
+
+	gauges, err := s.GetHistory(ctx, "gauge", "temperature", from, time.Now())
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(gauges) != 2 || *gauges[0].Value != 23.5 || *gauges[1].Value != 25.0 {
+		t.Errorf("Unexpected gauge history: %v", gauges)
+	}
+
+	counters, err := s.GetHistory(ctx, "counter", "requests", from, time.Now())
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(counters) != 2 || *counters[0].Delta != 10 || *counters[1].Delta != 15 {
+		t.Errorf("Unexpected counter history: %v", counters)
+	}
+
+	empty, err := s.GetHistory(ctx, "gauge", "temperature", time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(empty) != 0 {
+		t.Errorf("Expected empty history out of range, got %d points", len(empty))
+	}
+
+	_, err = s.GetHistory(ctx, "unknown", "temperature", from, time.Now())
+	if err == nil {
+		t.Error("Expected error for unknown metric type")
+	}
+}
+
+// checkSetCounter проверяет установку абсолютного значения счётчика в транзакции
+func checkSetCounter(t *testing.T, s repositories.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.AddCounter(ctx, "set_counter", 5))
+	require.NoError(t, s.AddCounter(ctx, "set_counter", 100))
+
+	tx, err := s.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetCounter(ctx, "set_counter", 3))
+	require.NoError(t, tx.SetCounter(ctx, "set_new", 7))
+	require.NoError(t, tx.Commit())
+
+	counter, err := s.GetCounter(ctx, "set_counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+	counter, err = s.GetCounter(ctx, "set_new")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+	history, err := s.GetHistory(ctx, models.Counter, "set_counter", time.Time{}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, int64(3), *history[2].Delta)
+}
+
+// TestMemStorage_SetCounter тестирует установку абсолютного значения счётчика
+func TestMemStorage_SetCounter(t *testing.T) {
+	checkSetCounter(t, storage.NewMemStorage())
+}
+
+// checkCumulative проверяет прибавление к датчику и слияние прироста накопительной гистограммы в транзакции
+func checkCumulative(t *testing.T, s repositories.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.SetGauge(ctx, "add_gauge", 10))
+	require.NoError(t, s.AddHistogram(ctx, "cumulative", models.HistogramData{Bounds: []float64{1}, Counts: []uint64{2, 1}, Count: 3, Sum: 4}))
+
+	tx, err := s.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.AddGauge(ctx, "add_gauge", -2.5))
+	require.NoError(t, tx.AddGauge(ctx, "add_new", 4))
+	require.NoError(t, tx.AddCumulativeHistogram(ctx, "cumulative", models.HistogramData{Bounds: []float64{1}, Counts: []uint64{3, 2}, Count: 5, Sum: 7}))
+	require.NoError(t, tx.AddCumulativeHistogram(ctx, "cumulative", models.HistogramData{Bounds: []float64{1}, Counts: []uint64{4, 2}, Count: 6, Sum: 8}))
+	require.NoError(t, tx.Commit())
+
+	gauge, err := s.GetGauge(ctx, "add_gauge")
+	require.NoError(t, err)
+	assert.InDelta(t, 7.5, gauge, 1e-9)
+	gauge, err = s.GetGauge(ctx, "add_new")
+	require.NoError(t, err)
+	assert.InDelta(t, 4, gauge, 1e-9)
+	h, err := s.GetHistogram(ctx, "cumulative")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{4, 2}, h.Counts, "growth since stored histogram is merged")
+	assert.Equal(t, uint64(6), h.Count)
+
+	// sender reset: whole histogram is merged
+	tx, err = s.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.AddCumulativeHistogram(ctx, "cumulative", models.HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}))
+	require.NoError(t, tx.Commit())
+	h, err = s.GetHistogram(ctx, "cumulative")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{5, 2}, h.Counts)
+	assert.InDelta(t, 8.5, h.Sum, 1e-9)
+}
+
+// TestMemStorage_Cumulative тестирует прибавление к датчику и накопительные гистограммы
+func TestMemStorage_Cumulative(t *testing.T) {
+	checkCumulative(t, storage.NewMemStorage())
+}
+
+// checkPruneHistory проверяет удаление точек истории старше границы хранения
+func checkPruneHistory(t *testing.T, s repositories.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	require.NoError(t, s.SetGauge(ctx, "prune_gauge", 10))
+	require.NoError(t, s.AddCounter(ctx, "prune_counter", 5))
+
+	tx, err := s.Begin(ctx)
+	require.NoError(t, err)
+	backfill, ok := tx.(repositories.Backfiller)
+	require.True(t, ok, "transaction must support backfill")
+	require.NoError(t, backfill.SetGaugeAt(ctx, "prune_gauge", 1, now.Add(-3*time.Hour)))
+	require.NoError(t, backfill.SetGaugeAt(ctx, "prune_gauge", 2, now.Add(-2*time.Hour)))
+	require.NoError(t, backfill.AddCounterAt(ctx, "prune_old", 7, now.Add(-3*time.Hour)))
+	require.NoError(t, tx.Commit())
+
+	pruner, ok := s.(repositories.HistoryPruner)
+	require.True(t, ok, "storage must support history pruning")
+	pruned, err := pruner.PruneHistory(ctx, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+
+	history, err := s.GetHistory(ctx, models.Gauge, "prune_gauge", time.Time{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 1, "old points are evicted")
+	assert.Equal(t, 10.0, *history[0].Value)
+	history, err = s.GetHistory(ctx, models.Counter, "prune_old", time.Time{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	counter, err := s.GetCounter(ctx, "prune_old")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter, "current value is kept")
+	history, err = s.GetHistory(ctx, models.Counter, "prune_counter", time.Time{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	pruned, err = pruner.PruneHistory(ctx, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+}
+
+// TestMemStorage_PruneHistory тестирует удаление устаревшей истории
+func TestMemStorage_PruneHistory(t *testing.T) {
+	checkPruneHistory(t, storage.NewMemStorage())
+}
+
 // ExampleMemStorage демонстрирует базовое использование MemStorage
 func ExampleMemStorage() {
+	ctx := context.Background()
 	storage := storage.NewMemStorage()
 
-	storage.SetGauge("temperature", 23.5)
-	value, _ := storage.GetGauge("temperature")
+	storage.SetGauge(ctx, "temperature", 23.5)
+	value, _ := storage.GetGauge(ctx, "temperature")
 	fmt.Printf("Temperature: %.1f\n", value)
 
-	storage.AddCounter("requests", 10)
-	storage.AddCounter("requests", 5)
-	count, _ := storage.GetCounter("requests")
+	storage.AddCounter(ctx, "requests", 10)
+	storage.AddCounter(ctx, "requests", 5)
+	count, _ := storage.GetCounter(ctx, "requests")
 	fmt.Printf("Requests: %d\n", count)
 
 	// Output:
@@ -155,13 +665,14 @@ func ExampleMemStorage() {
 
 // ExampleMemStorage_GetAll демонстрирует получение всех метрик
 func ExampleMemStorage_GetAll() {
+	ctx := context.Background()
 	storage := storage.NewMemStorage()
 
-	storage.SetGauge("cpu", 50.0)
-	storage.SetGauge("memory", 75.5)
-	storage.AddCounter("requests", 100)
+	storage.SetGauge(ctx, "cpu", 50.0)
+	storage.SetGauge(ctx, "memory", 75.5)
+	storage.AddCounter(ctx, "requests", 100)
 
-	metrics := storage.GetAll()
+	metrics, _ := storage.GetAll(ctx)
 	fmt.Printf("Total metrics: %d\n", len(metrics))
 
 	// Output:
@@ -170,14 +681,15 @@ func ExampleMemStorage_GetAll() {
 
 // ExampleMemStorage_errorHandling демонстрирует обработку ошибок
 func ExampleMemStorage_errorHandling() {
+	ctx := context.Background()
 	storage := storage.NewMemStorage()
 
-	_, err := storage.GetGauge("nonexistent")
+	_, err := storage.GetGauge(ctx, "nonexistent")
 	if err != nil {
 		fmt.Println("Metric not found")
 	}
 
-	_, err = storage.GetCounter("nonexistent")
+	_, err = storage.GetCounter(ctx, "nonexistent")
 	if err != nil {
 		fmt.Println("Counter not found")
 	}
@@ -189,31 +701,34 @@ func ExampleMemStorage_errorHandling() {
 
 // BenchmarkMemStorage_SetGauge бенчмарк для SetGauge
 func BenchmarkMemStorage_SetGauge(b *testing.B) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		s.SetGauge("benchmark_metric", float64(i))
+		s.SetGauge(ctx, "benchmark_metric", float64(i))
 	}
 }
 
 // BenchmarkMemStorage_GetGauge бенчмарк для GetGauge
 func BenchmarkMemStorage_GetGauge(b *testing.B) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
-	s.SetGauge("benchmark_metric", 123.45)
+	s.SetGauge(ctx, "benchmark_metric", 123.45)
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		s.GetGauge("benchmark_metric")
+		s.GetGauge(ctx, "benchmark_metric")
 	}
 }
 
 // BenchmarkMemStorage_AddCounter бенчмарк для AddCounter
 func BenchmarkMemStorage_AddCounter(b *testing.B) {
+	ctx := context.Background()
 	s := storage.NewMemStorage()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		s.AddCounter("benchmark_counter", 1)
+		s.AddCounter(ctx, "benchmark_counter", 1)
 	}
 }
@@ -0,0 +1,39 @@
+// Package storage embedded SQLite DB
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/golang-migrate/migrate/database"
+)
+
+// SQLiteScheme DSN prefix that selects embedded SQLite storage: sqlite://path/to/metrics.db
+const SQLiteScheme = "sqlite://"
+
+// sqliteParams WAL lets readers work alongside writer, busy timeout and immediate
+// transactions make concurrent writers wait instead of failing
+const sqliteParams = "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// Hooks of SQLite driver, it needs cgo and is registered by storageSQLiteCgo.go only in cgo builds
+var (
+	sqliteMigrationDriver func(db *sql.DB) (database.Driver, error)
+	sqliteRetryable       = func(error) bool { return false }
+)
+
+// NewSQLiteStorage single file DB with the same schema, migrations and queries as Postgres DBStorage.
+// Panics if server is built without cgo.
+func NewSQLiteStorage(path string) *DBStorage {
+	if sqliteMigrationDriver == nil {
+		panic("SQLite storage isn't available: server is built with CGO_ENABLED=0")
+	}
+	s := DBStorage{}
+	s.open("sqlite3", path+sqliteParams)
+	// one writer at a time is all SQLite supports, keep it in pool too
+	s.db.SetMaxOpenConns(1)
+	s.migrate(func() (database.Driver, error) {
+		return sqliteMigrationDriver(s.db)
+	})
+	s.prepareSQL()
+
+	return &s
+}
@@ -0,0 +1,30 @@
+//go:build cgo
+
+// Package storage SQLite driver, available only in cgo builds
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/golang-migrate/migrate/database"
+	migratesqlite3 "github.com/golang-migrate/migrate/database/sqlite3"
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sqliteMigrationDriver = func(db *sql.DB) (database.Driver, error) {
+		return migratesqlite3.WithInstance(db, &migratesqlite3.Config{})
+	}
+	sqliteRetryable = func(err error) bool {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) {
+			switch sqliteErr.Code {
+			case sqlite3.ErrBusy, // База занята другим соединением
+				sqlite3.ErrLocked: // Таблица заблокирована
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,288 @@
+//go:build cgo
+
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Nikolay961996/metsys/internal/server/repositories"
+	"github.com/Nikolay961996/metsys/internal/server/storage"
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// newTestSQLite создаёт SQLite хранилище во временном каталоге.
+// Миграции лежат относительно корня репозитория.
+func newTestSQLite(t *testing.T) (*storage.DBStorage, string) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	t.Chdir("../../..")
+	s := storage.NewSQLiteStorage(path)
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+// TestSQLiteStorage_Operations тестирует чтение и запись метрик
+func TestSQLiteStorage_Operations(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+
+	require.NoError(t, s.PingContext(ctx))
+	require.NoError(t, s.SetGauge(ctx, "temperature", 23.5))
+	require.NoError(t, s.SetGauge(ctx, "temperature", 24.5))
+	require.NoError(t, s.AddCounter(ctx, "requests", 10))
+	require.NoError(t, s.AddCounter(ctx, "requests", 5))
+
+	value, err := s.GetGauge(ctx, "temperature")
+	require.NoError(t, err)
+	assert.Equal(t, 24.5, value)
+
+	counter, err := s.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), counter)
+
+	_, err = s.GetGauge(ctx, "missing")
+	assert.True(t, errors.Is(err, repositories.ErrNotFound))
+
+	all, err := s.GetAll(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []repositories.MetricDto{
+		{Name: "temperature", Type: "gauge", Value: "24.5"},
+		{Name: "requests", Type: "counter", Value: "15"},
+	}, all)
+
+	history, err := s.GetHistory(ctx, "counter", "requests", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, int64(10), *history[0].Delta)
+	assert.Equal(t, int64(15), *history[1].Delta)
+}
+
+// TestSQLiteStorage_Transaction тестирует фиксацию и откат транзакций
+func TestSQLiteStorage_Transaction(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+
+	tx, err := s.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetGauge(ctx, "rolled_back", 1))
+	require.NoError(t, tx.Rollback())
+
+	_, err = s.GetGauge(ctx, "rolled_back")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	tx, err = s.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.AddCounter(ctx, "committed", 2))
+	require.NoError(t, tx.AddCounter(ctx, "committed", 3))
+	require.NoError(t, tx.Commit())
+	assert.ErrorIs(t, tx.Rollback(), repositories.ErrTxDone)
+
+	counter, err := s.GetCounter(ctx, "committed")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+}
+
+// TestSQLiteStorage_Persistence тестирует сохранность данных после переоткрытия файла
+func TestSQLiteStorage_Persistence(t *testing.T) {
+	ctx := context.Background()
+	s1, path := newTestSQLite(t)
+	require.NoError(t, s1.AddCounter(ctx, "requests", 7))
+	require.NoError(t, s1.Close())
+
+	s2 := storage.NewSQLiteStorage(path)
+	defer s2.Close()
+	counter, err := s2.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+}
+
+// TestSQLiteStorage_ConcurrentWrites тестирует параллельную запись счётчика
+func TestSQLiteStorage_ConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+
+	errs := make(chan error, 8)
+	for w := 0; w < 8; w++ {
+		go func() {
+			var err error
+			for i := 0; i < 20 && err == nil; i++ {
+				err = s.AddCounter(ctx, "parallel", 1)
+			}
+			errs <- err
+		}()
+	}
+	for w := 0; w < 8; w++ {
+		require.NoError(t, <-errs)
+	}
+
+	counter, err := s.GetCounter(ctx, "parallel")
+	require.NoError(t, err)
+	assert.Equal(t, int64(160), counter)
+}
+
+// TestSQLiteStorage_Delete тестирует удаление и сброс метрик
+func TestSQLiteStorage_Delete(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+
+	require.NoError(t, s.SetGauge(ctx, "host-1", 1))
+	require.NoError(t, s.AddCounter(ctx, "host-2", 2))
+	require.NoError(t, s.SetGauge(ctx, "kept", 3))
+	require.NoError(t, s.AddCounter(ctx, "requests", 10))
+
+	assert.ErrorIs(t, s.DeleteMetric(ctx, "counter", "kept"), repositories.ErrNotFound)
+	require.NoError(t, s.DeleteMetric(ctx, "gauge", "kept"))
+	_, err := s.GetGauge(ctx, "kept")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	deleted, err := s.DeleteMetrics(ctx, "host-*")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	history, err := s.GetHistory(ctx, "gauge", "host-1", time.Time{}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	assert.ErrorIs(t, s.ResetCounter(ctx, "missing"), repositories.ErrNotFound)
+	require.NoError(t, s.ResetCounter(ctx, "requests"))
+	require.NoError(t, s.AddCounter(ctx, "requests", 5))
+	counter, err := s.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+}
+
+// TestSQLiteStorage_Histogram тестирует хранение и слияние гистограмм
+func TestSQLiteStorage_Histogram(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+
+	h := models.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(2)
+	require.NoError(t, s.AddHistogram(ctx, "latency", h))
+	require.NoError(t, s.AddHistogram(ctx, "latency", h))
+
+	got, err := s.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 0, 2}, got.Counts)
+	assert.Equal(t, uint64(4), got.Count)
+
+	assert.ErrorIs(t, s.AddHistogram(ctx, "latency", models.NewHistogram([]float64{5})), models.ErrHistogramBounds)
+
+	all, err := s.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, models.Histogram, all[0].Type)
+	require.NotNil(t, all[0].Histogram)
+
+	history, err := s.GetHistory(ctx, models.Histogram, "latency", time.Time{}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, uint64(2), history[0].Histogram.Count)
+}
+
+// TestSQLiteStorage_Labels тестирует хранение метрик с метками
+func TestSQLiteStorage_Labels(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+	hostA := models.SeriesKey("PollCount", models.Labels{"host": "a", "dc": "eu"})
+	hostB := models.SeriesKey("PollCount", models.Labels{"host": "b"})
+
+	require.NoError(t, s.AddCounter(ctx, hostA, 1))
+	require.NoError(t, s.AddCounter(ctx, hostB, 10))
+	require.NoError(t, s.AddCounter(ctx, hostA, 1))
+
+	counter, err := s.GetCounter(ctx, hostA)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter)
+	_, err = s.GetCounter(ctx, "PollCount")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	all, err := s.GetAll(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []repositories.MetricDto{
+		{Name: "PollCount", Labels: models.Labels{"host": "a", "dc": "eu"}, Type: "counter", Value: "2"},
+		{Name: "PollCount", Labels: models.Labels{"host": "b"}, Type: "counter", Value: "10"},
+	}, all)
+
+	history, err := s.GetHistory(ctx, models.Counter, hostB, time.Time{}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	require.NoError(t, s.DeleteMetric(ctx, models.Counter, hostB))
+	deleted, err := s.DeleteMetrics(ctx, "Poll*")
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+// TestSQLiteStorage_EachMetric тестирует построчный обход метрик и остановку по ошибке
+func TestSQLiteStorage_EachMetric(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestSQLite(t)
+	require.NoError(t, s.SetGauge(ctx, "temperature", 24.5))
+	require.NoError(t, s.AddCounter(ctx, "requests", 15))
+
+	var got []repositories.MetricDto
+	require.NoError(t, s.EachMetric(ctx, func(m repositories.MetricDto) error {
+		got = append(got, m)
+		return nil
+	}))
+	assert.ElementsMatch(t, []repositories.MetricDto{
+		{Name: "temperature", Type: "gauge", Value: "24.5"},
+		{Name: "requests", Type: "counter", Value: "15"},
+	}, got)
+
+	errStop := errors.New("stop")
+	var calls int
+	err := s.EachMetric(ctx, func(repositories.MetricDto) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+
+	// больше одной страницы, и запись во время обхода не ждёт единственного соединения
+	tx, err := s.Begin(ctx)
+	require.NoError(t, err)
+	for i := range 2500 {
+		require.NoError(t, tx.AddCounter(ctx, fmt.Sprintf("page_%04d", i), 1))
+	}
+	require.NoError(t, tx.Commit())
+	seen := map[string]bool{}
+	require.NoError(t, s.EachMetric(ctx, func(m repositories.MetricDto) error {
+		seen[m.Name+"/"+m.Type] = true
+		return s.SetGauge(ctx, "temperature", 25)
+	}))
+	assert.Len(t, seen, 2502)
+}
+
+// TestSQLiteStorage_Backfill тестирует запись метрик задним числом
+func TestSQLiteStorage_Backfill(t *testing.T) {
+	s, _ := newTestSQLite(t)
+	checkBackfill(t, s)
+}
+
+// TestSQLiteStorage_PruneHistory тестирует удаление устаревших строк истории
+func TestSQLiteStorage_PruneHistory(t *testing.T) {
+	s, _ := newTestSQLite(t)
+	checkPruneHistory(t, s)
+}
+
+// TestSQLiteStorage_SetCounter тестирует установку абсолютного значения счётчика
+func TestSQLiteStorage_SetCounter(t *testing.T) {
+	s, _ := newTestSQLite(t)
+	checkSetCounter(t, s)
+}
+
+// TestSQLiteStorage_Cumulative тестирует прибавление к датчику и накопительные гистограммы
+func TestSQLiteStorage_Cumulative(t *testing.T) {
+	s, _ := newTestSQLite(t)
+	checkCumulative(t, s)
+}
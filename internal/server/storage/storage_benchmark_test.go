@@ -1,36 +1,84 @@
 package storage
 
 import (
+	"context"
+	"strconv"
+	"sync/atomic"
 	"testing"
 )
 
 func BenchmarkMemStorageDBGet(b *testing.B) {
+	ctx := context.Background()
 	for i := 0; i < b.N; i++ {
 		s := NewMemStorage()
-		s.SetGauge("111", 111.1)
-		s.SetGauge("112", 111.1)
-		s.SetGauge("113", 111.1)
-		s.SetGauge("114", 111.1)
-		s.SetGauge("115", 111.1)
-		s.SetGauge("116", 111.1)
-		s.SetGauge("117", 111.1)
-		s.SetGauge("118", 111.1)
-		s.SetGauge("119", 111.1)
-		_, _ = s.GetGauge("111")
-		_, _ = s.GetGauge("11x")
+		s.SetGauge(ctx, "111", 111.1)
+		s.SetGauge(ctx, "112", 111.1)
+		s.SetGauge(ctx, "113", 111.1)
+		s.SetGauge(ctx, "114", 111.1)
+		s.SetGauge(ctx, "115", 111.1)
+		s.SetGauge(ctx, "116", 111.1)
+		s.SetGauge(ctx, "117", 111.1)
+		s.SetGauge(ctx, "118", 111.1)
+		s.SetGauge(ctx, "119", 111.1)
+		_, _ = s.GetGauge(ctx, "111")
+		_, _ = s.GetGauge(ctx, "11x")
 
-		s.AddCounter("221", 222)
-		s.AddCounter("222", 222)
-		s.AddCounter("223", 222)
-		s.AddCounter("224", 222)
-		s.AddCounter("225", 222)
-		s.AddCounter("226", 222)
-		s.AddCounter("227", 222)
-		s.AddCounter("228", 222)
-		s.AddCounter("229", 222)
-		_, _ = s.GetCounter("222")
-		_, _ = s.GetCounter("22x")
+		s.AddCounter(ctx, "221", 222)
+		s.AddCounter(ctx, "222", 222)
+		s.AddCounter(ctx, "223", 222)
+		s.AddCounter(ctx, "224", 222)
+		s.AddCounter(ctx, "225", 222)
+		s.AddCounter(ctx, "226", 222)
+		s.AddCounter(ctx, "227", 222)
+		s.AddCounter(ctx, "228", 222)
+		s.AddCounter(ctx, "229", 222)
+		_, _ = s.GetCounter(ctx, "222")
+		_, _ = s.GetCounter(ctx, "22x")
 
-		_ = s.GetAll()
+		_, _ = s.GetAll(ctx)
 	}
 }
+
+func BenchmarkMemStorageParallelSetGauge(b *testing.B) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	var id atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		name := "gauge_" + strconv.FormatInt(id.Add(1), 10)
+		i := 0
+		for pb.Next() {
+			_ = s.SetGauge(ctx, name, float64(i))
+			i++
+		}
+	})
+}
+
+func BenchmarkMemStorageParallelAddCounterSameMetric(b *testing.B) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = s.AddCounter(ctx, "shared", 1)
+		}
+	})
+}
+
+func BenchmarkMemStorageParallelMixed(b *testing.B) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	for i := 0; i < 1000; i++ {
+		_ = s.SetGauge(ctx, "gauge_"+strconv.Itoa(i), float64(i))
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			name := "gauge_" + strconv.Itoa(i%1000)
+			if i%10 == 0 {
+				_ = s.SetGauge(ctx, name, float64(i))
+			} else {
+				_, _ = s.GetGauge(ctx, name)
+			}
+			i++
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -14,6 +15,7 @@ import (
 )
 
 func TestStorage(t *testing.T) {
+	ctx := context.Background()
 	tests := []struct {
 		name          string
 		metricType    string
@@ -38,13 +40,13 @@ func TestStorage(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			switch tt.metricType {
 			case models.Gauge:
-				s.SetGauge(tt.metricName, tt.metricValue)
-				v, err := s.GetGauge(tt.metricName)
+				s.SetGauge(ctx, tt.metricName, tt.metricValue)
+				v, err := s.GetGauge(ctx, tt.metricName)
 				require.NoError(t, err)
 				assert.Equal(t, tt.expectedValue, v)
 			case models.Counter:
-				s.AddCounter(tt.metricName, int64(tt.metricValue))
-				v, err := s.GetCounter(tt.metricName)
+				s.AddCounter(ctx, tt.metricName, int64(tt.metricValue))
+				v, err := s.GetCounter(ctx, tt.metricName)
 				require.NoError(t, err)
 				assert.Equal(t, int64(tt.expectedValue), v)
 			default:
@@ -55,56 +57,56 @@ func TestStorage(t *testing.T) {
 }
 
 func TestSyncSaveFile(t *testing.T) {
+	ctx := context.Background()
 	file := "tst.db"
 	s := NewFileStorage(file, 0, false)
-	s.SetGauge("aaa", 123.4)
-	s.AddCounter("bbb", 987)
+	s.SetGauge(ctx, "aaa", 123.4)
+	s.AddCounter(ctx, "bbb", 987)
+	require.NoError(t, s.Close())
 
 	bytes, err := os.ReadFile(file)
 	require.NoError(t, err)
 	var s2 MemStorage
 	err = json.Unmarshal(bytes, &s2)
 	require.NoError(t, err)
-	g1, err := s.GetGauge("aaa")
+	g1, err := s.GetGauge(ctx, "aaa")
 	require.NoError(t, err)
-	c1, err := s.GetCounter("bbb")
+	c1, err := s.GetCounter(ctx, "bbb")
 	require.NoError(t, err)
-	g2, err := s2.GetGauge("aaa")
+	g2, err := s2.GetGauge(ctx, "aaa")
 	require.NoError(t, err)
-	c2, err := s2.GetCounter("bbb")
+	c2, err := s2.GetCounter(ctx, "bbb")
 	require.NoError(t, err)
 	assert.Equal(t, g1, g2)
 	assert.Equal(t, c1, c2)
 }
 
 func TestSaveFile(t *testing.T) {
+	ctx := context.Background()
 	file := "tst.db"
 	s := NewFileStorage(file, 0, false)
-	s.SetGauge("aaa", 123.4)
-	s.AddCounter("bbb", 987)
+	s.SetGauge(ctx, "aaa", 123.4)
+	s.AddCounter(ctx, "bbb", 987)
+	require.NoError(t, s.Close())
 
 	bytes, err := os.ReadFile(file)
 	require.NoError(t, err)
 	var s2 MemStorage
 	err = json.Unmarshal(bytes, &s2)
 	require.NoError(t, err)
-	g1, err := s.GetGauge("aaa")
+	g1, err := s.GetGauge(ctx, "aaa")
 	require.NoError(t, err)
-	g2, err := s2.GetGauge("aaa")
+	g2, err := s2.GetGauge(ctx, "aaa")
 	require.NoError(t, err)
 	assert.Equal(t, g1, g2)
 }
 
 func TestLoadFile(t *testing.T) {
+	ctx := context.Background()
 	file := "tst.db"
-	s := MemStorage{
-		GaugeMetrics: map[string]float64{
-			"aaa1": 13.3,
-		},
-		CounterMetrics: map[string]int64{
-			"ccc3": 888,
-		},
-	}
+	s := NewMemStorage()
+	require.NoError(t, s.SetGauge(ctx, "aaa1", 13.3))
+	require.NoError(t, s.AddCounter(ctx, "ccc3", 888))
 
 	bytes, err := json.Marshal(s)
 	require.NoError(t, err)
@@ -112,15 +114,15 @@ func TestLoadFile(t *testing.T) {
 	require.NoError(t, err)
 
 	s2 := NewFileStorage(file, 5*time.Second, true)
-	g1, err := s.GetGauge("aaa1")
+	g1, err := s.GetGauge(ctx, "aaa1")
 	require.NoError(t, err)
-	g2, err := s2.GetGauge("aaa1")
+	g2, err := s2.GetGauge(ctx, "aaa1")
 	require.NoError(t, err)
 	assert.Equal(t, g1, g2)
 
-	c1, err := s.GetCounter("ccc3")
+	c1, err := s.GetCounter(ctx, "ccc3")
 	require.NoError(t, err)
-	c2, err := s2.GetCounter("ccc3")
+	c2, err := s2.GetCounter(ctx, "ccc3")
 	require.NoError(t, err)
 	assert.Equal(t, c1, c2)
 }
@@ -0,0 +1,284 @@
+// Package storage write-ahead log of FileStorage
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Nikolay961996/metsys/models"
+)
+
+// walSuffix journal lives next to the snapshot: <snapshot><walSuffix>
+const walSuffix = ".wal"
+
+// journal ops besides plain writes
+const (
+	walOpDelete     = "delete"
+	walOpReset      = "reset"
+	walOpSet        = "set"
+	walOpAdd        = "add"
+	walOpCumulative = "cumulative"
+)
+
+// walRecord one line of journal, batch of writes applied together.
+// Record is complete only with trailing newline, so a torn tail is detected and dropped.
+// Seq grows across journal resets, snapshot keeps the last one it covers.
+type walRecord struct {
+	Timestamp time.Time   `json:"ts"`
+	Metrics   []walMetric `json:"metrics"`
+	Seq       uint64      `json:"seq,omitempty"`
+}
+
+// walMetric journaled op, Op is empty for gauge set, counter add and histogram merge.
+// Timestamp is set for backfill only, other ops happen at record time.
+type walMetric struct {
+	Timestamp *time.Time            `json:"ts,omitempty"`
+	Value     *float64              `json:"value,omitempty"`
+	Delta     *int64                `json:"delta,omitempty"`
+	Histogram *models.HistogramData `json:"histogram,omitempty"`
+	ID        string                `json:"id"`
+	MType     string                `json:"type"`
+	Op        string                `json:"op,omitempty"`
+}
+
+func newWalRecord(ops []memOp, ts time.Time) walRecord {
+	r := walRecord{
+		Timestamp: ts,
+		Metrics:   make([]walMetric, 0, len(ops)),
+	}
+	for _, op := range ops {
+		mr := walMetric{ID: op.name, MType: op.metricType}
+		if !op.ts.IsZero() {
+			ts := op.ts
+			mr.Timestamp = &ts
+		}
+		switch {
+		case op.kind == opDelete:
+			mr.Op = walOpDelete
+		case op.kind == opReset:
+			mr.Op = walOpReset
+		case op.kind == opSet:
+			mr.Op = walOpSet
+			d := op.delta
+			mr.Delta = &d
+		case op.kind == opAdd:
+			mr.Op = walOpAdd
+			v := op.value
+			mr.Value = &v
+		case op.kind == opCumulative:
+			mr.Op = walOpCumulative
+			h := op.histogram
+			mr.Histogram = &h
+		case op.metricType == models.Gauge:
+			v := op.value
+			mr.Value = &v
+		case op.metricType == models.Counter:
+			d := op.delta
+			mr.Delta = &d
+		case op.metricType == models.Histogram:
+			h := op.histogram
+			mr.Histogram = &h
+		}
+		r.Metrics = append(r.Metrics, mr)
+	}
+	return r
+}
+
+func (r walRecord) ops() ([]memOp, error) {
+	ops := make([]memOp, 0, len(r.Metrics))
+	for _, mr := range r.Metrics {
+		op, err := mr.memOp()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func (mr walMetric) memOp() (memOp, error) {
+	op := memOp{name: mr.ID, metricType: mr.MType}
+	if mr.Timestamp != nil {
+		op.ts = mr.Timestamp.UTC()
+	}
+	bad := fmt.Errorf("bad journal metric %q of type %q", mr.ID, mr.MType)
+
+	switch {
+	case mr.MType != models.Gauge && mr.MType != models.Counter && mr.MType != models.Histogram:
+		return op, bad
+	case mr.Op == walOpDelete:
+		op.kind = opDelete
+	case mr.Op == walOpReset && mr.MType == models.Counter:
+		op.kind = opReset
+	case mr.Op == walOpSet && mr.MType == models.Counter && mr.Delta != nil:
+		op.kind = opSet
+		op.delta = *mr.Delta
+	case mr.Op == walOpAdd && mr.MType == models.Gauge && mr.Value != nil:
+		op.kind = opAdd
+		op.value = *mr.Value
+	case mr.Op == walOpCumulative && mr.MType == models.Histogram && mr.Histogram != nil:
+		op.kind = opCumulative
+		op.histogram = *mr.Histogram
+	case mr.Op != "":
+		return op, bad
+	case mr.MType == models.Gauge && mr.Value != nil:
+		op.value = *mr.Value
+	case mr.MType == models.Counter && mr.Delta != nil:
+		op.delta = *mr.Delta
+	case mr.MType == models.Histogram && mr.Histogram != nil:
+		op.histogram = *mr.Histogram
+	default:
+		return op, bad
+	}
+	return op, nil
+}
+
+// walJournal append-only file of walRecord
+type walJournal struct {
+	file    *os.File
+	path    string
+	records int
+	seq     uint64 // seq of the last record
+}
+
+func (j *walJournal) open() error {
+	if j.file != nil {
+		return nil
+	}
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("open journal error: %w", err)
+	}
+	j.file = f
+	return nil
+}
+
+// append writes record with a single write call, fsync is done only when sync is set
+func (j *walJournal) append(r walRecord, sync bool) error {
+	if err := j.open(); err != nil {
+		return err
+	}
+	j.seq++
+	r.Seq = j.seq
+	d, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("json marshal error: %w", err)
+	}
+	_, err = j.file.Write(append(d, '\n'))
+	if err != nil {
+		return fmt.Errorf("write journal error: %w", err)
+	}
+	j.records++
+	if sync {
+		if err = j.file.Sync(); err != nil {
+			return fmt.Errorf("sync journal error: %w", err)
+		}
+	}
+	return nil
+}
+
+// reset drops journal content, called once snapshot covering it is durable
+func (j *walJournal) reset() error {
+	if err := j.open(); err != nil {
+		return err
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate journal error: %w", err)
+	}
+	j.records = 0
+	return j.file.Sync()
+}
+
+func (j *walJournal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// replay reads complete records in order and passes them to apply, records up to seq after are already
+// in snapshot (crash before journal reset) and skipped.
+// Reading stops at first torn or broken record, the rest of the file is cut off.
+func (j *walJournal) replay(after uint64, apply func(walRecord) error) error {
+	j.seq = after
+	d, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read journal error: %w", err)
+	}
+
+	offset := 0
+	for offset < len(d) {
+		end := bytes.IndexByte(d[offset:], '\n')
+		if end < 0 {
+			models.Log.Warn(fmt.Sprintf("Journal %s has torn tail at %d, dropped", j.path, offset))
+			break
+		}
+		var r walRecord
+		if err = json.Unmarshal(d[offset:offset+end], &r); err != nil {
+			models.Log.Warn(fmt.Sprintf("Journal %s has broken record at %d, dropped: %v", j.path, offset, err))
+			break
+		}
+		if r.Seq == 0 || r.Seq > after {
+			if err = apply(r); err != nil {
+				models.Log.Warn(fmt.Sprintf("Journal %s has broken record at %d, dropped: %v", j.path, offset, err))
+				break
+			}
+		}
+		j.seq = max(j.seq, r.Seq)
+		offset += end + 1
+		j.records++
+	}
+
+	if offset < len(d) {
+		if err = os.Truncate(j.path, int64(offset)); err != nil {
+			return fmt.Errorf("truncate journal error: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces file with data via temp file + fsync + rename,
+// so readers see either old or new content, never a partial one
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// persist rename itself
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+// Statuses of metric in batch update
+const (
+	UpdateStored   = "stored"
+	UpdateRejected = "rejected"
+)
+
+// UpdateResult outcome of one metric of batch update, Code, Reason and Errors are set for rejected metric
+type UpdateResult struct {
+	Labels Labels       `json:"labels,omitempty"`
+	ID     string       `json:"id"`
+	MType  string       `json:"type"`
+	Status string       `json:"status"`
+	Code   ErrorCode    `json:"code,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// BatchResponse response of batch update, results are in request order
+type BatchResponse struct {
+	Results []UpdateResult `json:"results"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "fmt"
+
+// ErrorCode machine readable kind of API error, the same over HTTP and gRPC
+type ErrorCode string
+
+// Error codes of API
+const (
+	ErrCodeNotFound           ErrorCode = "not_found"
+	ErrCodeInvalidType        ErrorCode = "invalid_type"
+	ErrCodeInvalidValue       ErrorCode = "invalid_value"
+	ErrCodeInvalidName        ErrorCode = "invalid_name"
+	ErrCodeInvalidLabels      ErrorCode = "invalid_labels"
+	ErrCodeInvalidRequest     ErrorCode = "invalid_request"
+	ErrCodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	ErrCodeForbidden          ErrorCode = "forbidden" // client isn't in trusted subnet
+	ErrCodeAborted            ErrorCode = "aborted"   // valid metric of atomic batch isn't stored because of others
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+	ErrCodeTooLarge           ErrorCode = "too_large" // body or batch over limit
+	ErrCodeStorageUnavailable ErrorCode = "storage_unavailable"
+	ErrCodeInternal           ErrorCode = "internal"
+)
+
+// ProblemContentType content type of Problem
+const ProblemContentType = "application/problem+json"
+
+// APIError error of metrics API with code for clients, Err is the cause
+type APIError struct {
+	Err    error
+	Code   ErrorCode
+	Metric string // name of metric error is about, empty if none
+}
+
+// NewAPIError error with code about metric (may be empty), message formatted as in fmt.Errorf
+func NewAPIError(code ErrorCode, metric string, format string, args ...any) *APIError {
+	return &APIError{Code: code, Metric: metric, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Problem error response of HTTP API, problem details document (RFC 9457)
+// with code, metric, invalid fields and batch results extension members
+type Problem struct {
+	Type    string         `json:"type"`
+	Title   string         `json:"title"`
+	Detail  string         `json:"detail"`
+	Code    ErrorCode      `json:"code"`
+	Metric  string         `json:"metric,omitempty"`
+	Errors  []FieldError   `json:"errors,omitempty"`
+	Results []UpdateResult `json:"results,omitempty"`
+	Status  int            `json:"status"`
+}
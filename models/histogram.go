@@ -0,0 +1,130 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// ErrHistogramBounds histogram can't be merged with stored one or is malformed
+var ErrHistogramBounds = errors.New("invalid histogram bounds")
+
+// HistogramData observations spread over buckets.
+// Counts[i] is number of observations in (Bounds[i-1], Bounds[i]],
+// the last element of Counts is +Inf bucket, so len(Counts) == len(Bounds)+1.
+// Histogram is reported as delta since last send and merged on server like counter.
+type HistogramData struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// HistogramBucket bucket for displaying
+type HistogramBucket struct {
+	UpperBound string
+	Count      uint64
+}
+
+// NewHistogram empty histogram with given bucket bounds
+func NewHistogram(bounds []float64) HistogramData {
+	return HistogramData{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds one observation
+func (h *HistogramData) Observe(v float64) {
+	h.ObserveN(v, 1)
+}
+
+// ObserveN adds observation v seen n times, e.g. weighted by sample rate
+func (h *HistogramData) ObserveN(v float64, n uint64) {
+	i, _ := slices.BinarySearch(h.Bounds, v)
+	h.Counts[i] += n
+	h.Count += n
+	h.Sum += v * float64(n)
+}
+
+// Validate checks that bounds are finite and strictly increasing and counts agree with them
+func (h *HistogramData) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: %d counts for %d bounds", ErrHistogramBounds, len(h.Counts), len(h.Bounds))
+	}
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("%w: bound %v", ErrHistogramBounds, b)
+		}
+		if i > 0 && b <= h.Bounds[i-1] {
+			return fmt.Errorf("%w: bounds must be increasing", ErrHistogramBounds)
+		}
+	}
+
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("%w: count %d doesn't match buckets total %d", ErrHistogramBounds, h.Count, total)
+	}
+	return nil
+}
+
+// Merge adds other histogram with the same bounds
+func (h *HistogramData) Merge(other HistogramData) error {
+	if !slices.Equal(h.Bounds, other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return fmt.Errorf("%w: bounds %v differ from stored %v", ErrHistogramBounds, other.Bounds, h.Bounds)
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	return nil
+}
+
+// GrowthSince part of cumulative histogram h added after stored one: h minus stored.
+// h itself is returned if some bucket went down (sender reset) or bounds differ, Merge reports the latter.
+func (h HistogramData) GrowthSince(stored HistogramData) HistogramData {
+	if !slices.Equal(h.Bounds, stored.Bounds) || len(h.Counts) != len(stored.Counts) || h.Count < stored.Count {
+		return h
+	}
+	growth := h.Clone()
+	for i, c := range stored.Counts {
+		if growth.Counts[i] < c {
+			return h
+		}
+		growth.Counts[i] -= c
+	}
+	growth.Count -= stored.Count
+	growth.Sum -= stored.Sum
+	return growth
+}
+
+// Clone deep copy
+func (h HistogramData) Clone() HistogramData {
+	h.Bounds = slices.Clone(h.Bounds)
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// Buckets per bucket counts with printable upper bound
+func (h HistogramData) Buckets() []HistogramBucket {
+	r := make([]HistogramBucket, 0, len(h.Counts))
+	for i, c := range h.Counts {
+		upper := "+Inf"
+		if i < len(h.Bounds) {
+			upper = strconv.FormatFloat(h.Bounds[i], 'f', -1, 64)
+		}
+		r = append(r, HistogramBucket{UpperBound: upper, Count: c})
+	}
+	return r
+}
+
+// String short summary: count and sum
+func (h HistogramData) String() string {
+	return fmt.Sprintf("count=%d sum=%s", h.Count, strconv.FormatFloat(h.Sum, 'f', -1, 64))
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLabels label name or matcher is malformed
+var ErrInvalidLabels = errors.New("invalid labels")
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels optional dimensions of metric, e.g. host or region.
+// Metric is identified by its name together with labels, see SeriesKey.
+type Labels map[string]string
+
+// Validate checks label names
+func (l Labels) Validate() error {
+	for name := range l {
+		if !labelNameRe.MatchString(name) {
+			return fmt.Errorf("%w: label name %q", ErrInvalidLabels, name)
+		}
+	}
+	return nil
+}
+
+// String canonical form sorted by name: a="1",b="2"
+func (l Labels) String() string {
+	var b strings.Builder
+	for i, name := range slices.Sorted(maps.Keys(l)) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[name]))
+	}
+	return b.String()
+}
+
+// ParseLabels reads labels in canonical form produced by Labels.String
+func ParseLabels(s string) (Labels, error) {
+	if s == "" {
+		return nil, nil
+	}
+	l := Labels{}
+	for s != "" {
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLabels, s)
+		}
+		name := s[:i]
+		quoted, err := strconv.QuotedPrefix(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: value of %q", ErrInvalidLabels, name)
+		}
+		l[name], _ = strconv.Unquote(quoted)
+
+		s = s[i+1+len(quoted):]
+		if s != "" {
+			if s[0] != ',' {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidLabels, s)
+			}
+			s = s[1:]
+		}
+	}
+	return l, l.Validate()
+}
+
+// SeriesKey storage key of metric: name alone or name{a="1",b="2"} with sorted labels
+func SeriesKey(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	return name + "{" + labels.String() + "}"
+}
+
+// SplitSeriesKey reverse of SeriesKey, key without valid labels part is treated as plain name
+func SplitSeriesKey(key string) (string, Labels) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+	labels, err := ParseLabels(key[i+1 : len(key)-1])
+	if err != nil {
+		return key, nil
+	}
+	return key[:i], labels
+}
+
+// MatchType comparison of LabelMatcher
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher selects metrics by label value, absent label has empty value
+type LabelMatcher struct {
+	re    *regexp.Regexp
+	Name  string
+	Value string
+	Type  MatchType
+}
+
+// ParseLabelMatcher reads matcher like host=a, host!=a, host=~"a|b" or host!~a.*
+func ParseLabelMatcher(s string) (LabelMatcher, error) {
+	var m LabelMatcher
+	i := strings.IndexAny(s, "=!")
+	if i < 0 {
+		return m, fmt.Errorf("%w: matcher %q", ErrInvalidLabels, s)
+	}
+	m.Name = s[:i]
+	if !labelNameRe.MatchString(m.Name) {
+		return m, fmt.Errorf("%w: label name %q", ErrInvalidLabels, m.Name)
+	}
+
+	rest := s[i:]
+	for _, t := range []MatchType{MatchNotEqual, MatchRegexp, MatchNotRegexp, MatchEqual} {
+		if strings.HasPrefix(rest, string(t)) {
+			m.Type = t
+			m.Value = rest[len(t):]
+			break
+		}
+	}
+	if m.Type == "" {
+		return m, fmt.Errorf("%w: matcher %q", ErrInvalidLabels, s)
+	}
+	if v, err := strconv.Unquote(m.Value); err == nil {
+		m.Value = v
+	}
+
+	if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return m, fmt.Errorf("%w: %v", ErrInvalidLabels, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether labels satisfy matcher
+func (m LabelMatcher) Matches(labels Labels) bool {
+	v := labels[m.Name]
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// MatchLabels reports whether labels satisfy all matchers
+func MatchLabels(matchers []LabelMatcher, labels Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
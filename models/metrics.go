@@ -9,8 +9,9 @@ import (
 
 // Metric types
 const (
-	Counter = "counter"
-	Gauge   = "gauge"
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
 )
 
 var (
@@ -27,14 +28,23 @@ const (
 // Delta и Value объявлены через указатели,
 // что бы отличать значение "0", от не заданного значения
 // и соответственно не кодировать в структуру.
+// Histogram заполняется только для типа histogram.
+// Labels необязательны, метрика определяется именем вместе с метками.
 type Metrics struct {
-	Value *float64 `json:"value,omitempty"`
-	Delta *int64   `json:"delta,omitempty"`
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
+	Value     *float64       `json:"value,omitempty"`
+	Delta     *int64         `json:"delta,omitempty"`
+	Histogram *HistogramData `json:"histogram,omitempty"`
+	Labels    Labels         `json:"labels,omitempty"`
+	ID        string         `json:"id"`
+	MType     string         `json:"type"`
 	//Hash  string   `json:"hash,omitempty"`
 }
 
+// Key storage key of metric, see SeriesKey
+func (m *Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
 // Initialize logger
 func Initialize(level string) error {
 	lvl, err := zap.ParseAtomicLevel(level)
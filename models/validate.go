@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// MaxMetricNameLength limit of metric name, the same as id column of DB storage
+const MaxMetricNameLength = 255
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+
+// SanitizeMetricName replaces characters not allowed in metric name (see metricNameRe) with _
+func SanitizeMetricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("_.:-", r):
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// FieldError reason why field of metric is rejected
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError metric is rejected, Fields lists every invalid field in order id, type, value, labels
+type ValidationError struct {
+	Metric string
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		reasons[i] = f.Field + ": " + f.Reason
+	}
+	return fmt.Sprintf("invalid metric %q: %s", e.Metric, strings.Join(reasons, "; "))
+}
+
+// Code API error code of the first invalid field
+func (e *ValidationError) Code() ErrorCode {
+	if len(e.Fields) == 0 {
+		return ErrCodeInvalidValue
+	}
+	switch e.Fields[0].Field {
+	case "id":
+		return ErrCodeInvalidName
+	case "type":
+		return ErrCodeInvalidType
+	case "labels":
+		return ErrCodeInvalidLabels
+	default:
+		return ErrCodeInvalidValue
+	}
+}
+
+// Validate checks metric before write: name charset and length, known type,
+// value required for the type (value, delta or histogram) and finite, label names.
+// Returns *ValidationError listing all invalid fields.
+func (m *Metrics) Validate() error {
+	e := &ValidationError{Metric: m.ID}
+	fail := func(field string, format string, args ...any) {
+		e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case m.ID == "":
+		fail("id", "required")
+	case len(m.ID) > MaxMetricNameLength:
+		fail("id", "longer than %d bytes", MaxMetricNameLength)
+	case !metricNameRe.MatchString(m.ID):
+		fail("id", "only letters, digits and _ . : - are allowed")
+	}
+
+	switch m.MType {
+	case Gauge:
+		if m.Value == nil {
+			fail("value", "required for gauge")
+		} else if math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0) {
+			fail("value", "must be finite, got %v", *m.Value)
+		}
+	case Counter:
+		if m.Delta == nil {
+			fail("delta", "required for counter")
+		}
+	case Histogram:
+		if m.Histogram == nil {
+			fail("histogram", "required for histogram")
+		} else if err := m.Histogram.Validate(); err != nil {
+			fail("histogram", "%v", err)
+		} else if math.IsNaN(m.Histogram.Sum) || math.IsInf(m.Histogram.Sum, 0) {
+			fail("histogram", "sum must be finite, got %v", m.Histogram.Sum)
+		}
+	case "":
+		fail("type", "required")
+	default:
+		fail("type", "unknown type %q, want %s, %s or %s", m.MType, Gauge, Counter, Histogram)
+	}
+
+	if err := m.Labels.Validate(); err != nil {
+		fail("labels", "%v", err)
+	}
+
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+}
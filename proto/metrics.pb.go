@@ -25,7 +25,8 @@ const (
 type MetricRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"` // counter or gauge
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                                                                               // counter, gauge or histogram
+	Labels        map[string]string      `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // identify metric together with id
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -74,15 +75,24 @@ func (x *MetricRequest) GetType() string {
 	return ""
 }
 
+func (x *MetricRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
 // Response message for a metric
 type MetricResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Histogram     *Histogram             `protobuf:"bytes,5,opt,name=histogram,proto3" json:"histogram,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
-	Value         float64                `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
-	Delta         int64                  `protobuf:"varint,4,opt,name=delta,proto3" json:"delta,omitempty"`
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+	Value         float64 `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
+	Delta         int64   `protobuf:"varint,4,opt,name=delta,proto3" json:"delta,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *MetricResponse) Reset() {
@@ -143,13 +153,32 @@ func (x *MetricResponse) GetDelta() int64 {
 	return 0
 }
 
-// Request message for updating a metric
+func (x *MetricResponse) GetHistogram() *Histogram {
+	if x != nil {
+		return x.Histogram
+	}
+	return nil
+}
+
+func (x *MetricResponse) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+// Request message for updating a metric.
+// value and delta are optional to tell unset field from zero, request without value of its type is rejected
+// with INVALID_ARGUMENT. Clients built from older proto (plain double/int64) don't send zero on the wire,
+// so their zero updates are rejected too: regenerate them from this file to send zero explicitly
 type MetricUpdateRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
-	Value         float64                `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
-	Delta         int64                  `protobuf:"varint,4,opt,name=delta,proto3" json:"delta,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                                                                               // counter, gauge or histogram
+	Value         *float64               `protobuf:"fixed64,3,opt,name=value,proto3,oneof" json:"value,omitempty"`                                                                     // required for gauge type
+	Delta         *int64                 `protobuf:"varint,4,opt,name=delta,proto3,oneof" json:"delta,omitempty"`                                                                      // required for counter type
+	Histogram     *Histogram             `protobuf:"bytes,5,opt,name=histogram,proto3" json:"histogram,omitempty"`                                                                     // required for histogram type
+	Labels        map[string]string      `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // optional, e.g. host
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -199,15 +228,98 @@ func (x *MetricUpdateRequest) GetType() string {
 }
 
 func (x *MetricUpdateRequest) GetValue() float64 {
-	if x != nil {
-		return x.Value
+	if x != nil && x.Value != nil {
+		return *x.Value
 	}
 	return 0
 }
 
 func (x *MetricUpdateRequest) GetDelta() int64 {
+	if x != nil && x.Delta != nil {
+		return *x.Delta
+	}
+	return 0
+}
+
+func (x *MetricUpdateRequest) GetHistogram() *Histogram {
 	if x != nil {
-		return x.Delta
+		return x.Histogram
+	}
+	return nil
+}
+
+func (x *MetricUpdateRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+// Histogram observations, counts has one more element than bounds (+Inf bucket)
+type Histogram struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bounds        []float64              `protobuf:"fixed64,1,rep,packed,name=bounds,proto3" json:"bounds,omitempty"`
+	Counts        []uint64               `protobuf:"varint,2,rep,packed,name=counts,proto3" json:"counts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	Count         uint64  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	Sum           float64 `protobuf:"fixed64,4,opt,name=sum,proto3" json:"sum,omitempty"`
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Histogram) Reset() {
+	*x = Histogram{}
+	mi := &file_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Histogram) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Histogram) ProtoMessage() {}
+
+func (x *Histogram) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Histogram.ProtoReflect.Descriptor instead.
+func (*Histogram) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Histogram) GetBounds() []float64 {
+	if x != nil {
+		return x.Bounds
+	}
+	return nil
+}
+
+func (x *Histogram) GetCounts() []uint64 {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+func (x *Histogram) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *Histogram) GetSum() float64 {
+	if x != nil {
+		return x.Sum
 	}
 	return 0
 }
@@ -218,11 +330,12 @@ type BatchMetricUpdateRequest struct {
 	Metrics       []*MetricUpdateRequest `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
+	BestEffort    bool `protobuf:"varint,2,opt,name=best_effort,json=bestEffort,proto3" json:"best_effort,omitempty"`
 }
 
 func (x *BatchMetricUpdateRequest) Reset() {
 	*x = BatchMetricUpdateRequest{}
-	mi := &file_metrics_proto_msgTypes[3]
+	mi := &file_metrics_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -234,7 +347,7 @@ func (x *BatchMetricUpdateRequest) String() string {
 func (*BatchMetricUpdateRequest) ProtoMessage() {}
 
 func (x *BatchMetricUpdateRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_metrics_proto_msgTypes[3]
+	mi := &file_metrics_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -247,7 +360,7 @@ func (x *BatchMetricUpdateRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BatchMetricUpdateRequest.ProtoReflect.Descriptor instead.
 func (*BatchMetricUpdateRequest) Descriptor() ([]byte, []int) {
-	return file_metrics_proto_rawDescGZIP(), []int{3}
+	return file_metrics_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *BatchMetricUpdateRequest) GetMetrics() []*MetricUpdateRequest {
@@ -257,17 +370,25 @@ func (x *BatchMetricUpdateRequest) GetMetrics() []*MetricUpdateRequest {
 	return nil
 }
 
+func (x *BatchMetricUpdateRequest) GetBestEffort() bool {
+	if x != nil {
+		return x.BestEffort
+	}
+	return false
+}
+
 // Response message for batch updating metrics
 type BatchMetricUpdateResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Metrics       []*MetricResponse      `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	Metrics       []*MetricResponse      `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"` // stored metrics
+	Results       []*MetricResult        `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"` // outcome of every metric in request order
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *BatchMetricUpdateResponse) Reset() {
 	*x = BatchMetricUpdateResponse{}
-	mi := &file_metrics_proto_msgTypes[4]
+	mi := &file_metrics_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -279,7 +400,7 @@ func (x *BatchMetricUpdateResponse) String() string {
 func (*BatchMetricUpdateResponse) ProtoMessage() {}
 
 func (x *BatchMetricUpdateResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_metrics_proto_msgTypes[4]
+	mi := &file_metrics_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -292,7 +413,7 @@ func (x *BatchMetricUpdateResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BatchMetricUpdateResponse.ProtoReflect.Descriptor instead.
 func (*BatchMetricUpdateResponse) Descriptor() ([]byte, []int) {
-	return file_metrics_proto_rawDescGZIP(), []int{4}
+	return file_metrics_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *BatchMetricUpdateResponse) GetMetrics() []*MetricResponse {
@@ -302,32 +423,314 @@ func (x *BatchMetricUpdateResponse) GetMetrics() []*MetricResponse {
 	return nil
 }
 
+func (x *BatchMetricUpdateResponse) GetResults() []*MetricResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// Outcome of one metric of batch update
+type MetricResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Status        string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"` // stored or rejected
+	Code          string                 `protobuf:"bytes,5,opt,name=code,proto3" json:"code,omitempty"`     // error code of rejected metric, e.g. invalid_value or aborted
+	Reason        string                 `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricResult) Reset() {
+	*x = MetricResult{}
+	mi := &file_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricResult) ProtoMessage() {}
+
+func (x *MetricResult) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricResult.ProtoReflect.Descriptor instead.
+func (*MetricResult) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *MetricResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *MetricResult) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *MetricResult) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *MetricResult) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *MetricResult) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *MetricResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// Request message for bulk deletion
+type DeleteMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pattern       string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"` // shell pattern: * ? [a-z]
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteMetricsRequest) Reset() {
+	*x = DeleteMetricsRequest{}
+	mi := &file_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMetricsRequest) ProtoMessage() {}
+
+func (x *DeleteMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMetricsRequest.ProtoReflect.Descriptor instead.
+func (*DeleteMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteMetricsRequest) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+// Response message for deletion
+type DeleteMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	Deleted       int64 `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteMetricsResponse) Reset() {
+	*x = DeleteMetricsResponse{}
+	mi := &file_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMetricsResponse) ProtoMessage() {}
+
+func (x *DeleteMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMetricsResponse.ProtoReflect.Descriptor instead.
+func (*DeleteMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteMetricsResponse) GetDeleted() int64 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+// Request message for counter reset
+type ResetCounterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetCounterRequest) Reset() {
+	*x = ResetCounterRequest{}
+	mi := &file_metrics_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetCounterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetCounterRequest) ProtoMessage() {}
+
+func (x *ResetCounterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetCounterRequest.ProtoReflect.Descriptor instead.
+func (*ResetCounterRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ResetCounterRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ResetCounterRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
 var File_metrics_proto protoreflect.FileDescriptor
 
 const file_metrics_proto_rawDesc = "" +
 	"\n" +
-	"\rmetrics.proto\x12\ametrics\"3\n" +
+	"\rmetrics.proto\x12\ametrics\"\xaa\x01\n" +
 	"\rMetricRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
-	"\x04type\x18\x02 \x01(\tR\x04type\"`\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12:\n" +
+	"\x06labels\x18\x03 \x03(\v2\".metrics.MetricRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8a\x02\n" +
 	"\x0eMetricResponse\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
 	"\x05value\x18\x03 \x01(\x01R\x05value\x12\x14\n" +
-	"\x05delta\x18\x04 \x01(\x03R\x05delta\"e\n" +
+	"\x05delta\x18\x04 \x01(\x03R\x05delta\x120\n" +
+	"\thistogram\x18\x05 \x01(\v2\x12.metrics.HistogramR\thistogram\x12;\n" +
+	"\x06labels\x18\x06 \x03(\v2#.metrics.MetricResponse.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb2\x02\n" +
 	"\x13MetricUpdateRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
-	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
-	"\x05value\x18\x03 \x01(\x01R\x05value\x12\x14\n" +
-	"\x05delta\x18\x04 \x01(\x03R\x05delta\"R\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x19\n" +
+	"\x05value\x18\x03 \x01(\x01H\x00R\x05value\x88\x01\x01\x12\x19\n" +
+	"\x05delta\x18\x04 \x01(\x03H\x01R\x05delta\x88\x01\x01\x120\n" +
+	"\thistogram\x18\x05 \x01(\v2\x12.metrics.HistogramR\thistogram\x12@\n" +
+	"\x06labels\x18\x06 \x03(\v2(.metrics.MetricUpdateRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\b\n" +
+	"\x06_valueB\b\n" +
+	"\x06_delta\"c\n" +
+	"\tHistogram\x12\x16\n" +
+	"\x06bounds\x18\x01 \x03(\x01R\x06bounds\x12\x16\n" +
+	"\x06counts\x18\x02 \x03(\x04R\x06counts\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x04R\x05count\x12\x10\n" +
+	"\x03sum\x18\x04 \x01(\x01R\x03sum\"s\n" +
 	"\x18BatchMetricUpdateRequest\x126\n" +
-	"\ametrics\x18\x01 \x03(\v2\x1c.metrics.MetricUpdateRequestR\ametrics\"N\n" +
+	"\ametrics\x18\x01 \x03(\v2\x1c.metrics.MetricUpdateRequestR\ametrics\x12\x1f\n" +
+	"\vbest_effort\x18\x02 \x01(\bR\n" +
+	"bestEffort\"\x7f\n" +
 	"\x19BatchMetricUpdateResponse\x121\n" +
-	"\ametrics\x18\x01 \x03(\v2\x17.metrics.MetricResponseR\ametrics2\xf2\x01\n" +
+	"\ametrics\x18\x01 \x03(\v2\x17.metrics.MetricResponseR\ametrics\x12/\n" +
+	"\aresults\x18\x02 \x03(\v2\x15.metrics.MetricResultR\aresults\"\xec\x01\n" +
+	"\fMetricResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x129\n" +
+	"\x06labels\x18\x03 \x03(\v2!.metrics.MetricResult.LabelsEntryR\x06labels\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12\x12\n" +
+	"\x04code\x18\x05 \x01(\tR\x04code\x12\x16\n" +
+	"\x06reason\x18\x06 \x01(\tR\x06reason\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"0\n" +
+	"\x14DeleteMetricsRequest\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\"1\n" +
+	"\x15DeleteMetricsResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\x03R\adeleted\"\xa2\x01\n" +
+	"\x13ResetCounterRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12@\n" +
+	"\x06labels\x18\x02 \x03(\v2(.metrics.ResetCounterRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\xd1\x03\n" +
 	"\x0eMetricsService\x12<\n" +
 	"\tGetMetric\x12\x16.metrics.MetricRequest\x1a\x17.metrics.MetricResponse\x12E\n" +
 	"\fUpdateMetric\x12\x1c.metrics.MetricUpdateRequest\x1a\x17.metrics.MetricResponse\x12[\n" +
-	"\x12BatchUpdateMetrics\x12!.metrics.BatchMetricUpdateRequest\x1a\".metrics.BatchMetricUpdateResponseB'Z%github.com/Nikolay961996/metsys/protob\x06proto3"
+	"\x12BatchUpdateMetrics\x12!.metrics.BatchMetricUpdateRequest\x1a\".metrics.BatchMetricUpdateResponse\x12F\n" +
+	"\fDeleteMetric\x12\x16.metrics.MetricRequest\x1a\x1e.metrics.DeleteMetricsResponse\x12N\n" +
+	"\rDeleteMetrics\x12\x1d.metrics.DeleteMetricsRequest\x1a\x1e.metrics.DeleteMetricsResponse\x12E\n" +
+	"\fResetCounter\x12\x1c.metrics.ResetCounterRequest\x1a\x17.metrics.MetricResponseB'Z%github.com/Nikolay961996/metsys/protob\x06proto3"
 
 var (
 	file_metrics_proto_rawDescOnce sync.Once
@@ -341,28 +744,52 @@ func file_metrics_proto_rawDescGZIP() []byte {
 	return file_metrics_proto_rawDescData
 }
 
-var file_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
 var file_metrics_proto_goTypes = []any{
 	(*MetricRequest)(nil),             // 0: metrics.MetricRequest
 	(*MetricResponse)(nil),            // 1: metrics.MetricResponse
 	(*MetricUpdateRequest)(nil),       // 2: metrics.MetricUpdateRequest
-	(*BatchMetricUpdateRequest)(nil),  // 3: metrics.BatchMetricUpdateRequest
-	(*BatchMetricUpdateResponse)(nil), // 4: metrics.BatchMetricUpdateResponse
+	(*Histogram)(nil),                 // 3: metrics.Histogram
+	(*BatchMetricUpdateRequest)(nil),  // 4: metrics.BatchMetricUpdateRequest
+	(*BatchMetricUpdateResponse)(nil), // 5: metrics.BatchMetricUpdateResponse
+	(*MetricResult)(nil),              // 6: metrics.MetricResult
+	(*DeleteMetricsRequest)(nil),      // 7: metrics.DeleteMetricsRequest
+	(*DeleteMetricsResponse)(nil),     // 8: metrics.DeleteMetricsResponse
+	(*ResetCounterRequest)(nil),       // 9: metrics.ResetCounterRequest
+	nil,                               // 10: metrics.MetricRequest.LabelsEntry
+	nil,                               // 11: metrics.MetricResponse.LabelsEntry
+	nil,                               // 12: metrics.MetricUpdateRequest.LabelsEntry
+	nil,                               // 13: metrics.MetricResult.LabelsEntry
+	nil,                               // 14: metrics.ResetCounterRequest.LabelsEntry
 }
 var file_metrics_proto_depIdxs = []int32{
-	2, // 0: metrics.BatchMetricUpdateRequest.metrics:type_name -> metrics.MetricUpdateRequest
-	1, // 1: metrics.BatchMetricUpdateResponse.metrics:type_name -> metrics.MetricResponse
-	0, // 2: metrics.MetricsService.GetMetric:input_type -> metrics.MetricRequest
-	2, // 3: metrics.MetricsService.UpdateMetric:input_type -> metrics.MetricUpdateRequest
-	3, // 4: metrics.MetricsService.BatchUpdateMetrics:input_type -> metrics.BatchMetricUpdateRequest
-	1, // 5: metrics.MetricsService.GetMetric:output_type -> metrics.MetricResponse
-	1, // 6: metrics.MetricsService.UpdateMetric:output_type -> metrics.MetricResponse
-	4, // 7: metrics.MetricsService.BatchUpdateMetrics:output_type -> metrics.BatchMetricUpdateResponse
-	5, // [5:8] is the sub-list for method output_type
-	2, // [2:5] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	10, // 0: metrics.MetricRequest.labels:type_name -> metrics.MetricRequest.LabelsEntry
+	3,  // 1: metrics.MetricResponse.histogram:type_name -> metrics.Histogram
+	11, // 2: metrics.MetricResponse.labels:type_name -> metrics.MetricResponse.LabelsEntry
+	3,  // 3: metrics.MetricUpdateRequest.histogram:type_name -> metrics.Histogram
+	12, // 4: metrics.MetricUpdateRequest.labels:type_name -> metrics.MetricUpdateRequest.LabelsEntry
+	2,  // 5: metrics.BatchMetricUpdateRequest.metrics:type_name -> metrics.MetricUpdateRequest
+	1,  // 6: metrics.BatchMetricUpdateResponse.metrics:type_name -> metrics.MetricResponse
+	6,  // 7: metrics.BatchMetricUpdateResponse.results:type_name -> metrics.MetricResult
+	13, // 8: metrics.MetricResult.labels:type_name -> metrics.MetricResult.LabelsEntry
+	14, // 9: metrics.ResetCounterRequest.labels:type_name -> metrics.ResetCounterRequest.LabelsEntry
+	0,  // 10: metrics.MetricsService.GetMetric:input_type -> metrics.MetricRequest
+	2,  // 11: metrics.MetricsService.UpdateMetric:input_type -> metrics.MetricUpdateRequest
+	4,  // 12: metrics.MetricsService.BatchUpdateMetrics:input_type -> metrics.BatchMetricUpdateRequest
+	0,  // 13: metrics.MetricsService.DeleteMetric:input_type -> metrics.MetricRequest
+	7,  // 14: metrics.MetricsService.DeleteMetrics:input_type -> metrics.DeleteMetricsRequest
+	9,  // 15: metrics.MetricsService.ResetCounter:input_type -> metrics.ResetCounterRequest
+	1,  // 16: metrics.MetricsService.GetMetric:output_type -> metrics.MetricResponse
+	1,  // 17: metrics.MetricsService.UpdateMetric:output_type -> metrics.MetricResponse
+	5,  // 18: metrics.MetricsService.BatchUpdateMetrics:output_type -> metrics.BatchMetricUpdateResponse
+	8,  // 19: metrics.MetricsService.DeleteMetric:output_type -> metrics.DeleteMetricsResponse
+	8,  // 20: metrics.MetricsService.DeleteMetrics:output_type -> metrics.DeleteMetricsResponse
+	1,  // 21: metrics.MetricsService.ResetCounter:output_type -> metrics.MetricResponse
+	16, // [16:22] is the sub-list for method output_type
+	10, // [10:16] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_metrics_proto_init() }
@@ -370,13 +797,14 @@ func file_metrics_proto_init() {
 	if File_metrics_proto != nil {
 		return
 	}
+	file_metrics_proto_msgTypes[2].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_metrics_proto_rawDesc), len(file_metrics_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   15,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -22,6 +22,9 @@ const (
 	MetricsService_GetMetric_FullMethodName          = "/metrics.MetricsService/GetMetric"
 	MetricsService_UpdateMetric_FullMethodName       = "/metrics.MetricsService/UpdateMetric"
 	MetricsService_BatchUpdateMetrics_FullMethodName = "/metrics.MetricsService/BatchUpdateMetrics"
+	MetricsService_DeleteMetric_FullMethodName       = "/metrics.MetricsService/DeleteMetric"
+	MetricsService_DeleteMetrics_FullMethodName      = "/metrics.MetricsService/DeleteMetrics"
+	MetricsService_ResetCounter_FullMethodName       = "/metrics.MetricsService/ResetCounter"
 )
 
 // MetricsServiceClient is the client API for MetricsService service.
@@ -36,6 +39,12 @@ type MetricsServiceClient interface {
 	UpdateMetric(ctx context.Context, in *MetricUpdateRequest, opts ...grpc.CallOption) (*MetricResponse, error)
 	// Batch update metrics
 	BatchUpdateMetrics(ctx context.Context, in *BatchMetricUpdateRequest, opts ...grpc.CallOption) (*BatchMetricUpdateResponse, error)
+	// Delete a metric with its history
+	DeleteMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*DeleteMetricsResponse, error)
+	// Delete all metrics which names match the pattern
+	DeleteMetrics(ctx context.Context, in *DeleteMetricsRequest, opts ...grpc.CallOption) (*DeleteMetricsResponse, error)
+	// Reset a counter to zero
+	ResetCounter(ctx context.Context, in *ResetCounterRequest, opts ...grpc.CallOption) (*MetricResponse, error)
 }
 
 type metricsServiceClient struct {
@@ -76,6 +85,36 @@ func (c *metricsServiceClient) BatchUpdateMetrics(ctx context.Context, in *Batch
 	return out, nil
 }
 
+func (c *metricsServiceClient) DeleteMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*DeleteMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteMetricsResponse)
+	err := c.cc.Invoke(ctx, MetricsService_DeleteMetric_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) DeleteMetrics(ctx context.Context, in *DeleteMetricsRequest, opts ...grpc.CallOption) (*DeleteMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteMetricsResponse)
+	err := c.cc.Invoke(ctx, MetricsService_DeleteMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) ResetCounter(ctx context.Context, in *ResetCounterRequest, opts ...grpc.CallOption) (*MetricResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MetricResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ResetCounter_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServiceServer is the server API for MetricsService service.
 // All implementations must embed UnimplementedMetricsServiceServer
 // for forward compatibility.
@@ -88,6 +127,12 @@ type MetricsServiceServer interface {
 	UpdateMetric(context.Context, *MetricUpdateRequest) (*MetricResponse, error)
 	// Batch update metrics
 	BatchUpdateMetrics(context.Context, *BatchMetricUpdateRequest) (*BatchMetricUpdateResponse, error)
+	// Delete a metric with its history
+	DeleteMetric(context.Context, *MetricRequest) (*DeleteMetricsResponse, error)
+	// Delete all metrics which names match the pattern
+	DeleteMetrics(context.Context, *DeleteMetricsRequest) (*DeleteMetricsResponse, error)
+	// Reset a counter to zero
+	ResetCounter(context.Context, *ResetCounterRequest) (*MetricResponse, error)
 	mustEmbedUnimplementedMetricsServiceServer()
 }
 
@@ -107,6 +152,15 @@ func (UnimplementedMetricsServiceServer) UpdateMetric(context.Context, *MetricUp
 func (UnimplementedMetricsServiceServer) BatchUpdateMetrics(context.Context, *BatchMetricUpdateRequest) (*BatchMetricUpdateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdateMetrics not implemented")
 }
+func (UnimplementedMetricsServiceServer) DeleteMetric(context.Context, *MetricRequest) (*DeleteMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetric not implemented")
+}
+func (UnimplementedMetricsServiceServer) DeleteMetrics(context.Context, *DeleteMetricsRequest) (*DeleteMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetrics not implemented")
+}
+func (UnimplementedMetricsServiceServer) ResetCounter(context.Context, *ResetCounterRequest) (*MetricResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetCounter not implemented")
+}
 func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
 func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
 
@@ -182,6 +236,60 @@ func _MetricsService_BatchUpdateMetrics_Handler(srv interface{}, ctx context.Con
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricsService_DeleteMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).DeleteMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_DeleteMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).DeleteMetric(ctx, req.(*MetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_DeleteMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).DeleteMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_DeleteMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).DeleteMetrics(ctx, req.(*DeleteMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_ResetCounter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetCounterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ResetCounter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ResetCounter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ResetCounter(ctx, req.(*ResetCounterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -201,6 +309,18 @@ var MetricsService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "BatchUpdateMetrics",
 			Handler:    _MetricsService_BatchUpdateMetrics_Handler,
 		},
+		{
+			MethodName: "DeleteMetric",
+			Handler:    _MetricsService_DeleteMetric_Handler,
+		},
+		{
+			MethodName: "DeleteMetrics",
+			Handler:    _MetricsService_DeleteMetrics_Handler,
+		},
+		{
+			MethodName: "ResetCounter",
+			Handler:    _MetricsService_ResetCounter_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "metrics.proto",
@@ -2,6 +2,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -44,6 +45,11 @@ func Retryer(f func() error, retryableError ...error) error {
 
 // RetryerCon special function for expenecial back-off with check function.
 func RetryerCon(f func() error, isRetryable func(error) bool) error {
+	return RetryerConContext(context.Background(), f, isRetryable)
+}
+
+// RetryerConContext same as RetryerCon, but stops waiting when ctx is done.
+func RetryerConContext(ctx context.Context, f func() error, isRetryable func(error) bool) error {
 	// 1.2...3.....4x
 	tryStep := 1
 	for tryStep <= models.MaxErrRetryCount {
@@ -55,7 +61,11 @@ func RetryerCon(f func() error, isRetryable func(error) bool) error {
 		if !isRetryable(err) || tryStep == 4 {
 			return err
 		}
-		time.Sleep(time.Duration(tryStep*2-1) * time.Second)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(time.Duration(tryStep*2-1) * time.Second):
+		}
 		tryStep++
 	}
 